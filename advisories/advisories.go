@@ -0,0 +1,166 @@
+package advisories
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Advisory struct {
+	ID          string  `json:"id"`
+	Path        string  `json:"path"`
+	Description string  `json:"description"`
+	Affected    []Range `json:"affected"`
+
+	// where the advisory was read from
+	File string `json:"-"`
+}
+
+// the revisions from Introduced (inclusive) up to Fixed (exclusive); either
+// may be a commit or a tag, and either may be left out to mean since the
+// beginning or not yet fixed
+type Range struct {
+	Introduced string `json:"introduced"`
+	Fixed      string `json:"fixed"`
+}
+
+type UnsupportedFormatError struct {
+	Path string
+}
+
+func (e UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("%s: advisories must be written as JSON", e.Path)
+}
+
+type MissingFieldError struct {
+	File  string
+	ID    string
+	Field string
+}
+
+func (e MissingFieldError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("%s: advisory has no '%s'", e.File, e.Field)
+	}
+
+	return fmt.Sprintf("%s: advisory %s has no '%s'", e.File, e.ID, e.Field)
+}
+
+// the part of a repository needed to place a revision in a range
+type Ancestry interface {
+	IsAncestor(ancestor, descendant string) (bool, error)
+}
+
+// reads every .json file beneath the directory; YAML files are refused
+// rather than skipped, so that none of the database goes unread
+func Load(dir string) ([]Advisory, error) {
+	advisories := []Advisory{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+		case ".yml", ".yaml":
+			return UnsupportedFormatError{path}
+		default:
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		parsed, err := JSON(content)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		for _, advisory := range parsed {
+			advisory.File = path
+
+			if advisory.Path == "" {
+				return MissingFieldError{path, advisory.ID, "path"}
+			}
+
+			if len(advisory.Affected) == 0 {
+				return MissingFieldError{path, advisory.ID, "affected"}
+			}
+
+			advisories = append(advisories, advisory)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return advisories, nil
+}
+
+// the advisories for the dependency, including those for packages within it
+func For(advisories []Advisory, path string) []Advisory {
+	matching := []Advisory{}
+
+	for _, advisory := range advisories {
+		if advisory.Path == path || strings.HasPrefix(advisory.Path, path+"/") || strings.HasPrefix(path, advisory.Path+"/") {
+			matching = append(matching, advisory)
+		}
+	}
+
+	return matching
+}
+
+// the first range that includes the revision, if any
+func (a Advisory) Affects(repo Ancestry, revision string) (Range, bool, error) {
+	for _, affected := range a.Affected {
+		included, err := affected.Includes(repo, revision)
+		if err != nil {
+			return Range{}, false, err
+		}
+
+		if included {
+			return affected, true, nil
+		}
+	}
+
+	return Range{}, false, nil
+}
+
+// whether the revision descends from Introduced but not from Fixed
+func (r Range) Includes(repo Ancestry, revision string) (bool, error) {
+	if r.Introduced != "" {
+		introduced, err := repo.IsAncestor(r.Introduced, revision)
+		if err != nil {
+			return false, err
+		}
+
+		if !introduced {
+			return false, nil
+		}
+	}
+
+	if r.Fixed != "" {
+		fixed, err := repo.IsAncestor(r.Fixed, revision)
+		if err != nil {
+			return false, err
+		}
+
+		if fixed {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
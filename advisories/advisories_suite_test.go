@@ -0,0 +1,13 @@
+package advisories_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAdvisories(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Advisories Suite")
+}
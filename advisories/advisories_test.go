@@ -0,0 +1,182 @@
+package advisories_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/advisories"
+)
+
+// a linear history: a <- b <- c <- d
+type fakeHistory []string
+
+func (h fakeHistory) IsAncestor(ancestor, descendant string) (bool, error) {
+	for _, revision := range h {
+		if revision == ancestor {
+			return true, nil
+		}
+
+		if revision == descendant {
+			return false, nil
+		}
+	}
+
+	return false, nil
+}
+
+var _ = Describe("Advisories", func() {
+	Describe("JSON", func() {
+		It("parses an advisory or a list of them", func() {
+			parsed, err := advisories.JSON([]byte(`{"id": "A", "path": "github.com/a", "affected": [{"fixed": "v2"}]}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal([]advisories.Advisory{
+				{ID: "A", Path: "github.com/a", Affected: []advisories.Range{{Fixed: "v2"}}},
+			}))
+
+			parsed, err = advisories.JSON([]byte(`[{"id": "A"}, {"id": "B"}]`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(HaveLen(2))
+		})
+	})
+
+	Describe("Load", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+
+			dir, err = ioutil.TempDir("", "advisories")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = os.MkdirAll(filepath.Join(dir, "github.com"), 0755)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reads every advisory file beneath the directory", func() {
+			err := ioutil.WriteFile(filepath.Join(dir, "github.com", "a.json"), []byte(`{"id": "A", "path": "github.com/a", "affected": [{"fixed": "v2"}]}`), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"id": "B", "path": "github.com/b", "affected": [{"fixed": "v3"}]}`), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not an advisory"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			loaded, err := advisories.Load(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(HaveLen(2))
+			Expect(loaded[0].ID).To(Equal("B"))
+			Expect(loaded[0].File).To(Equal(filepath.Join(dir, "b.json")))
+			Expect(loaded[1].ID).To(Equal("A"))
+			Expect(loaded[1].File).To(Equal(filepath.Join(dir, "github.com", "a.json")))
+		})
+
+		It("requires a path and affected ranges", func() {
+			path := filepath.Join(dir, "a.json")
+
+			err := ioutil.WriteFile(path, []byte(`{"id": "A", "affected": [{"fixed": "v2"}]}`), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = advisories.Load(dir)
+			Expect(err).To(Equal(advisories.MissingFieldError{File: path, ID: "A", Field: "path"}))
+
+			err = ioutil.WriteFile(path, []byte(`{"id": "A", "path": "github.com/a"}`), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = advisories.Load(dir)
+			Expect(err).To(Equal(advisories.MissingFieldError{File: path, ID: "A", Field: "affected"}))
+		})
+
+		It("reports the file that cannot be parsed", func() {
+			path := filepath.Join(dir, "a.json")
+
+			err := ioutil.WriteFile(path, []byte(`{"id": "A",`), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = advisories.Load(dir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(path + ": "))
+		})
+
+		It("refuses YAML files", func() {
+			path := filepath.Join(dir, "github.com", "a.yml")
+
+			err := ioutil.WriteFile(path, []byte("id: A\npath: github.com/a\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = advisories.Load(dir)
+			Expect(err).To(Equal(advisories.UnsupportedFormatError{Path: path}))
+		})
+	})
+
+	Describe("For", func() {
+		It("finds the advisories for the dependency and packages within it", func() {
+			known := []advisories.Advisory{
+				{ID: "A", Path: "github.com/a/b"},
+				{ID: "B", Path: "github.com/a/b/sub"},
+				{ID: "C", Path: "github.com/a/bc"},
+				{ID: "D", Path: "github.com/a"},
+			}
+
+			ids := []string{}
+			for _, advisory := range advisories.For(known, "github.com/a/b") {
+				ids = append(ids, advisory.ID)
+			}
+
+			Expect(ids).To(Equal([]string{"A", "B", "D"}))
+		})
+	})
+
+	Describe("Affects", func() {
+		history := fakeHistory{"a", "b", "c", "d"}
+
+		advisory := advisories.Advisory{
+			ID:   "A",
+			Path: "github.com/a",
+			Affected: []advisories.Range{
+				{Introduced: "b", Fixed: "d"},
+			},
+		}
+
+		It("includes revisions from introduced up to fixed", func() {
+			_, affected, err := advisory.Affects(history, "a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(affected).To(BeFalse())
+
+			affectedRange, affected, err := advisory.Affects(history, "b")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(affected).To(BeTrue())
+			Expect(affectedRange.Fixed).To(Equal("d"))
+
+			_, affected, err = advisory.Affects(history, "c")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(affected).To(BeTrue())
+
+			_, affected, err = advisory.Affects(history, "d")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(affected).To(BeFalse())
+		})
+
+		It("treats a missing bound as open", func() {
+			unfixed := advisories.Range{Introduced: "c"}
+
+			included, err := unfixed.Includes(history, "d")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(included).To(BeTrue())
+
+			always := advisories.Range{Fixed: "c"}
+
+			included, err = always.Includes(history, "a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(included).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,29 @@
+package advisories
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// a single advisory, or a list of them
+func JSON(content []byte) ([]Advisory, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		advisories := []Advisory{}
+
+		err := json.Unmarshal(content, &advisories)
+		if err != nil {
+			return nil, err
+		}
+
+		return advisories, nil
+	}
+
+	var advisory Advisory
+
+	err := json.Unmarshal(content, &advisory)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Advisory{advisory}, nil
+}
@@ -0,0 +1,507 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// versions of archive dependencies are their checksums, e.g. 'sha256:<hex>'
+const ChecksumPrefix = "sha256:"
+
+// how long a download may take
+var Timeout = 10 * time.Minute
+
+type ChecksumMismatchError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (e ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s:\n  want %s\n  have %s", e.URL, e.Expected, e.Actual)
+}
+
+type InvalidChecksumError struct {
+	Checksum string
+}
+
+func (e InvalidChecksumError) Error() string {
+	return fmt.Sprintf("invalid checksum '%s'; expected '%s<hex>'", e.Checksum, ChecksumPrefix)
+}
+
+type HTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("downloading %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// server errors may go away if retried
+func (e HTTPError) Temporary() bool {
+	return e.StatusCode >= 500
+}
+
+type UnknownFormatError struct {
+	URL string
+}
+
+func (e UnknownFormatError) Error() string {
+	return fmt.Sprintf("cannot tell how to unpack %s; expected .tar.gz, .tgz, .tar.bz2, .tar or .zip", e.URL)
+}
+
+type UnsafePathError struct {
+	Path string
+}
+
+func (e UnsafePathError) Error() string {
+	return fmt.Sprintf("refusing to unpack '%s' outside of the destination", e.Path)
+}
+
+// the checksum of everything read, in the form used for versions
+func Checksum(r io.Reader) (string, error) {
+	hash := sha256.New()
+
+	_, err := io.Copy(hash, r)
+	if err != nil {
+		return "", err
+	}
+
+	return ChecksumPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func ChecksumFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	return Checksum(file)
+}
+
+// downloads the archive into the directory, named by its checksum, unless it
+// is already there, and verifies it; returns the archive's path
+//
+// the download stops when the context is done, e.g. when interrupted
+func Download(ctx context.Context, url string, checksum string, dir string) (string, error) {
+	if !strings.HasPrefix(checksum, ChecksumPrefix) {
+		return "", InvalidChecksumError{checksum}
+	}
+
+	archivePath := filepath.Join(dir, strings.TrimPrefix(checksum, ChecksumPrefix)+extension(url))
+
+	if actual, err := ChecksumFile(archivePath); err == nil && actual == checksum {
+		return archivePath, nil
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: Timeout}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", HTTPError{url, response.StatusCode}
+	}
+
+	file, err := ioutil.TempFile(dir, ".download")
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(file, hash), response.Body)
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	actual := ChecksumPrefix + hex.EncodeToString(hash.Sum(nil))
+	if actual != checksum {
+		return "", ChecksumMismatchError{
+			URL:      url,
+			Expected: checksum,
+			Actual:   actual,
+		}
+	}
+
+	err = os.Rename(file.Name(), archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	return archivePath, nil
+}
+
+// unpacks the archive into the destination directory; the format is
+// determined by the url it came from. If everything in the
+// archive is in one top-level directory (e.g. 'lib-1.2/'), its contents are
+// unpacked instead.
+func Unpack(archivePath string, url string, dest string) error {
+	entries, err := open(archivePath, url)
+	if err != nil {
+		return err
+	}
+
+	defer entries.Close()
+
+	prefix, err := commonDirectory(archivePath, url)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(path.Clean(entry.name), "..") {
+			return UnsafePathError{entry.name}
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+entry.name), "/")
+		if prefix != "" {
+			name = strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+		}
+
+		if name == "" || name == "." {
+			continue
+		}
+
+		// e.g. a symlink to somewhere else unpacked earlier
+		through, err := throughSymlink(dest, name)
+		if err != nil {
+			return err
+		}
+
+		if through {
+			return UnsafePathError{entry.name}
+		}
+
+		if entry.link != "" {
+			escaping, err := escapes(dest, name, entry.link)
+			if err != nil {
+				return err
+			}
+
+			if escaping {
+				return UnsafePathError{entry.name + " -> " + entry.link}
+			}
+		}
+
+		err = entry.writeTo(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extension(url string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar.bz2", ".tar", ".zip"} {
+		if strings.HasSuffix(url, ext) {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+// the single top-level directory that every entry is in, if there is one
+func commonDirectory(archivePath string, url string) (string, error) {
+	entries, err := open(archivePath, url)
+	if err != nil {
+		return "", err
+	}
+
+	defer entries.Close()
+
+	common := ""
+
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+entry.name), "/")
+
+		segments := strings.SplitN(name, "/", 2)
+		if len(segments) == 1 && !entry.isDir {
+			// a file at the top level
+			return "", nil
+		}
+
+		if common == "" {
+			common = segments[0]
+		} else if segments[0] != common {
+			return "", nil
+		}
+	}
+
+	return common, nil
+}
+
+// whether a symlink's target, followed from where it is unpacked, leaves the
+// destination; targets that pass through other symlinks are refused too, as
+// where they lead can't be told from their names
+func escapes(dest string, name string, link string) (bool, error) {
+	if path.IsAbs(link) || filepath.IsAbs(link) {
+		return true, nil
+	}
+
+	resolved := strings.Split(path.Dir(name), "/")
+	if path.Dir(name) == "." {
+		resolved = nil
+	}
+
+	for _, segment := range strings.Split(link, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return true, nil
+			}
+
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, segment)
+
+		through, err := throughSymlink(dest, strings.Join(resolved, "/"))
+		if err != nil || through {
+			return true, err
+		}
+	}
+
+	return false, nil
+}
+
+// whether the path within the destination, or any directory leading to it,
+// is already a symlink; writing there could land anywhere
+func throughSymlink(dest string, name string) (bool, error) {
+	current := dest
+
+	for _, segment := range strings.Split(name, "/") {
+		current = filepath.Join(current, segment)
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type entry struct {
+	name  string
+	isDir bool
+	mode  os.FileMode
+
+	// the target of a symlink
+	link string
+
+	contents func() (io.ReadCloser, error)
+}
+
+func (e entry) writeTo(target string) error {
+	if e.isDir {
+		return os.MkdirAll(target, 0755)
+	}
+
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	if e.link != "" {
+		return os.Symlink(e.link, target)
+	}
+
+	contents, err := e.contents()
+	if err != nil {
+		return err
+	}
+
+	defer contents.Close()
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, e.mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, contents)
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+type entries interface {
+	Next() (entry, error)
+	Close() error
+}
+
+func open(archivePath string, url string) (entries, error) {
+	switch extension(url) {
+	case ".zip":
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return &zipEntries{reader: reader}, nil
+
+	case ".tar.gz", ".tgz", ".tar.bz2", ".tar":
+		file, err := os.Open(archivePath)
+		if err != nil {
+			return nil, err
+		}
+
+		var stream io.Reader = file
+
+		switch extension(url) {
+		case ".tar.gz", ".tgz":
+			stream, err = gzip.NewReader(file)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+
+		case ".tar.bz2":
+			stream = bzip2.NewReader(file)
+		}
+
+		return &tarEntries{file: file, reader: tar.NewReader(stream)}, nil
+	}
+
+	return nil, UnknownFormatError{url}
+}
+
+type tarEntries struct {
+	file   *os.File
+	reader *tar.Reader
+}
+
+func (t *tarEntries) Next() (entry, error) {
+	for {
+		header, err := t.reader.Next()
+		if err != nil {
+			return entry{}, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return entry{name: header.Name, isDir: true}, nil
+
+		case tar.TypeSymlink:
+			return entry{name: header.Name, link: header.Linkname}, nil
+
+		case tar.TypeReg, tar.TypeRegA:
+			reader := t.reader
+
+			return entry{
+				name: header.Name,
+				mode: os.FileMode(header.Mode),
+				contents: func() (io.ReadCloser, error) {
+					return ioutil.NopCloser(reader), nil
+				},
+			}, nil
+		}
+
+		// skip anything else, e.g. global headers
+	}
+}
+
+func (t *tarEntries) Close() error {
+	return t.file.Close()
+}
+
+type zipEntries struct {
+	reader *zip.ReadCloser
+	next   int
+}
+
+func (z *zipEntries) Next() (entry, error) {
+	if z.next >= len(z.reader.File) {
+		return entry{}, io.EOF
+	}
+
+	file := z.reader.File[z.next]
+	z.next++
+
+	if file.FileInfo().IsDir() {
+		return entry{name: file.Name, isDir: true}, nil
+	}
+
+	return entry{
+		name:     file.Name,
+		mode:     file.Mode(),
+		contents: file.Open,
+	}, nil
+}
+
+func (z *zipEntries) Close() error {
+	return z.reader.Close()
+}
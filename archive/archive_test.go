@@ -0,0 +1,428 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/archive"
+)
+
+func tarball(files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+			Typeflag: tar.TypeReg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = tw.Write([]byte(files[name]))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Expect(tw.Close()).ToNot(HaveOccurred())
+	Expect(gz.Close()).ToNot(HaveOccurred())
+
+	return buf.Bytes()
+}
+
+// entries in order; names ending in '/' are directories, and entries with
+// a link are symlinks
+type tarEntry struct {
+	name     string
+	link     string
+	contents string
+}
+
+func orderedTarball(entries []tarEntry) []byte {
+	buf := new(bytes.Buffer)
+
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg}
+
+		if entry.link != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.link
+		} else if strings.HasSuffix(entry.name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		} else {
+			header.Size = int64(len(entry.contents))
+		}
+
+		err := tw.WriteHeader(header)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = tw.Write([]byte(entry.contents))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Expect(tw.Close()).ToNot(HaveOccurred())
+	Expect(gz.Close()).ToNot(HaveOccurred())
+
+	return buf.Bytes()
+}
+
+func zipball(files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+
+	zw := zip.NewWriter(buf)
+
+	for name, contents := range files {
+		file, err := zw.Create(name)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = file.Write([]byte(contents))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Expect(zw.Close()).ToNot(HaveOccurred())
+
+	return buf.Bytes()
+}
+
+func checksum(contents []byte) string {
+	sum, err := archive.Checksum(bytes.NewReader(contents))
+	Expect(err).ToNot(HaveOccurred())
+
+	return sum
+}
+
+func readFile(path string) string {
+	contents, err := ioutil.ReadFile(path)
+	Expect(err).ToNot(HaveOccurred())
+
+	return string(contents)
+}
+
+var _ = Describe("Archives", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir("", "archive")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	Describe("Download", func() {
+		var server *httptest.Server
+		var contents []byte
+		var requests int
+
+		BeforeEach(func() {
+			contents = tarball(map[string]string{"lib-1.2/lib.go": "package lib\n"})
+			requests = 0
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				if r.URL.Path != "/lib-1.2.tar.gz" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				w.Write(contents)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("downloads the archive into the directory, named by its checksum", func() {
+			path, err := archive.Download(context.Background(), server.URL+"/lib-1.2.tar.gz", checksum(contents), tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Dir(path)).To(Equal(tmpdir))
+			Expect(filepath.Base(path)).To(MatchRegexp(`^[0-9a-f]{64}\.tar\.gz$`))
+			Expect(readFile(path)).To(Equal(string(contents)))
+		})
+
+		It("does not download it again once it is there", func() {
+			_, err := archive.Download(context.Background(), server.URL+"/lib-1.2.tar.gz", checksum(contents), tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = archive.Download(context.Background(), server.URL+"/lib-1.2.tar.gz", checksum(contents), tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(requests).To(Equal(1))
+		})
+
+		Context("when the checksum does not match", func() {
+			It("returns a ChecksumMismatchError and keeps nothing", func() {
+				expected := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+				_, err := archive.Download(context.Background(), server.URL+"/lib-1.2.tar.gz", expected, tmpdir)
+				Expect(err).To(Equal(archive.ChecksumMismatchError{
+					URL:      server.URL + "/lib-1.2.tar.gz",
+					Expected: expected,
+					Actual:   checksum(contents),
+				}))
+
+				files, err := ioutil.ReadDir(tmpdir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(BeEmpty())
+			})
+		})
+
+		Context("when the checksum is not a sha256", func() {
+			It("returns an InvalidChecksumError without downloading", func() {
+				_, err := archive.Download(context.Background(), server.URL+"/lib-1.2.tar.gz", "v1.2", tmpdir)
+				Expect(err).To(Equal(archive.InvalidChecksumError{Checksum: "v1.2"}))
+
+				Expect(requests).To(BeZero())
+			})
+		})
+
+		Context("when the context is done", func() {
+			It("does not download it and keeps nothing", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := archive.Download(ctx, server.URL+"/lib-1.2.tar.gz", checksum(contents), tmpdir)
+				Expect(err).To(HaveOccurred())
+
+				Expect(requests).To(BeZero())
+
+				files, err := ioutil.ReadDir(tmpdir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(BeEmpty())
+			})
+		})
+
+		Context("when the server responds with an error", func() {
+			It("returns an HTTPError", func() {
+				_, err := archive.Download(context.Background(), server.URL+"/missing.tar.gz", checksum(contents), tmpdir)
+				Expect(err).To(Equal(archive.HTTPError{
+					URL:        server.URL + "/missing.tar.gz",
+					StatusCode: http.StatusNotFound,
+				}))
+			})
+		})
+	})
+
+	Describe("Unpack", func() {
+		var dest string
+
+		BeforeEach(func() {
+			dest = filepath.Join(tmpdir, "dest")
+		})
+
+		write := func(name string, contents []byte) string {
+			path := filepath.Join(tmpdir, name)
+
+			err := ioutil.WriteFile(path, contents, 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			return path
+		}
+
+		It("unpacks the contents of a tarball's top-level directory", func() {
+			path := write("archive", tarball(map[string]string{
+				"lib-1.2/lib.go":     "package lib\n",
+				"lib-1.2/sub/sub.go": "package sub\n",
+			}))
+
+			err := archive.Unpack(path, "https://example.com/lib-1.2.tar.gz", dest)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(readFile(filepath.Join(dest, "lib.go"))).To(Equal("package lib\n"))
+			Expect(readFile(filepath.Join(dest, "sub", "sub.go"))).To(Equal("package sub\n"))
+		})
+
+		It("unpacks everything when there is more than one top-level entry", func() {
+			path := write("archive", tarball(map[string]string{
+				"lib.go":     "package lib\n",
+				"sub/sub.go": "package sub\n",
+			}))
+
+			err := archive.Unpack(path, "https://example.com/lib.tgz", dest)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(readFile(filepath.Join(dest, "lib.go"))).To(Equal("package lib\n"))
+			Expect(readFile(filepath.Join(dest, "sub", "sub.go"))).To(Equal("package sub\n"))
+		})
+
+		It("unpacks zips", func() {
+			path := write("archive", zipball(map[string]string{
+				"lib-master/lib.go": "package lib\n",
+			}))
+
+			err := archive.Unpack(path, "https://example.com/master.zip", dest)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(readFile(filepath.Join(dest, "lib.go"))).To(Equal("package lib\n"))
+		})
+
+		It("refuses paths outside of the destination", func() {
+			path := write("archive", tarball(map[string]string{
+				"lib.go":       "package lib\n",
+				"../escape.go": "package escape\n",
+			}))
+
+			err := archive.Unpack(path, "https://example.com/lib.tar.gz", dest)
+			Expect(err).To(Equal(archive.UnsafePathError{Path: "../escape.go"}))
+
+			_, err = os.Stat(filepath.Join(tmpdir, "escape.go"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		Describe("symlinks", func() {
+			unpack := func(entries ...tarEntry) error {
+				path := write("archive", orderedTarball(entries))
+				return archive.Unpack(path, "https://example.com/lib-1.2.tar.gz", dest)
+			}
+
+			escaped := func() bool {
+				_, err := os.Stat(filepath.Join(tmpdir, "outside", "pwn"))
+				return err == nil
+			}
+
+			BeforeEach(func() {
+				err := os.MkdirAll(filepath.Join(tmpdir, "outside"), 0755)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("unpacks links within the destination", func() {
+				err := unpack(
+					tarEntry{name: "lib-1.2/sub/lib.go", contents: "package lib\n"},
+					tarEntry{name: "lib-1.2/lib.go", link: "sub/lib.go"},
+				)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(readFile(filepath.Join(dest, "lib.go"))).To(Equal("package lib\n"))
+			})
+
+			It("resolves links from where they are unpacked, without the top-level directory", func() {
+				err := unpack(
+					tarEntry{name: "lib-1.2/"},
+					tarEntry{name: "lib-1.2/evil", link: "../outside"},
+					tarEntry{name: "lib-1.2/evil/pwn", contents: "pwned\n"},
+				)
+				Expect(err).To(Equal(archive.UnsafePathError{Path: "lib-1.2/evil -> ../outside"}))
+
+				Expect(escaped()).To(BeFalse())
+			})
+
+			It("refuses links that lead out through other links", func() {
+				err := unpack(
+					tarEntry{name: "lib-1.2/here", link: "."},
+					tarEntry{name: "lib-1.2/evil", link: "here/../../outside"},
+				)
+				Expect(err).To(Equal(archive.UnsafePathError{Path: "lib-1.2/evil -> here/../../outside"}))
+			})
+
+			It("refuses to write anything through a link", func() {
+				err := unpack(
+					tarEntry{name: "lib-1.2/sub/"},
+					tarEntry{name: "lib-1.2/link", link: "sub"},
+					tarEntry{name: "lib-1.2/link/pwn", contents: "pwned\n"},
+				)
+				Expect(err).To(Equal(archive.UnsafePathError{Path: "lib-1.2/link/pwn"}))
+
+				_, err = os.Stat(filepath.Join(dest, "sub", "pwn"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		It("fails for unknown formats", func() {
+			path := write("archive", []byte("not an archive"))
+
+			err := archive.Unpack(path, "https://example.com/lib.rar", dest)
+			Expect(err).To(Equal(archive.UnknownFormatError{URL: "https://example.com/lib.rar"}))
+		})
+	})
+
+	Describe("manifests", func() {
+		BeforeEach(func() {
+			err := os.MkdirAll(filepath.Join(tmpdir, "sub"), 0755)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(tmpdir, "lib.go"), []byte("package lib\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(tmpdir, "sub", "sub.go"), []byte("package sub\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = archive.WriteManifest(tmpdir, "sha256:abc", "https://example.com/lib.tar.gz")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("records the version, URL and checksum of every file", func() {
+			manifest, err := archive.ReadManifest(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(manifest.Version).To(Equal("sha256:abc"))
+			Expect(manifest.URL).To(Equal("https://example.com/lib.tar.gz"))
+			Expect(manifest.Files).To(Equal(map[string]string{
+				"lib.go":     checksum([]byte("package lib\n")),
+				"sub/sub.go": checksum([]byte("package sub\n")),
+			}))
+		})
+
+		It("verifies nothing has changed", func() {
+			manifest, err := archive.ReadManifest(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+
+			modified, missing, untracked, err := manifest.Verify(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(modified).To(BeEmpty())
+			Expect(missing).To(BeEmpty())
+			Expect(untracked).To(BeEmpty())
+		})
+
+		It("detects modified, missing and untracked files", func() {
+			err := ioutil.WriteFile(filepath.Join(tmpdir, "lib.go"), []byte("package changed\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = os.Remove(filepath.Join(tmpdir, "sub", "sub.go"))
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(tmpdir, "new.go"), []byte("package lib\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			manifest, err := archive.ReadManifest(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+
+			modified, missing, untracked, err := manifest.Verify(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(modified).To(Equal([]string{"lib.go"}))
+			Expect(missing).To(Equal([]string{"sub/sub.go"}))
+			Expect(untracked).To(Equal([]string{"new.go"}))
+		})
+	})
+})
@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// written into unpacked archives to record where they came from and what
+// they contained
+const ManifestFile = ".gocart-archive"
+
+type Manifest struct {
+	Version string
+	URL     string
+
+	// checksums of each file, keyed by slash-separated path
+	Files map[string]string
+}
+
+type InvalidManifestError struct {
+	Path string
+	Line int
+}
+
+func (e InvalidManifestError) Error() string {
+	return fmt.Sprintf("invalid archive manifest %s (line %d)", e.Path, e.Line)
+}
+
+// records the current contents of the directory
+func WriteManifest(dir string, version string, url string) error {
+	files, err := Checksums(dir)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	file, err := os.Create(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintf(writer, "%s %s\n", version, url)
+
+	for _, path := range paths {
+		fmt.Fprintf(writer, "%s  %s\n", files[path], path)
+	}
+
+	err = writer.Flush()
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func ReadManifest(dir string) (*Manifest, error) {
+	manifestPath := filepath.Join(dir, ManifestFile)
+
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	manifest := &Manifest{Files: map[string]string{}}
+
+	scanner := bufio.NewScanner(file)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+
+		if line == 1 {
+			fields := strings.Fields(text)
+			if len(fields) != 2 {
+				return nil, InvalidManifestError{manifestPath, line}
+			}
+
+			manifest.Version = fields[0]
+			manifest.URL = fields[1]
+			continue
+		}
+
+		segments := strings.SplitN(text, "  ", 2)
+		if len(segments) != 2 {
+			return nil, InvalidManifestError{manifestPath, line}
+		}
+
+		manifest.Files[segments[1]] = segments[0]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if line == 0 {
+		return nil, InvalidManifestError{manifestPath, 1}
+	}
+
+	return manifest, nil
+}
+
+// compares the directory to the manifest
+func (m *Manifest) Verify(dir string) (modified, missing, untracked []string, err error) {
+	files, err := Checksums(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	modified, missing, untracked = Compare(m.Files, files)
+
+	return modified, missing, untracked, nil
+}
+
+// compares recorded checksums against current ones, returning sorted paths
+func Compare(recorded, current map[string]string) (modified, missing, untracked []string) {
+	for path, checksum := range recorded {
+		actual, found := current[path]
+		if !found {
+			missing = append(missing, path)
+		} else if actual != checksum {
+			modified = append(modified, path)
+		}
+	}
+
+	for path := range current {
+		if _, found := recorded[path]; !found {
+			untracked = append(untracked, path)
+		}
+	}
+
+	sort.Strings(modified)
+	sort.Strings(missing)
+	sort.Strings(untracked)
+
+	return modified, missing, untracked
+}
+
+// checksums of every file and symlink under the directory, other than a
+// manifest at its top; symlinks are checksummed by their target
+func Checksums(dir string) (map[string]string, error) {
+	files := map[string]string{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if rel == ManifestFile {
+			return nil
+		}
+
+		var checksum string
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			checksum, err = Checksum(strings.NewReader(target))
+			if err != nil {
+				return err
+			}
+		} else {
+			checksum, err = ChecksumFile(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		files[rel] = checksum
+
+		return nil
+	})
+
+	return files, err
+}
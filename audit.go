@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vito/gocart/advisories"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+type auditFinding struct {
+	Path     string
+	Version  string
+	Advisory advisories.Advisory
+	Range    advisories.Range
+}
+
+func audit(root string, advisoryDir string, recursive bool, filter tags.Filter, nested *tags.NestedFilters) {
+	if advisoryDir == "" {
+		fatal("no advisory database given; use -advisories <directory>")
+	}
+
+	known, err := advisories.Load(advisoryDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	findings := []auditFinding{}
+
+	err = auditDependencies(&findings, map[string]bool{}, known, cartridge, recursive, filter, nested)
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(findings) == 0 {
+		fmt.Println(green("OK"))
+		return
+	}
+
+	for _, finding := range findings {
+		fmt.Println(bold(finding.Path) + " " + cyan(finding.Version))
+
+		fmt.Println(indent(1, red(finding.Advisory.ID)+" ("+finding.Advisory.File+")"))
+
+		if finding.Advisory.Description != "" {
+			fmt.Println(indent(2, finding.Advisory.Description))
+		}
+
+		introduced := "the beginning"
+		if finding.Range.Introduced != "" {
+			introduced = finding.Range.Introduced
+		}
+
+		fmt.Println(indent(2, "affected since "+introduced))
+
+		if finding.Range.Fixed == "" {
+			fmt.Println(indent(2, red("no fix available")))
+		} else {
+			fmt.Println(indent(2, "fixed in "+green(finding.Range.Fixed)))
+		}
+
+		fmt.Println()
+	}
+
+	if len(findings) == 1 {
+		fmt.Fprintln(os.Stderr, red("1 advisory affects the locked dependencies"))
+	} else {
+		fmt.Fprintln(os.Stderr, red(fmt.Sprintf("%d advisories affect the locked dependencies", len(findings))))
+	}
+
+	os.Exit(1)
+}
+
+func auditDependencies(findings *[]auditFinding, audited map[string]bool, known []advisories.Advisory, deps *set.Set, recursive bool, filter tags.Filter, nested *tags.NestedFilters) error {
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		repo, version, err := resolveInstalled(dep)
+		if err != nil {
+			return fmt.Errorf("failed to audit %s:\n%s", dep.Path, indent(1, err.Error()))
+		}
+
+		if audited[dep.Path+"@"+version] {
+			continue
+		}
+
+		audited[dep.Path+"@"+version] = true
+
+		for _, advisory := range advisories.For(known, dep.Path) {
+			affected, isAffected, err := advisory.Affects(repo, version)
+			if err != nil {
+				return fmt.Errorf(
+					"failed to check %s against %s (%s):\n%s",
+					dep.Path,
+					advisory.ID,
+					advisory.File,
+					indent(1, err.Error()),
+				)
+			}
+
+			if isAffected {
+				*findings = append(*findings, auditFinding{
+					Path:     dep.Path,
+					Version:  version,
+					Advisory: advisory,
+					Range:    affected,
+				})
+			}
+		}
+
+		if !recursive {
+			continue
+		}
+
+		nextDeps, err := set.LoadFrom(dep.FullPath(GOPATH))
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = auditDependencies(findings, audited, known, nextDeps, true, nested.For(dep.Path), nested)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
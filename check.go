@@ -3,11 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 
-	"github.com/vito/gocart/command_runner"
 	"github.com/vito/gocart/dependency"
 	"github.com/vito/gocart/repository"
 	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
 )
 
 type VersionMismatch struct {
@@ -18,16 +19,28 @@ type VersionMismatch struct {
 func (self VersionMismatch) Error() string {
 	want := indent(1, "want "+red(self.Expected))
 	have := indent(1, "have "+green(self.Status.CurrentVersion))
-	log := indent(1, self.Status.DeltaLog)
 
-	if self.Status.Delta > 0 {
-		have = have + " (" + bold(fmt.Sprintf("%d", self.Status.Delta)) + " ahead)"
-		have = have + "\n" + indent(1, "extra commits:\n"+log)
-	} else if self.Status.Delta == 0 {
-		have = have + " (? behind)"
+	extra := indent(1, "extra commits:\n"+commitLog(self.Status.AheadLog))
+	missing := indent(1, "missing commits:\n"+commitLog(self.Status.BehindLog))
+
+	ahead := bold(fmt.Sprintf("%d", self.Status.Ahead))
+	behind := bold(fmt.Sprintf("%d", self.Status.Behind))
+
+	if self.Status.Truncated {
+		have = have + " (unknown ahead/behind; history is truncated)"
+	} else if self.Status.Unrelated {
+		have = have + " (no common history)"
+	} else if self.Status.Ahead > 0 && self.Status.Behind > 0 {
+		have = have + " (diverged; " + ahead + " ahead, " + behind + " behind)"
+		have = have + "\n" + extra + missing
+	} else if self.Status.Ahead > 0 {
+		have = have + " (" + ahead + " ahead)"
+		have = have + "\n" + extra
+	} else if self.Status.Behind > 0 {
+		have = have + " (" + behind + " behind)"
+		have = have + "\n" + missing
 	} else {
-		have = have + " (" + bold(fmt.Sprintf("%d", -self.Status.Delta)) + " behind)"
-		have = have + "\n" + indent(1, "missing commits:\n"+log)
+		have = have + " (? behind)"
 	}
 
 	return fmt.Sprintf(
@@ -37,31 +50,83 @@ func (self VersionMismatch) Error() string {
 	)
 }
 
+func commitLog(commits []repository.Commit) string {
+	log := ""
+
+	for _, commit := range commits {
+		log += indent(1, commit.ShortID+" "+commit.Subject) + "\n"
+	}
+
+	return log
+}
+
+type SubmoduleMismatch struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (self SubmoduleMismatch) Error() string {
+	actual := self.Actual
+	if actual == "" {
+		actual = "missing"
+	}
+
+	return fmt.Sprintf(
+		"submodule mismatch in %s:\n%s\n%s\n",
+		bold(self.Path),
+		indent(1, "want "+red(self.Expected)),
+		indent(1, "have "+green(actual)),
+	)
+}
+
+type RemoteMismatch struct {
+	Expected string
+	Actual   string
+}
+
+func (self RemoteMismatch) Error() string {
+	return fmt.Sprintf(
+		"remote mismatch:\n%s\n%s\n",
+		indent(1, "want "+red(self.Expected)),
+		indent(1, "have "+green(self.Actual)),
+	)
+}
+
 type DirtyState struct {
-	Output string
+	Files []repository.FileStatus
 }
 
 func (self DirtyState) Error() string {
-	return fmt.Sprintf("dirty state:\n%s", indent(1, self.Output))
+	files := ""
+	for _, file := range self.Files {
+		files += fmt.Sprintf("%-10s %s\n", file.State, file.Path)
+	}
+
+	return fmt.Sprintf("dirty state:\n%s", indent(1, files))
 }
 
-func check(root string) {
+func check(root string, filter tags.Filter, nested *tags.NestedFilters) {
 	cartridge, err := set.LoadFrom(root)
 	if err != nil {
 		fatal(err)
 	}
 
-	dirty := checkDependencies(cartridge, 0)
+	dirty := checkDependencies(cartridge, filter, nested, 0)
 
 	if dirty {
 		os.Exit(1)
 	}
 }
 
-func checkDependencies(deps *set.Set, depth int) bool {
+func checkDependencies(deps *set.Set, filter tags.Filter, nested *tags.NestedFilters, depth int) bool {
 	dirty := false
 
 	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
 		err := checkForDirtyState(dep)
 		if err != nil {
 			dirty = true
@@ -79,7 +144,7 @@ func checkDependencies(deps *set.Set, depth int) bool {
 			fatal(err)
 		}
 
-		if checkDependencies(nextDeps, depth+1) {
+		if checkDependencies(nextDeps, nested.For(dep.Path), nested, depth+1) {
 			dirty = true
 		}
 	}
@@ -94,23 +159,27 @@ func checkForDirtyState(dep dependency.Dependency) error {
 		return nil
 	}
 
-	repo, err := repository.New(repoPath, command_runner.New(false))
+	repo, err := repository.New(repoPath, Runner)
 	if err != nil {
 		fatal(err)
 	}
 
-	statusOut, err := repo.Status()
+	files, err := repo.Status()
 	if err != nil {
 		fatal(err)
 	}
 
-	if len(statusOut) != 0 {
+	if len(files) != 0 {
 		return DirtyState{
-			Output: statusOut,
+			Files: files,
 		}
 	}
 
-	currentStatus := getDependencyStatus(dep)
+	currentStatus, err := getDependencyStatus(dep)
+	if err != nil {
+		fatal(err)
+	}
+
 	if currentStatus != nil {
 		if !currentStatus.VersionMatches {
 			return VersionMismatch{
@@ -120,5 +189,48 @@ func checkForDirtyState(dep dependency.Dependency) error {
 		}
 	}
 
+	if remoteRepo, ok := repo.(repository.RemoteRepository); ok && dep.Remote != "" {
+		remote, err := remoteRepo.Remote()
+		if err != nil {
+			fatal(err)
+		}
+
+		if remote != dep.Remote {
+			return RemoteMismatch{
+				Expected: dep.Remote,
+				Actual:   remote,
+			}
+		}
+	}
+
+	if submoduleRepo, ok := repo.(repository.SubmoduleRepository); ok && len(dep.Submodules) > 0 {
+		submodules, err := submoduleRepo.Submodules()
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, path := range sortedKeys(dep.Submodules) {
+			if submodules[path] != dep.Submodules[path] {
+				return SubmoduleMismatch{
+					Path:     path,
+					Expected: dep.Submodules[path],
+					Actual:   submodules[path],
+				}
+			}
+		}
+	}
+
 	return nil
 }
+
+func sortedKeys(versions map[string]string) []string {
+	keys := []string{}
+
+	for key := range versions {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -2,11 +2,15 @@ package command_runner
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type CommandRunner interface {
@@ -15,6 +19,37 @@ type CommandRunner interface {
 
 type RealCommandRunner struct {
 	debug bool
+
+	ctx context.Context
+
+	// each command is killed if it runs longer than this; zero means no limit
+	timeout time.Duration
+}
+
+// how long a killed command gets to exit after SIGTERM before it's SIGKILLed
+var KillGracePeriod = 2 * time.Second
+
+// set on every command so that VCS tools fail rather than prompt for
+// credentials or host keys
+var NonInteractiveEnv = []string{
+	"GIT_TERMINAL_PROMPT=0",
+	"GIT_SSH_COMMAND=ssh -o BatchMode=yes",
+	"HGPLAIN=1",
+	"SVN_SSH=ssh -o BatchMode=yes",
+
+	// bzr's built-in ssh client asks for passphrases itself
+	"BZR_SSH=openssh",
+
+	// for ssh run by anything else, e.g. hg under go get; with no terminal
+	// it can only prompt through an askpass program
+	"SSH_ASKPASS_REQUIRE=never",
+}
+
+// given to every command run with these tools, for prompts the environment
+// can't turn off; hg has no variable for its ssh command
+var NonInteractiveArgs = map[string][]string{
+	"hg":  {"--noninteractive", "--config", "ui.ssh=ssh -o BatchMode=yes"},
+	"svn": {"--non-interactive"},
 }
 
 type CommandFailedError struct {
@@ -33,8 +68,59 @@ func (e CommandFailedError) Error() string {
 	)
 }
 
+type CommandTimedOutError struct {
+	Timeout time.Duration
+
+	Command *exec.Cmd
+	Output  []byte
+}
+
+func (e CommandTimedOutError) Error() string {
+	return fmt.Sprintf(
+		"command timed out after %s (it may have been waiting for credentials): %s\noutput:\n%s",
+		e.Timeout,
+		prettyCommand(e.Command),
+		e.Output,
+	)
+}
+
+type CommandCanceledError struct {
+	Reason error
+
+	Command *exec.Cmd
+}
+
+func (e CommandCanceledError) Error() string {
+	reason := "interrupted"
+	if e.Reason == context.DeadlineExceeded {
+		reason = "out of time"
+	}
+
+	return fmt.Sprintf("command killed (%s): %s", reason, prettyCommand(e.Command))
+}
+
 func New(debug bool) *RealCommandRunner {
-	return &RealCommandRunner{debug}
+	return NewWithContext(context.Background(), debug, 0)
+}
+
+func NewWithContext(ctx context.Context, debug bool, timeout time.Duration) *RealCommandRunner {
+	return &RealCommandRunner{
+		debug: debug,
+
+		ctx:     ctx,
+		timeout: timeout,
+	}
+}
+
+// Detached returns a runner with the same settings that is not canceled along
+// with this one, e.g. for cleaning up after an interrupt.
+func (r *RealCommandRunner) Detached() *RealCommandRunner {
+	return NewWithContext(context.Background(), r.debug, r.timeout)
+}
+
+// Context is canceled when commands run by this runner should stop.
+func (r *RealCommandRunner) Context() context.Context {
+	return r.ctx
 }
 
 func (r *RealCommandRunner) Run(cmd *exec.Cmd) error {
@@ -47,7 +133,14 @@ func (r *RealCommandRunner) Run(cmd *exec.Cmd) error {
 
 	r.tee(cmd, output)
 
-	err := cmd.Run()
+	cmd.Env = nonInteractive(cmd.Env)
+	cmd.Args = nonInteractiveArgs(cmd.Path, cmd.Args)
+
+	// run in a new session so there is no terminal to prompt on, and so the
+	// whole process group can be killed
+	detach(cmd)
+
+	err := r.run(cmd)
 
 	if r.debug {
 		if err != nil {
@@ -57,17 +150,86 @@ func (r *RealCommandRunner) Run(cmd *exec.Cmd) error {
 		}
 	}
 
-	if err != nil {
-		return CommandFailedError{
-			OriginalError: err,
+	switch err {
+	case nil:
+		return nil
+
+	case context.DeadlineExceeded:
+		if r.ctx.Err() == nil {
+			return CommandTimedOutError{
+				Timeout: r.timeout,
+
+				Command: cmd,
+				Output:  output.Bytes(),
+			}
+		}
+
+		fallthrough
+
+	case context.Canceled:
+		return CommandCanceledError{
+			Reason: r.ctx.Err(),
 
 			Command: cmd,
-			Output:  output.Bytes(),
 		}
 	}
 
-	return nil
+	return CommandFailedError{
+		OriginalError: err,
+
+		Command: cmd,
+		Output:  output.Bytes(),
+	}
 }
+
+// run returns the context's error instead of the command's if it had to be
+// killed
+func (r *RealCommandRunner) run(cmd *exec.Cmd) error {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		return err
+
+	case <-ctx.Done():
+	}
+
+	terminate(cmd)
+
+	select {
+	case <-exited:
+	case <-time.After(KillGracePeriod):
+		kill(cmd)
+		<-exited
+	}
+
+	return ctx.Err()
+}
+
 func (r *RealCommandRunner) tee(cmd *exec.Cmd, dst io.Writer) {
 	if cmd.Stderr == nil {
 		cmd.Stderr = dst
@@ -82,6 +244,68 @@ func (r *RealCommandRunner) tee(cmd *exec.Cmd, dst io.Writer) {
 	}
 }
 
+func nonInteractive(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+
+	for _, setting := range NonInteractiveEnv {
+		name := strings.SplitN(setting, "=", 2)[0]
+
+		// respect an ssh command that's already been configured
+		if name == "GIT_SSH_COMMAND" && (isSet(env, "GIT_SSH") || isSet(env, "GIT_SSH_COMMAND")) {
+			continue
+		}
+
+		if isSet(env, name) && name != "GIT_TERMINAL_PROMPT" {
+			continue
+		}
+
+		env = append(env, setting)
+	}
+
+	return env
+}
+
+func nonInteractiveArgs(path string, args []string) []string {
+	extra, found := NonInteractiveArgs[filepath.Base(path)]
+	if !found || len(args) == 0 {
+		return args
+	}
+
+	return append(append([]string{args[0]}, extra...), args[1:]...)
+}
+
+func isSet(env []string, name string) bool {
+	for _, setting := range env {
+		if strings.HasPrefix(setting, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// only show the environment that was set for the command, not the inherited
+// or non-interactive settings
 func prettyCommand(cmd *exec.Cmd) string {
-	return fmt.Sprintf("%v %s %v", cmd.Env, cmd.Path, cmd.Args)
+	inherited := map[string]bool{}
+
+	for _, setting := range os.Environ() {
+		inherited[setting] = true
+	}
+
+	for _, setting := range NonInteractiveEnv {
+		inherited[setting] = true
+	}
+
+	env := []string{}
+
+	for _, setting := range cmd.Env {
+		if !inherited[setting] {
+			env = append(env, setting)
+		}
+	}
+
+	return fmt.Sprintf("%v %s %v", env, cmd.Path, cmd.Args)
 }
@@ -1,7 +1,13 @@
 package command_runner_test
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -37,4 +43,141 @@ var _ = Describe("Running commands", func() {
 			Expect(err.Error()).To(ContainSubstring("exit status 42"))
 		})
 	})
+
+	It("runs the command non-interactively", func() {
+		runner := command_runner.New(false)
+
+		cmd := exec.Command("env")
+
+		output := new(bytes.Buffer)
+		cmd.Stdout = output
+
+		err := runner.Run(cmd)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(output.String()).To(ContainSubstring("GIT_TERMINAL_PROMPT=0\n"))
+		Expect(output.String()).To(ContainSubstring("HGPLAIN=1\n"))
+		Expect(output.String()).To(ContainSubstring("SVN_SSH=ssh -o BatchMode=yes\n"))
+		Expect(output.String()).To(ContainSubstring("BZR_SSH=openssh\n"))
+		Expect(output.String()).To(ContainSubstring("SSH_ASKPASS_REQUIRE=never\n"))
+		Expect(output.String()).To(ContainSubstring("BatchMode=yes"))
+	})
+
+	Context("when the command is hg or svn", func() {
+		var binDir string
+
+		BeforeEach(func() {
+			var err error
+
+			binDir, err = ioutil.TempDir("", "fake-vcs")
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, tool := range []string{"hg", "svn"} {
+				err := ioutil.WriteFile(filepath.Join(binDir, tool), []byte("#!/bin/sh\necho \"$@\"\n"), 0755)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(binDir)
+		})
+
+		It("tells it not to prompt", func() {
+			runner := command_runner.New(false)
+
+			for tool, expected := range map[string]string{
+				"hg":  "--noninteractive --config ui.ssh=ssh -o BatchMode=yes pull\n",
+				"svn": "--non-interactive update\n",
+			} {
+				subcommand := "pull"
+				if tool == "svn" {
+					subcommand = "update"
+				}
+
+				cmd := exec.Command(filepath.Join(binDir, tool), subcommand)
+
+				output := new(bytes.Buffer)
+				cmd.Stdout = output
+
+				err := runner.Run(cmd)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(output.String()).To(Equal(expected))
+			}
+		})
+	})
+
+	Context("when an ssh command is already configured for git", func() {
+		It("leaves it alone", func() {
+			runner := command_runner.New(false)
+
+			cmd := exec.Command("env")
+			cmd.Env = []string{"GIT_SSH_COMMAND=ssh -i key"}
+
+			output := new(bytes.Buffer)
+			cmd.Stdout = output
+
+			err := runner.Run(cmd)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(output.String()).To(ContainSubstring("GIT_SSH_COMMAND=ssh -i key\n"))
+			Expect(output.String()).ToNot(ContainSubstring("GIT_SSH_COMMAND=ssh -o BatchMode"))
+		})
+	})
+
+	Context("when the command runs longer than the timeout", func() {
+		It("kills it and everything it started", func() {
+			runner := command_runner.NewWithContext(context.Background(), false, 100*time.Millisecond)
+
+			started := time.Now()
+
+			err := runner.Run(exec.Command("/bin/bash", "-c", "sleep 10 & sleep 10; wait"))
+			Expect(err).To(BeAssignableToTypeOf(command_runner.CommandTimedOutError{}))
+			Expect(err.Error()).To(ContainSubstring("timed out after 100ms"))
+
+			Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+		})
+	})
+
+	Context("when the context is canceled", func() {
+		It("kills the running command", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			runner := command_runner.NewWithContext(ctx, false, 0)
+
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				cancel()
+			}()
+
+			err := runner.Run(exec.Command("sleep", "10"))
+			Expect(err).To(BeAssignableToTypeOf(command_runner.CommandCanceledError{}))
+			Expect(err.Error()).To(ContainSubstring("interrupted"))
+		})
+
+		It("does not run any more commands", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			runner := command_runner.NewWithContext(ctx, false, 0)
+
+			cmd := exec.Command("ls")
+
+			err := runner.Run(cmd)
+			Expect(err).To(BeAssignableToTypeOf(command_runner.CommandCanceledError{}))
+			Expect(cmd.ProcessState).To(BeNil())
+		})
+
+		Describe("a detached runner", func() {
+			It("still runs commands", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				runner := command_runner.NewWithContext(ctx, false, 0).Detached()
+
+				err := runner.Run(exec.Command("ls"))
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+	})
 })
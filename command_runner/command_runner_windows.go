@@ -0,0 +1,13 @@
+package command_runner
+
+import "os/exec"
+
+func detach(cmd *exec.Cmd) {}
+
+func terminate(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
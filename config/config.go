@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// read from the project's root directory
+const ProjectConfigFile = ".gocart"
+
+// settings can also be given as GOCART_<NAME>, e.g. GOCART_COMMAND_TIMEOUT
+const EnvPrefix = "GOCART_"
+
+type Config struct {
+	// where the settings were read from
+	Source string
+
+	Settings []Setting
+}
+
+type Setting struct {
+	Name  string
+	Value string
+
+	Line int
+}
+
+type InvalidSettingError struct {
+	Source string
+	Line   int
+	Text   string
+}
+
+func (e InvalidSettingError) Error() string {
+	return fmt.Sprintf("%s:%d: expected 'name value', got '%s'", e.Source, e.Line, e.Text)
+}
+
+// the per-user config file, following the XDG base directory spec
+func UserConfigPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+
+	if configHome == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+
+		configHome = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configHome, "gocart", "config")
+}
+
+// $XDG_CACHE_HOME/gocart, or ~/.cache/gocart; empty if neither can be found
+func UserCacheDirectory() string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+
+	if cacheHome == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+
+		cacheHome = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(cacheHome, "gocart")
+}
+
+// reads the config file at the path; a missing file has no settings
+func Load(path string) (*Config, error) {
+	config := &Config{Source: path}
+
+	if path == "" {
+		return config, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	err = config.readFrom(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// collects the settings given in the environment for any of the names
+func FromEnv(names []string) *Config {
+	config := &Config{Source: "environment"}
+
+	for _, name := range names {
+		value := os.Getenv(EnvName(name))
+		if value == "" {
+			continue
+		}
+
+		config.Settings = append(config.Settings, Setting{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	return config
+}
+
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func (c *Config) readFrom(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		separator := strings.IndexAny(text, " \t")
+		if separator == -1 {
+			return InvalidSettingError{
+				Source: c.Source,
+				Line:   line,
+				Text:   text,
+			}
+		}
+
+		c.Settings = append(c.Settings, Setting{
+			Name:  text[:separator],
+			Value: expandHome(strings.TrimSpace(text[separator:])),
+
+			Line: line,
+		})
+	}
+
+	return scanner.Err()
+}
+
+func expandHome(value string) string {
+	if value != "~" && !strings.HasPrefix(value, "~/") {
+		return value
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		return value
+	}
+
+	return home + value[1:]
+}
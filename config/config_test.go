@@ -0,0 +1,170 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/config"
+)
+
+var _ = Describe("Config", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir("", "gocart-config")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	Describe("Load", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(tmpdir, "config")
+		})
+
+		It("reads a setting from each line, skipping comments and blank lines", func() {
+			err := ioutil.WriteFile(path, []byte("# defaults\nrecursive true\n\nexclude\tintegration,test\n  n   github.com/foo/bar=!test  \n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			cfg, err := config.Load(path)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cfg.Source).To(Equal(path))
+			Expect(cfg.Settings).To(Equal([]config.Setting{
+				{Name: "recursive", Value: "true", Line: 2},
+				{Name: "exclude", Value: "integration,test", Line: 4},
+				{Name: "n", Value: "github.com/foo/bar=!test", Line: 5},
+			}))
+		})
+
+		It("expands ~ to the home directory", func() {
+			err := ioutil.WriteFile(path, []byte("install-root ~/deps\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			cfg, err := config.Load(path)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cfg.Settings).To(Equal([]config.Setting{
+				{Name: "install-root", Value: os.Getenv("HOME") + "/deps", Line: 1},
+			}))
+		})
+
+		It("keeps every value of a repeated setting", func() {
+			err := ioutil.WriteFile(path, []byte("n a=x\nn b=y\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			cfg, err := config.Load(path)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cfg.Settings).To(Equal([]config.Setting{
+				{Name: "n", Value: "a=x", Line: 1},
+				{Name: "n", Value: "b=y", Line: 2},
+			}))
+		})
+
+		Context("when a line has no value", func() {
+			It("returns an InvalidSettingError", func() {
+				err := ioutil.WriteFile(path, []byte("recursive true\nverbose\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = config.Load(path)
+				Expect(err).To(Equal(config.InvalidSettingError{
+					Source: path,
+					Line:   2,
+					Text:   "verbose",
+				}))
+			})
+		})
+
+		Context("when the file does not exist", func() {
+			It("has no settings", func() {
+				cfg, err := config.Load(path)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(cfg.Settings).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("FromEnv", func() {
+		BeforeEach(func() {
+			os.Setenv("GOCART_COMMAND_TIMEOUT", "5m")
+			os.Setenv("GOCART_RECURSIVE", "")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("GOCART_COMMAND_TIMEOUT")
+			os.Unsetenv("GOCART_RECURSIVE")
+		})
+
+		It("collects the nonempty GOCART_ variables for the settings", func() {
+			cfg := config.FromEnv([]string{"command-timeout", "recursive", "verbose"})
+
+			Expect(cfg.Settings).To(Equal([]config.Setting{
+				{Name: "command-timeout", Value: "5m"},
+			}))
+		})
+	})
+
+	Describe("UserConfigPath", func() {
+		var home, configHome string
+
+		BeforeEach(func() {
+			home = os.Getenv("HOME")
+			configHome = os.Getenv("XDG_CONFIG_HOME")
+
+			os.Setenv("HOME", "/home/someone")
+		})
+
+		AfterEach(func() {
+			os.Setenv("HOME", home)
+			os.Setenv("XDG_CONFIG_HOME", configHome)
+		})
+
+		It("is in ~/.config", func() {
+			os.Setenv("XDG_CONFIG_HOME", "")
+			Expect(config.UserConfigPath()).To(Equal("/home/someone/.config/gocart/config"))
+		})
+
+		It("respects XDG_CONFIG_HOME", func() {
+			os.Setenv("XDG_CONFIG_HOME", "/xdg")
+			Expect(config.UserConfigPath()).To(Equal("/xdg/gocart/config"))
+		})
+	})
+
+	Describe("UserCacheDirectory", func() {
+		var home, cacheHome string
+
+		BeforeEach(func() {
+			home = os.Getenv("HOME")
+			cacheHome = os.Getenv("XDG_CACHE_HOME")
+
+			os.Setenv("HOME", "/home/someone")
+		})
+
+		AfterEach(func() {
+			os.Setenv("HOME", home)
+			os.Setenv("XDG_CACHE_HOME", cacheHome)
+		})
+
+		It("is in ~/.cache", func() {
+			os.Setenv("XDG_CACHE_HOME", "")
+			Expect(config.UserCacheDirectory()).To(Equal("/home/someone/.cache/gocart"))
+		})
+
+		It("respects XDG_CACHE_HOME", func() {
+			os.Setenv("XDG_CACHE_HOME", "/xdg")
+			Expect(config.UserCacheDirectory()).To(Equal("/xdg/gocart"))
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/vito/gocart/config"
+)
+
+// longer names for the single-letter flags, for config files and the
+// environment
+var settingAliases = map[string]string{
+	"recursive":  "r",
+	"exclude":    "x",
+	"tags":       "t",
+	"nested":     "n",
+	"submodules": "s",
+	"depth":      "d",
+}
+
+// flags that only make sense on the command line
+var unconfigurable = map[string]bool{
+	"h": true,
+	"v": true,
+}
+
+// fills in every flag not given on the command line from the environment,
+// then the project's .gocart, then the user's config file, stopping at the
+// first that sets it
+func configure(root string) {
+	explicit := map[string]bool{}
+
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	userConfig, err := config.Load(config.UserConfigPath())
+	if err != nil {
+		fatal(err)
+	}
+
+	projectConfig, err := config.Load(filepath.Join(root, config.ProjectConfigFile))
+	if err != nil {
+		fatal(err)
+	}
+
+	sources := []*config.Config{
+		config.FromEnv(settingNames()),
+		projectConfig,
+		userConfig,
+	}
+
+	values := make([]map[string][]string, len(sources))
+
+	for i, source := range sources {
+		values[i] = map[string][]string{}
+
+		for _, setting := range source.Settings {
+			flagName, found := settingFlag(setting.Name)
+			if !found {
+				fatal(fmt.Sprintf("%s:%d: unknown setting '%s'", source.Source, setting.Line, setting.Name))
+			}
+
+			values[i][flagName] = append(values[i][flagName], setting.Value)
+		}
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || unconfigurable[f.Name] {
+			return
+		}
+
+		for i, source := range sources {
+			if len(values[i][f.Name]) == 0 {
+				continue
+			}
+
+			for _, value := range values[i][f.Name] {
+				err := flag.Set(f.Name, value)
+				if err != nil {
+					fatal(fmt.Sprintf("%s: invalid value for %s: %s", source.Source, f.Name, err))
+				}
+			}
+
+			return
+		}
+	})
+}
+
+func settingFlag(name string) (string, bool) {
+	if flagName, found := settingAliases[name]; found {
+		return flagName, true
+	}
+
+	if flag.Lookup(name) == nil || unconfigurable[name] {
+		return "", false
+	}
+
+	return name, true
+}
+
+// the names settings can be given as in the environment; single letters are
+// too terse for that, so only their aliases are used
+func settingNames() []string {
+	names := []string{}
+
+	for alias := range settingAliases {
+		names = append(names, alias)
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) > 1 {
+			names = append(names, f.Name)
+		}
+	})
+
+	return names
+}
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"strings"
-
-	"github.com/vito/gocart/command_runner"
 	"github.com/vito/gocart/dependency"
 	"github.com/vito/gocart/repository"
 )
@@ -12,14 +9,25 @@ type DependencyStatus struct {
 	VersionMatches bool
 	CurrentVersion string
 
-	Delta    int
-	DeltaLog string
+	// commits since the merge base of the current and locked versions that
+	// only the current version has (ahead) or only the locked one has (behind)
+	Ahead     int
+	AheadLog  []repository.Commit
+	Behind    int
+	BehindLog []repository.Commit
+
+	// set when the history needed to compare the versions is not available
+	// locally, e.g. in a shallow clone
+	Truncated bool
+
+	// set when the versions share no history at all
+	Unrelated bool
 }
 
 func findCurrentVersion(dep dependency.Dependency) string {
 	repoPath := dep.FullPath(GOPATH)
 
-	repo, err := repository.New(repoPath, command_runner.New(false))
+	repo, err := repository.New(repoPath, Runner)
 	if err != nil {
 		return ""
 	}
@@ -32,46 +40,60 @@ func findCurrentVersion(dep dependency.Dependency) string {
 	return currentVersion
 }
 
-func getDependencyStatus(dep dependency.Dependency) *DependencyStatus {
+func getDependencyStatus(dep dependency.Dependency) (*DependencyStatus, error) {
 	repoPath := dep.FullPath(GOPATH)
 
-	repo, err := repository.New(repoPath, command_runner.New(false))
+	repo, err := repository.New(repoPath, Runner)
 	if err != nil {
-		return nil
+		return nil, nil
 	}
 
 	status := &DependencyStatus{}
 
 	status.CurrentVersion = findCurrentVersion(dep)
-	status.VersionMatches = status.CurrentVersion == dep.Version
+	status.VersionMatches, _ = repository.AtVersion(repo, dep.Version)
 
 	if status.VersionMatches {
-		return status
+		return status, nil
 	}
 
-	newer := true
-
-	logOutput, err := repo.Log(dep.Version, status.CurrentVersion)
+	base, err := repo.MergeBase(dep.Version, status.CurrentVersion)
+	if err == repository.TruncatedHistoryError {
+		status.Truncated = true
+		return status, nil
+	}
 
-	// git or hg with both refs will show empty if newer..older
-	if len(logOutput) == 0 {
-		newer = false
+	if err == repository.NoCommonAncestorError {
+		status.Unrelated = true
+		return status, nil
 	}
 
-	// either bazaar, or dep.Version is not fetched
+	// dep.Version is not fetched
 	if err != nil {
-		newer = false
+		return status, nil
 	}
 
-	if newer {
-		status.DeltaLog = logOutput
-		status.Delta = len(strings.Split(status.DeltaLog, "\n")) - 1
-	} else {
-		logOutput, _ := repo.Log(status.CurrentVersion, dep.Version)
+	ahead, err := repo.Log(base, status.CurrentVersion)
+	if err == repository.TruncatedHistoryError {
+		status.Truncated = true
+		return status, nil
+	} else if err != nil {
+		return nil, err
+	}
 
-		status.DeltaLog = logOutput
-		status.Delta = -(len(strings.Split(status.DeltaLog, "\n")) - 1)
+	behind, err := repo.Log(base, dep.Version)
+	if err == repository.TruncatedHistoryError {
+		status.Truncated = true
+		return status, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	return status
+	status.AheadLog = ahead
+	status.Ahead = len(ahead)
+
+	status.BehindLog = behind
+	status.Behind = len(behind)
+
+	return status, nil
 }
@@ -3,6 +3,7 @@ package dependency
 import (
 	"fmt"
 	"path"
+	"strings"
 )
 
 type Dependency struct {
@@ -10,6 +11,16 @@ type Dependency struct {
 	Version      string
 	Tags         []string
 	BleedingEdge bool
+
+	// versions of git submodules, keyed by their path in the repository
+	Submodules map[string]string
+
+	// where the repository was fetched from, when a rewrite rule applied
+	Remote string
+
+	// the URL of a tarball or zip to unpack instead of fetching a
+	// repository; the version is then the archive's checksum
+	Archive string
 }
 
 func (d Dependency) String() string {
@@ -19,3 +30,7 @@ func (d Dependency) String() string {
 func (d Dependency) FullPath(gopath string) string {
 	return path.Join(gopath, "src", d.Path)
 }
+
+func (d Dependency) Contains(importPath string) bool {
+	return strings.HasPrefix(importPath+"/", d.Path+"/")
+}
@@ -28,4 +28,22 @@ var _ = Describe("Dependency", func() {
 			Expect(dependency.FullPath("/tmp")).To(Equal("/tmp/src/github.com/xoebus/kingpin"))
 		})
 	})
+
+	Describe("checking if it contains an import path", func() {
+		It("contains its own path", func() {
+			Expect(dependency.Contains("github.com/xoebus/kingpin")).To(BeTrue())
+		})
+
+		It("contains packages beneath its path", func() {
+			Expect(dependency.Contains("github.com/xoebus/kingpin/parser")).To(BeTrue())
+		})
+
+		It("does not contain paths that merely share a prefix", func() {
+			Expect(dependency.Contains("github.com/xoebus/kingpinned")).To(BeFalse())
+		})
+
+		It("does not contain its parent paths", func() {
+			Expect(dependency.Contains("github.com/xoebus")).To(BeFalse())
+		})
+	})
 })
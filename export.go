@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vito/gocart/archive"
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/export"
+	"github.com/vito/gocart/fetcher"
+	"github.com/vito/gocart/gopath"
+	"github.com/vito/gocart/imports"
+	"github.com/vito/gocart/repository"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+func exportDependencies(root string, formatName string, recursive bool, filter tags.Filter, nested *tags.NestedFilters) {
+	format, err := export.Lookup(formatName)
+	if err != nil {
+		fatal(err)
+	}
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	digest, err := archive.ChecksumFile(filepath.Join(root, CartridgeFile))
+	if err != nil {
+		fatal(err)
+	}
+
+	self := modulePath(root)
+	if self == "" {
+		self, _ = gopath.ImportPath(os.Getenv("GOPATH"), root)
+	}
+
+	project := export.Project{
+		ImportPath: self,
+		GoVersion:  runtime.Version(),
+		Digest:     strings.TrimPrefix(digest, archive.ChecksumPrefix),
+	}
+
+	imported := map[string]bool{}
+
+	err = scanImports(root, self, imported)
+	if err != nil {
+		fatal(err)
+	}
+
+	err = collectExports(&project, imported, cartridge, recursive, false, filter, nested)
+	if err != nil {
+		fatal(err)
+	}
+
+	for i, dep := range project.Dependencies {
+		for importPath := range imported {
+			if !strings.HasPrefix(importPath+"/", dep.Path+"/") {
+				continue
+			}
+
+			pkg := "."
+			if importPath != dep.Path {
+				pkg = importPath[len(dep.Path)+1:]
+			}
+
+			project.Dependencies[i].Packages = append(project.Dependencies[i].Packages, pkg)
+		}
+
+		sort.Strings(project.Dependencies[i].Packages)
+	}
+
+	dest := filepath.Join(root, format.File)
+
+	existing, err := ioutil.ReadFile(dest)
+	if err == nil {
+		project.Existing = existing
+	} else if !os.IsNotExist(err) {
+		fatal(err)
+	}
+
+	content, err := format.Generate(project)
+	if err != nil {
+		fatal(err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		fatal(err)
+	}
+
+	err = ioutil.WriteFile(dest, content, 0644)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("wrote", bold(format.File))
+}
+
+// adds each dependency to the project, along with those of their own
+// Cartridges when recursive, scanning their checkouts for imports
+func collectExports(project *export.Project, imported map[string]bool, deps *set.Set, recursive bool, indirect bool, filter tags.Filter, nested *tags.NestedFilters) error {
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		if dep.Archive != "" {
+			fmt.Println(bold(dep.Path), "skipped; archive dependencies have no revision to export")
+			continue
+		}
+
+		exported, err := describeExport(dep)
+		if err != nil {
+			return fmt.Errorf("failed to export %s:\n%s", dep.Path, indent(1, err.Error()))
+		}
+
+		exported.Indirect = indirect
+
+		duplicate := false
+
+		for i, existing := range project.Dependencies {
+			if existing.Path != dep.Path {
+				continue
+			}
+
+			if existing.Version != exported.Version {
+				return fetcher.VersionConflictError{
+					Path:     dep.Path,
+					VersionA: existing.Version,
+					VersionB: exported.Version,
+				}
+			}
+
+			// required directly as well as by another dependency
+			if !indirect {
+				project.Dependencies[i].Indirect = false
+			}
+
+			duplicate = true
+		}
+
+		if duplicate {
+			continue
+		}
+
+		project.Dependencies = append(project.Dependencies, exported)
+
+		err = scanImports(dep.FullPath(GOPATH), dep.Path, imported)
+		if err != nil {
+			return err
+		}
+
+		if !recursive {
+			continue
+		}
+
+		nextDeps, err := set.LoadFrom(dep.FullPath(GOPATH))
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = collectExports(project, imported, nextDeps, true, true, nested.For(dep.Path), nested)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the dependency's resolved revision and when it was committed, read from its
+// checkout
+func describeExport(dep dependency.Dependency) (export.Dependency, error) {
+	repo, version, err := resolveInstalled(dep)
+	if err != nil {
+		return export.Dependency{}, err
+	}
+
+	describer, ok := repo.(repository.CommitRepository)
+	if !ok {
+		return export.Dependency{}, fmt.Errorf("cannot read the revisions of %s", dep.FullPath(GOPATH))
+	}
+
+	commit, err := describer.Commit(version)
+	if err != nil {
+		return export.Dependency{}, err
+	}
+
+	exported := export.Dependency{
+		Path:    dep.Path,
+		Version: version,
+		Time:    commit.Date,
+		VCS:     vcsName(repo),
+		Remote:  dep.Remote,
+		Test:    isTestDependency(dep),
+	}
+
+	// svn and bzr abbreviate revisions by their number
+	if exported.VCS == "svn" || exported.VCS == "bzr" {
+		exported.Revno, _ = strconv.Atoi(strings.TrimPrefix(commit.ShortID, "r"))
+	}
+
+	return exported, nil
+}
+
+// the checkout of the dependency and the exact version it is locked to (or,
+// for bleeding-edge dependencies, is at)
+func resolveInstalled(dep dependency.Dependency) (repository.Repository, string, error) {
+	repoPath := dep.FullPath(GOPATH)
+
+	if _, err := os.Stat(repoPath); err != nil {
+		return nil, "", fmt.Errorf("not installed in %s; run 'gocart install' first", repoPath)
+	}
+
+	repo, err := repository.New(repoPath, Runner)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var version string
+
+	if dep.BleedingEdge {
+		version, err = repo.CurrentVersion()
+	} else {
+		version, err = repo.ResolveVersion(dep.Version)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return repo, version, nil
+}
+
+func vcsName(repo repository.Repository) string {
+	switch repo.(type) {
+	case *repository.GitRepository:
+		return "git"
+	case *repository.HgRepository:
+		return "hg"
+	case *repository.BzrRepository:
+		return "bzr"
+	case *repository.SvnRepository:
+		return "svn"
+	case *repository.ArchiveRepository:
+		return "archive"
+	default:
+		return ""
+	}
+}
+
+func scanImports(dir string, self string, imported map[string]bool) error {
+	found, err := imports.Scan(dir, self)
+	if err != nil {
+		return err
+	}
+
+	for _, importPath := range found.Source {
+		imported[importPath] = true
+	}
+
+	for _, importPath := range found.Test {
+		imported[importPath] = true
+	}
+
+	return nil
+}
+
+// the module path declared by the project's go.mod, if it has one
+func modulePath(root string) string {
+	file, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+
+	return ""
+}
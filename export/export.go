@@ -0,0 +1,156 @@
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Dependency struct {
+	Path string
+
+	// the resolved revision
+	Version string
+
+	// when the revision was committed
+	Time time.Time
+
+	// "git", "hg", "bzr" or "svn"
+	VCS string
+
+	// the number of the revision, for version control systems that number
+	// them (svn and bzr)
+	Revno int
+
+	// where the repository is fetched from, when not from its import path
+	Remote string
+
+	// the imported packages, relative to the dependency ("." for its root)
+	Packages []string
+
+	// only imported by tests
+	Test bool
+
+	// only required by other dependencies
+	Indirect bool
+}
+
+type Project struct {
+	ImportPath string
+	GoVersion  string
+
+	// the checksum of the project's Cartridge, for formats that record the
+	// inputs they were resolved from
+	Digest string
+
+	Dependencies []Dependency
+
+	// the file being replaced, if any, for formats that keep parts of it
+	Existing []byte
+}
+
+type Format struct {
+	Name string
+
+	// where the file is written, relative to the project
+	File string
+
+	Generate func(Project) ([]byte, error)
+}
+
+var Formats = []Format{
+	{"godeps", filepath.Join("Godeps", "Godeps.json"), Godeps},
+	{"glide", "glide.lock", Glide},
+	{"dep", "Gopkg.lock", Dep},
+	{"gomod", "go.mod", GoMod},
+}
+
+type UnknownFormatError struct {
+	Name string
+}
+
+func (e UnknownFormatError) Error() string {
+	names := []string{}
+	for _, format := range Formats {
+		names = append(names, format.Name)
+	}
+
+	return fmt.Sprintf(
+		"unknown export format '%s'; expected one of %s",
+		e.Name,
+		strings.Join(names, ", "),
+	)
+}
+
+type MissingImportPathError struct {
+	Format string
+}
+
+func (e MissingImportPathError) Error() string {
+	return fmt.Sprintf("the %s format needs the project's import path; export from within GOPATH", e.Format)
+}
+
+type UnsupportedVCSError struct {
+	Path string
+	VCS  string
+}
+
+func (e UnsupportedVCSError) Error() string {
+	return fmt.Sprintf("cannot export '%s': no pseudo-version for %s revisions", e.Path, e.VCS)
+}
+
+func Lookup(name string) (Format, error) {
+	for _, format := range Formats {
+		if format.Name == name {
+			return format, nil
+		}
+	}
+
+	return Format{}, UnknownFormatError{name}
+}
+
+// the go module pseudo-version for a revision that has no semantic version,
+// e.g. v0.0.0-20140101000000-abcdefabcdef
+func PseudoVersion(dep Dependency) (string, error) {
+	var short string
+
+	switch dep.VCS {
+	case "git", "hg":
+		short = dep.Version
+		if len(short) > 12 {
+			short = short[:12]
+		}
+	case "svn", "bzr":
+		if dep.Revno == 0 {
+			return "", UnsupportedVCSError{dep.Path, dep.VCS}
+		}
+
+		short = fmt.Sprintf("%012d", dep.Revno)
+	default:
+		return "", UnsupportedVCSError{dep.Path, dep.VCS}
+	}
+
+	return fmt.Sprintf("v0.0.0-%s-%s", dep.Time.UTC().Format("20060102150405"), short), nil
+}
+
+type byPath []Dependency
+
+func (deps byPath) Len() int           { return len(deps) }
+func (deps byPath) Less(i, j int) bool { return deps[i].Path < deps[j].Path }
+func (deps byPath) Swap(i, j int)      { deps[i], deps[j] = deps[j], deps[i] }
+
+func sortedDependencies(project Project) []Dependency {
+	deps := append([]Dependency{}, project.Dependencies...)
+	sort.Sort(byPath(deps))
+	return deps
+}
+
+func packages(dep Dependency) []string {
+	if len(dep.Packages) == 0 {
+		return []string{"."}
+	}
+
+	return dep.Packages
+}
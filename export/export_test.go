@@ -0,0 +1,249 @@
+package export_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/export"
+)
+
+var _ = Describe("Export", func() {
+	var project export.Project
+
+	BeforeEach(func() {
+		project = export.Project{
+			ImportPath: "github.com/some/project",
+			GoVersion:  "go1.2",
+			Digest:     "abcdef",
+			Dependencies: []export.Dependency{
+				{
+					Path:     "github.com/vito/lib",
+					Version:  "0123456789abcdef0123456789abcdef01234567",
+					Time:     time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+					VCS:      "git",
+					Packages: []string{".", "sub"},
+				},
+				{
+					Path:    "code.google.com/p/hglib",
+					Version: "fedcba9876543210fedcba9876543210fedcba98",
+					Time:    time.Date(2014, 2, 1, 0, 0, 0, 0, time.FixedZone("", 3600)),
+					VCS:     "hg",
+					Remote:  "https://example.com/hglib",
+					Test:    true,
+				},
+				{
+					Path:     "example.com/svnlib",
+					Version:  "42",
+					Revno:    42,
+					Time:     time.Date(2013, 12, 31, 0, 0, 0, 0, time.UTC),
+					VCS:      "svn",
+					Indirect: true,
+				},
+			},
+		}
+	})
+
+	Describe("Lookup", func() {
+		It("returns the format with the given name", func() {
+			format, err := export.Lookup("dep")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(format.File).To(Equal("Gopkg.lock"))
+		})
+
+		It("returns UnknownFormatError for anything else", func() {
+			_, err := export.Lookup("bogus")
+			Expect(err).To(Equal(export.UnknownFormatError{"bogus"}))
+		})
+	})
+
+	Describe("PseudoVersion", func() {
+		It("uses the UTC commit time and the abbreviated revision", func() {
+			version, err := export.PseudoVersion(project.Dependencies[1])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal("v0.0.0-20140131230000-fedcba987654"))
+		})
+
+		It("pads numbered revisions", func() {
+			version, err := export.PseudoVersion(project.Dependencies[2])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal("v0.0.0-20131231000000-000000000042"))
+		})
+
+		Context("when a numbered revision has no number", func() {
+			It("returns UnsupportedVCSError", func() {
+				_, err := export.PseudoVersion(export.Dependency{Path: "x", VCS: "bzr"})
+				Expect(err).To(Equal(export.UnsupportedVCSError{"x", "bzr"}))
+			})
+		})
+	})
+
+	Describe("Godeps", func() {
+		It("lists each imported package at its revision", func() {
+			content, err := export.Godeps(project)
+			Expect(err).ToNot(HaveOccurred())
+
+			var godeps struct {
+				ImportPath string
+				GoVersion  string
+				Deps       []struct {
+					ImportPath string
+					Rev        string
+				}
+			}
+
+			err = json.Unmarshal(content, &godeps)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(godeps.ImportPath).To(Equal("github.com/some/project"))
+			Expect(godeps.GoVersion).To(Equal("go1.2"))
+
+			Expect(godeps.Deps).To(HaveLen(4))
+			Expect(godeps.Deps[0].ImportPath).To(Equal("code.google.com/p/hglib"))
+			Expect(godeps.Deps[2].ImportPath).To(Equal("github.com/vito/lib"))
+			Expect(godeps.Deps[3].ImportPath).To(Equal("github.com/vito/lib/sub"))
+			Expect(godeps.Deps[3].Rev).To(Equal("0123456789abcdef0123456789abcdef01234567"))
+		})
+
+		Context("without an import path", func() {
+			It("returns MissingImportPathError", func() {
+				project.ImportPath = ""
+
+				_, err := export.Godeps(project)
+				Expect(err).To(Equal(export.MissingImportPathError{"godeps"}))
+			})
+		})
+	})
+
+	Describe("Glide", func() {
+		It("writes imports and test imports, stamped with the newest commit", func() {
+			content, err := export.Glide(project)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(content)).To(Equal(`hash: abcdef
+updated: 2014-01-31T23:00:00Z
+imports:
+- name: example.com/svnlib
+  version: "42"
+  vcs: svn
+- name: github.com/vito/lib
+  version: 0123456789abcdef0123456789abcdef01234567
+  subpackages:
+  - sub
+testImports:
+- name: code.google.com/p/hglib
+  version: fedcba9876543210fedcba9876543210fedcba98
+  repo: https://example.com/hglib
+  vcs: hg
+`))
+		})
+	})
+
+	Describe("Dep", func() {
+		It("writes a project for each dependency", func() {
+			content, err := export.Dep(project)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(content)).To(ContainSubstring(`
+[[projects]]
+  name = "code.google.com/p/hglib"
+  packages = ["."]
+  revision = "fedcba9876543210fedcba9876543210fedcba98"
+  source = "https://example.com/hglib"
+`))
+
+			Expect(string(content)).To(ContainSubstring(`
+[[projects]]
+  name = "github.com/vito/lib"
+  packages = [".", "sub"]
+  revision = "0123456789abcdef0123456789abcdef01234567"
+`))
+
+			Expect(string(content)).To(ContainSubstring(`inputs-digest = "abcdef"`))
+		})
+	})
+
+	Describe("GoMod", func() {
+		It("requires each dependency at its pseudo-version", func() {
+			content, err := export.GoMod(project)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(content)).To(Equal(`module github.com/some/project
+
+go 1.2
+
+require (
+	code.google.com/p/hglib v0.0.0-20140131230000-fedcba987654
+	example.com/svnlib v0.0.0-20131231000000-000000000042 // indirect
+	github.com/vito/lib v0.0.0-20140102030405-0123456789ab
+)
+`))
+		})
+
+		Context("when the project already has a go.mod", func() {
+			BeforeEach(func() {
+				project.Existing = []byte(`module github.com/some/project
+
+require github.com/old/lib v1.0.0
+
+replace github.com/vito/lib => ../lib
+
+require (
+	github.com/other/lib v1.2.3
+)
+
+exclude github.com/bad/lib v0.1.0
+
+retract v0.9.0
+`)
+			})
+
+			It("replaces only the requirements and adds a go directive", func() {
+				content, err := export.GoMod(project)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(string(content)).To(Equal(`module github.com/some/project
+
+go 1.2
+
+replace github.com/vito/lib => ../lib
+
+exclude github.com/bad/lib v0.1.0
+
+retract v0.9.0
+
+require (
+	code.google.com/p/hglib v0.0.0-20140131230000-fedcba987654
+	example.com/svnlib v0.0.0-20131231000000-000000000042 // indirect
+	github.com/vito/lib v0.0.0-20140102030405-0123456789ab
+)
+`))
+			})
+
+			Context("and it has a go directive", func() {
+				BeforeEach(func() {
+					project.Existing = []byte("module github.com/some/project\n\ngo 1.21\n")
+				})
+
+				It("keeps it", func() {
+					content, err := export.GoMod(project)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(string(content)).To(ContainSubstring("\ngo 1.21\n"))
+					Expect(string(content)).ToNot(ContainSubstring("go 1.2\n"))
+				})
+			})
+		})
+
+		Context("when a dependency has no pseudo-version", func() {
+			It("returns the error", func() {
+				project.Dependencies[2].Revno = 0
+
+				_, err := export.GoMod(project)
+				Expect(err).To(Equal(export.UnsupportedVCSError{"example.com/svnlib", "svn"}))
+			})
+		})
+	})
+})
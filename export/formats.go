@@ -0,0 +1,276 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type godeps struct {
+	ImportPath string
+	GoVersion  string
+	Deps       []godepsDependency
+}
+
+type godepsDependency struct {
+	ImportPath string
+	Rev        string
+}
+
+// Godeps/Godeps.json, listing each imported package
+func Godeps(project Project) ([]byte, error) {
+	if project.ImportPath == "" {
+		return nil, MissingImportPathError{"godeps"}
+	}
+
+	out := godeps{
+		ImportPath: project.ImportPath,
+		GoVersion:  project.GoVersion,
+		Deps:       []godepsDependency{},
+	}
+
+	for _, dep := range sortedDependencies(project) {
+		for _, pkg := range packages(dep) {
+			importPath := dep.Path
+			if pkg != "." {
+				importPath += "/" + pkg
+			}
+
+			out.Deps = append(out.Deps, godepsDependency{
+				ImportPath: importPath,
+				Rev:        dep.Version,
+			})
+		}
+	}
+
+	content, err := json.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
+
+// glide.lock; it is stamped with the newest commit rather than the current
+// time, so that exporting the same set twice gives the same file
+func Glide(project Project) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	updated := time.Time{}
+	for _, dep := range project.Dependencies {
+		if dep.Time.After(updated) {
+			updated = dep.Time
+		}
+	}
+
+	fmt.Fprintf(buf, "hash: %s\n", project.Digest)
+	fmt.Fprintf(buf, "updated: %s\n", updated.UTC().Format(time.RFC3339Nano))
+
+	imports := []Dependency{}
+	testImports := []Dependency{}
+
+	for _, dep := range sortedDependencies(project) {
+		if dep.Test {
+			testImports = append(testImports, dep)
+		} else {
+			imports = append(imports, dep)
+		}
+	}
+
+	writeGlideImports(buf, "imports", imports)
+	writeGlideImports(buf, "testImports", testImports)
+
+	return buf.Bytes(), nil
+}
+
+func writeGlideImports(buf *bytes.Buffer, key string, deps []Dependency) {
+	if len(deps) == 0 {
+		fmt.Fprintf(buf, "%s: []\n", key)
+		return
+	}
+
+	fmt.Fprintf(buf, "%s:\n", key)
+
+	for _, dep := range deps {
+		fmt.Fprintf(buf, "- name: %s\n", dep.Path)
+		fmt.Fprintf(buf, "  version: %s\n", yamlString(dep.Version))
+
+		if dep.Remote != "" {
+			fmt.Fprintf(buf, "  repo: %s\n", dep.Remote)
+		}
+
+		if dep.VCS != "" && dep.VCS != "git" {
+			fmt.Fprintf(buf, "  vcs: %s\n", dep.VCS)
+		}
+
+		subpackages := []string{}
+		for _, pkg := range dep.Packages {
+			if pkg != "." {
+				subpackages = append(subpackages, pkg)
+			}
+		}
+
+		if len(subpackages) > 0 {
+			fmt.Fprintf(buf, "  subpackages:\n")
+
+			for _, pkg := range subpackages {
+				fmt.Fprintf(buf, "  - %s\n", pkg)
+			}
+		}
+	}
+}
+
+// Gopkg.lock, as written by dep
+func Dep(project Project) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "# generated by 'gocart export'; changes may be undone by the next export\n")
+
+	for _, dep := range sortedDependencies(project) {
+		quoted := []string{}
+		for _, pkg := range packages(dep) {
+			quoted = append(quoted, strconv.Quote(pkg))
+		}
+
+		fmt.Fprintf(buf, "\n[[projects]]\n")
+		fmt.Fprintf(buf, "  name = %s\n", strconv.Quote(dep.Path))
+		fmt.Fprintf(buf, "  packages = [%s]\n", strings.Join(quoted, ", "))
+		fmt.Fprintf(buf, "  revision = %s\n", strconv.Quote(dep.Version))
+
+		if dep.Remote != "" {
+			fmt.Fprintf(buf, "  source = %s\n", strconv.Quote(dep.Remote))
+		}
+	}
+
+	fmt.Fprintf(buf, "\n[solve-meta]\n")
+	fmt.Fprintf(buf, "  analyzer-name = \"gocart\"\n")
+	fmt.Fprintf(buf, "  analyzer-version = 1\n")
+	fmt.Fprintf(buf, "  inputs-digest = %s\n", strconv.Quote(project.Digest))
+	fmt.Fprintf(buf, "  solver-name = \"gocart\"\n")
+	fmt.Fprintf(buf, "  solver-version = 1\n")
+
+	return buf.Bytes(), nil
+}
+
+// go.mod, requiring each dependency at its pseudo-version; dependencies only
+// required by other dependencies are marked indirect
+func GoMod(project Project) ([]byte, error) {
+	if project.ImportPath == "" {
+		return nil, MissingImportPathError{"gomod"}
+	}
+
+	require := new(bytes.Buffer)
+
+	deps := sortedDependencies(project)
+	if len(deps) > 0 {
+		fmt.Fprintf(require, "require (\n")
+
+		for _, dep := range deps {
+			version, err := PseudoVersion(dep)
+			if err != nil {
+				return nil, err
+			}
+
+			line := "\t" + dep.Path + " " + version
+			if dep.Indirect {
+				line += " // indirect"
+			}
+
+			fmt.Fprintf(require, "%s\n", line)
+		}
+
+		fmt.Fprintf(require, ")\n")
+	}
+
+	buf := new(bytes.Buffer)
+
+	if len(project.Existing) > 0 {
+		buf.Write(withoutRequirements(project.Existing, goDirective(project.GoVersion)))
+	} else {
+		fmt.Fprintf(buf, "module %s\n", project.ImportPath)
+
+		if directive := goDirective(project.GoVersion); directive != "" {
+			fmt.Fprintf(buf, "\n%s\n", directive)
+		}
+	}
+
+	if require.Len() > 0 {
+		fmt.Fprintf(buf, "\n")
+		buf.Write(require.Bytes())
+	}
+
+	return buf.Bytes(), nil
+}
+
+var goVersionPattern = regexp.MustCompile(`^go(\d+\.\d+)`)
+
+// e.g. 'go 1.2' for go1.2.1; nothing for development versions
+func goDirective(goVersion string) string {
+	match := goVersionPattern.FindStringSubmatch(goVersion)
+	if match == nil {
+		return ""
+	}
+
+	return "go " + match[1]
+}
+
+// the go.mod with its require directives removed, keeping everything else
+// (e.g. replace and exclude directives), and with a go directive added after
+// the module line if it has none
+func withoutRequirements(goMod []byte, directive string) []byte {
+	lines := strings.Split(strings.TrimRight(string(goMod), "\n"), "\n")
+
+	hasGoDirective := false
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "go" {
+			hasGoDirective = true
+		}
+	}
+
+	kept := []string{}
+	inRequire := false
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if inRequire {
+			if len(fields) > 0 && fields[0] == ")" {
+				inRequire = false
+			}
+
+			continue
+		}
+
+		if len(fields) > 0 && fields[0] == "require" {
+			inRequire = len(fields) > 1 && fields[1] == "("
+			continue
+		}
+
+		// don't leave the gap where a block was
+		if len(fields) == 0 && len(kept) > 0 && kept[len(kept)-1] == "" {
+			continue
+		}
+
+		kept = append(kept, line)
+
+		if len(fields) > 0 && fields[0] == "module" && !hasGoDirective && directive != "" {
+			kept = append(kept, "", directive)
+		}
+	}
+
+	return []byte(strings.TrimRight(strings.Join(kept, "\n"), "\n") + "\n")
+}
+
+// quotes strings that yaml would otherwise read as numbers, e.g. svn
+// revisions
+func yamlString(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
@@ -1,21 +1,68 @@
 package fetcher
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/vito/gocart/archive"
 	"github.com/vito/gocart/command_runner"
 	"github.com/vito/gocart/dependency"
 	"github.com/vito/gocart/gopath"
 	"github.com/vito/gocart/repository"
+	"github.com/vito/gocart/retry"
+	"github.com/vito/gocart/rewrite"
 )
 
+// where shallow clones come from for paths without a rewrite rule; anything
+// else is left to go get
+var knownRemotes = rewrite.Rules{
+	{Prefix: "github.com/*/*", Template: "https://github.com/{1}/{2}"},
+}
+
 type Fetcher struct {
+	// when nonzero, git dependencies that are not yet present are cloned with
+	// only this many commits of history, if their remote is known from
+	// knownRemotes or Rewrites
+	Depth int
+
+	// when set, existing checkouts are updated and checked out even if they
+	// have local changes
+	Force bool
+
+	// how network operations (go get, clones and updates) are retried when
+	// they fail because of the network
+	Retry retry.Policy
+
+	// where to fetch repositories from instead of letting go get decide
+	Rewrites rewrite.Rules
+
+	// when set, retries and rewritten remotes are logged
+	Verbose bool
+
+	// where downloaded archives are kept, named by their checksum, so that
+	// they are only downloaded once; when empty they are discarded
+	Cache string
+
 	runner command_runner.CommandRunner
 	gopath string
 
 	fetchedDependencies map[string]dependency.Dependency
+
+	// the versions existing checkouts were at before they were first
+	// fetched, so that they can be restored
+	priorVersions []priorVersion
+}
+
+type priorVersion struct {
+	repoPath   string
+	dependency dependency.Dependency
 }
 
 type VersionConflictError struct {
@@ -29,6 +76,26 @@ func (e VersionConflictError) Error() string {
 	return fmt.Sprintf("version conflict for %s: %s and %s", e.Path, e.VersionA, e.VersionB)
 }
 
+type DirtyRepositoryError struct {
+	Path  string
+	Files []repository.FileStatus
+}
+
+func (e DirtyRepositoryError) Error() string {
+	return fmt.Sprintf("refusing to check out a new version of %s; it has %d locally changed files", e.Path, len(e.Files))
+}
+
+// a command that timed out or was interrupted while fetching a dependency;
+// the command's own error only names the command line
+type CommandKilledError struct {
+	Path string
+	Err  error
+}
+
+func (e CommandKilledError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
 func New(runner command_runner.CommandRunner) (*Fetcher, error) {
 	gopath, err := gopath.InstallationDirectory(os.Getenv("GOPATH"))
 	if err != nil {
@@ -44,13 +111,38 @@ func New(runner command_runner.CommandRunner) (*Fetcher, error) {
 }
 
 func (f *Fetcher) Fetch(dep dependency.Dependency) (dependency.Dependency, error) {
-	var goGet *exec.Cmd
+	fetched, err := f.fetch(dep)
+	if err != nil {
+		return dependency.Dependency{}, nameKilledCommand(dep, err)
+	}
+
+	return fetched, nil
+}
+
+func (f *Fetcher) fetch(dep dependency.Dependency) (dependency.Dependency, error) {
+	var goGetArgs []string
 
 	repoPath := dep.FullPath(f.gopath)
 
 	lockDown := true
 	updateRepo := false
 
+	err := f.recordPriorVersion(dep)
+	if err != nil {
+		return dependency.Dependency{}, err
+	}
+
+	if dep.Archive != "" {
+		err := f.fetchArchive(dep)
+		if err != nil {
+			return dependency.Dependency{}, err
+		}
+
+		dep.Remote = ""
+
+		return f.checkForConflict(dep)
+	}
+
 	if dep.BleedingEdge {
 		// update the repo only if bleeding-edge and repo is clean
 		if _, err := os.Stat(repoPath); err == nil {
@@ -61,24 +153,42 @@ func (f *Fetcher) Fetch(dep dependency.Dependency) (dependency.Dependency, error
 				return dependency.Dependency{}, err
 			}
 
-			statusOut, err := repo.Status()
+			files, err := repo.Status()
 			if err != nil {
 				return dependency.Dependency{}, err
 			}
 
-			if len(statusOut) == 0 {
+			if len(files) == 0 {
 				updateRepo = true
 			}
 		}
 	}
 
+	remote, rewritten := f.Rewrites.Resolve(dep.Path)
+	if rewritten {
+		err := f.useRemote(dep, remote)
+		if err != nil {
+			return dependency.Dependency{}, err
+		}
+	} else if f.Depth > 0 {
+		remote, found := knownRemotes.Resolve(dep.Path)
+		if found {
+			err := f.clone(dep, remote)
+			if err != nil {
+				return dependency.Dependency{}, err
+			}
+		}
+	}
+
 	if updateRepo {
-		goGet = exec.Command("go", "get", "-u", "-d", "-v", dep.Path)
+		goGetArgs = []string{"get", "-u", "-d", "-v", dep.Path}
 	} else {
-		goGet = exec.Command("go", "get", "-d", "-v", dep.Path)
+		goGetArgs = []string{"get", "-d", "-v", dep.Path}
 	}
 
-	err := f.runner.Run(goGet)
+	err = f.retry(dep, func() error {
+		return f.runner.Run(exec.Command("go", goGetArgs...))
+	})
 	if err != nil {
 		return dependency.Dependency{}, err
 	}
@@ -89,7 +199,7 @@ func (f *Fetcher) Fetch(dep dependency.Dependency) (dependency.Dependency, error
 	}
 
 	if lockDown {
-		err := f.syncRepo(repo, dep.Version)
+		err := f.syncRepo(repo, dep)
 		if err != nil {
 			return dependency.Dependency{}, err
 		}
@@ -102,6 +212,25 @@ func (f *Fetcher) Fetch(dep dependency.Dependency) (dependency.Dependency, error
 
 	dep.Version = currentVersion
 
+	if rewritten {
+		dep.Remote = remote.URL
+	} else {
+		dep.Remote = ""
+	}
+
+	if submoduleRepo, ok := repo.(repository.SubmoduleRepository); ok {
+		dep.Submodules, err = submoduleRepo.Submodules()
+		if err != nil {
+			return dependency.Dependency{}, err
+		}
+	}
+
+	return f.checkForConflict(dep)
+}
+
+// records the fetched version of the dependency, failing if another version
+// of it was already fetched
+func (f *Fetcher) checkForConflict(dep dependency.Dependency) (dependency.Dependency, error) {
 	fetched, found := f.fetchedDependencies[dep.Path]
 	if found {
 		if fetched.Version != dep.Version {
@@ -118,21 +247,368 @@ func (f *Fetcher) Fetch(dep dependency.Dependency) (dependency.Dependency, error
 	return dep, nil
 }
 
-func (f *Fetcher) syncRepo(repo repository.Repository, version string) error {
+// checks out every existing repository modified by Fetch at the version it
+// was at beforehand, returning the dependencies that were restored
+//
+// the runner is given separately so that rolling back still works after the
+// fetcher's own runner has been interrupted
+func (f *Fetcher) Rollback(runner command_runner.CommandRunner) ([]dependency.Dependency, error) {
+	restored := []dependency.Dependency{}
+
+	var rollbackErr error
+
+	for i := len(f.priorVersions) - 1; i >= 0; i-- {
+		prior := f.priorVersions[i]
+
+		repo, err := repository.New(prior.repoPath, runner)
+		if err != nil {
+			rollbackErr = err
+			continue
+		}
+
+		atVersion, err := repository.AtVersion(repo, prior.dependency.Version)
+		if err == nil && atVersion {
+			continue
+		}
+
+		if prior.dependency.Archive != "" {
+			// archives have no history to check out; unpack the old one again
+			err = f.unpackArchive(runnerContext(runner), prior.dependency)
+		} else {
+			err = repo.Checkout(prior.dependency.Version)
+		}
+
+		if err != nil {
+			rollbackErr = nameKilledCommand(prior.dependency, err)
+			continue
+		}
+
+		restored = append(restored, prior.dependency)
+	}
+
+	f.priorVersions = nil
+
+	return restored, rollbackErr
+}
+
+func (f *Fetcher) recordPriorVersion(dep dependency.Dependency) error {
+	repoPath := dep.FullPath(f.gopath)
+
+	if _, err := os.Stat(repoPath); err != nil {
+		// nothing to restore
+		return nil
+	}
+
+	for _, prior := range f.priorVersions {
+		if prior.repoPath == repoPath {
+			return nil
+		}
+	}
+
+	repo, err := repository.New(repoPath, f.runner)
+	if err != nil {
+		return err
+	}
+
 	currentVersion, err := repo.CurrentVersion()
 	if err != nil {
 		return err
 	}
 
-	if currentVersion == version {
+	dep.Version = currentVersion
+
+	if _, ok := repo.(*repository.ArchiveRepository); ok {
+		manifest, err := archive.ReadManifest(repoPath)
+		if err != nil {
+			return err
+		}
+
+		dep.Archive = manifest.URL
+	} else {
+		dep.Archive = ""
+	}
+
+	f.priorVersions = append(f.priorVersions, priorVersion{
+		repoPath:   repoPath,
+		dependency: dep,
+	})
+
+	return nil
+}
+
+// brings an already-fetched dependency back to its version
+func (f *Fetcher) Sync(dep dependency.Dependency) error {
+	return nameKilledCommand(dep, f.sync(dep))
+}
+
+func (f *Fetcher) sync(dep dependency.Dependency) error {
+	if dep.Archive != "" {
+		return f.fetchArchive(dep)
+	}
+
+	if remote, rewritten := f.Rewrites.Resolve(dep.Path); rewritten {
+		err := f.useRemote(dep, remote)
+		if err != nil {
+			return err
+		}
+	}
+
+	repo, err := repository.New(dep.FullPath(f.gopath), f.runner)
+	if err != nil {
+		return err
+	}
+
+	return f.syncRepo(repo, dep)
+}
+
+func nameKilledCommand(dep dependency.Dependency, err error) error {
+	switch err.(type) {
+	case command_runner.CommandTimedOutError, command_runner.CommandCanceledError:
+		return CommandKilledError{Path: dep.Path, Err: err}
+	}
+
+	return err
+}
+
+func (f *Fetcher) syncRepo(repo repository.Repository, dep dependency.Dependency) error {
+	atVersion, err := repository.AtVersion(repo, dep.Version)
+	if err != nil {
+		return err
+	}
+
+	if atVersion {
 		// already up-to-date
 		return nil
 	}
 
-	err = repo.Update()
+	if !f.Force {
+		files, err := repo.Status()
+		if err != nil {
+			return err
+		}
+
+		if len(files) != 0 {
+			return DirtyRepositoryError{
+				Path:  dep.Path,
+				Files: files,
+			}
+		}
+	}
+
+	err = f.retry(dep, repo.Update)
+	if err != nil {
+		return err
+	}
+
+	// checking out may fetch a version missing from a shallow clone
+	return f.retry(dep, func() error {
+		return repo.Checkout(dep.Version)
+	})
+}
+
+func (f *Fetcher) retry(dep dependency.Dependency, operation func() error) error {
+	return f.Retry.Run(f.context(), operation, func(reason string, retry int, delay time.Duration) {
+		if f.Verbose {
+			log.Printf(
+				"\x1b[40;33m%s: retrying in %s (%d of %d): %s\x1b[0m\n",
+				dep.Path,
+				delay,
+				retry,
+				f.Retry.Retries,
+				reason,
+			)
+		}
+	})
+}
+
+// the runner's context, so that waiting to retry and downloads stop on an
+// interrupt
+func (f *Fetcher) context() context.Context {
+	return runnerContext(f.runner)
+}
+
+func runnerContext(runner command_runner.CommandRunner) context.Context {
+	if runner, ok := runner.(interface {
+		Context() context.Context
+	}); ok && runner.Context() != nil {
+		return runner.Context()
+	}
+
+	return context.Background()
+}
+
+// clones the repository from the rewritten remote, or points an existing
+// clone at it, so that go get and updates fetch from there
+func (f *Fetcher) useRemote(dep dependency.Dependency, remote rewrite.Remote) error {
+	if f.Verbose {
+		log.Printf("\x1b[40;36m%s: using %s\x1b[0m\n", dep.Path, remote.URL)
+	}
+
+	rootPath := filepath.Join(f.gopath, "src", remote.Root)
+
+	if _, err := os.Stat(rootPath); err != nil {
+		return f.clone(dep, remote)
+	}
+
+	repo, err := repository.New(rootPath, f.runner)
+	if err != nil {
+		return err
+	}
+
+	remoteRepo, ok := repo.(repository.RemoteRepository)
+	if !ok {
+		return fmt.Errorf("cannot change where %s is fetched from", dep.Path)
+	}
+
+	currentURL, err := remoteRepo.Remote()
+	if err == nil && currentURL == remote.URL {
+		return nil
+	}
+
+	return remoteRepo.SetRemote(remote.URL)
+}
+
+// clones the dependency's repository if it is not already present, with
+// limited history if a depth is given; go get will then find it in place
+func (f *Fetcher) clone(dep dependency.Dependency, remote rewrite.Remote) error {
+	rootPath := filepath.Join(f.gopath, "src", remote.Root)
+
+	if _, err := os.Stat(rootPath); err == nil {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(rootPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	return f.retry(dep, func() error {
+		// a failed clone leaves nothing worth keeping
+		os.RemoveAll(rootPath)
+
+		var clone *exec.Cmd
+
+		switch remote.VCS {
+		case "hg":
+			clone = exec.Command("hg", "clone", remote.URL, rootPath)
+		case "bzr":
+			clone = exec.Command("bzr", "branch", remote.URL, rootPath)
+		default:
+			if f.Depth > 0 {
+				clone = exec.Command(
+					"git", "clone",
+					"--depth", strconv.Itoa(f.Depth),
+					"--no-single-branch",
+					remote.URL,
+					rootPath,
+				)
+			} else {
+				clone = exec.Command("git", "clone", remote.URL, rootPath)
+			}
+		}
+
+		return f.runner.Run(clone)
+	})
+}
+
+// unpacks the dependency's archive in place of whatever is at its path,
+// unless it is already unpacked there
+func (f *Fetcher) fetchArchive(dep dependency.Dependency) error {
+	repoPath := dep.FullPath(f.gopath)
+
+	if _, err := os.Stat(repoPath); err == nil {
+		repo, err := repository.New(repoPath, f.runner)
+		if err != nil {
+			return err
+		}
+
+		atVersion, err := repository.AtVersion(repo, dep.Version)
+		if err == nil && atVersion {
+			// already up-to-date
+			return nil
+		}
+
+		if !f.Force {
+			files, err := repo.Status()
+			if err != nil {
+				return err
+			}
+
+			if len(files) != 0 {
+				return DirtyRepositoryError{
+					Path:  dep.Path,
+					Files: files,
+				}
+			}
+		}
+	}
+
+	return f.unpackArchive(f.context(), dep)
+}
+
+// downloads and verifies the archive, unpacks it next to the dependency's
+// path, and then swaps it into place
+func (f *Fetcher) unpackArchive(ctx context.Context, dep dependency.Dependency) error {
+	repoPath := dep.FullPath(f.gopath)
+
+	cache := f.Cache
+	if cache == "" {
+		tmpdir, err := ioutil.TempDir("", "gocart-archive")
+		if err != nil {
+			return err
+		}
+
+		defer os.RemoveAll(tmpdir)
+
+		cache = tmpdir
+	}
+
+	if f.Verbose {
+		log.Printf("\x1b[40;36m%s: downloading %s\x1b[0m\n", dep.Path, dep.Archive)
+	}
+
+	var archivePath string
+
+	err := f.retry(dep, func() error {
+		var err error
+		archivePath, err = archive.Download(ctx, dep.Archive, dep.Version, cache)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(repoPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	unpacked, err := ioutil.TempDir(filepath.Dir(repoPath), "."+filepath.Base(repoPath))
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(unpacked)
+
+	err = os.Chmod(unpacked, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = archive.Unpack(archivePath, dep.Archive, unpacked)
+	if err != nil {
+		return err
+	}
+
+	err = archive.WriteManifest(unpacked, dep.Version, dep.Archive)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(repoPath)
 	if err != nil {
 		return err
 	}
 
-	return repo.Checkout(version)
+	return os.Rename(unpacked, repoPath)
 }
@@ -1,19 +1,62 @@
 package fetcher_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/vito/gocart/archive"
+	"github.com/vito/gocart/command_runner"
 	"github.com/vito/gocart/command_runner/fake_command_runner"
 	. "github.com/vito/gocart/command_runner/fake_command_runner/matchers"
 	dependency_package "github.com/vito/gocart/dependency"
 	. "github.com/vito/gocart/fetcher"
 	"github.com/vito/gocart/gopath"
+	"github.com/vito/gocart/retry"
+	"github.com/vito/gocart/rewrite"
 )
 
+func tarball(name string, contents string) []byte {
+	buf := new(bytes.Buffer)
+
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(contents)),
+		Typeflag: tar.TypeReg,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	_, err = tw.Write([]byte(contents))
+	Expect(err).ToNot(HaveOccurred())
+
+	Expect(tw.Close()).ToNot(HaveOccurred())
+	Expect(gz.Close()).ToNot(HaveOccurred())
+
+	return buf.Bytes()
+}
+
+func checksum(contents []byte) string {
+	sum, err := archive.Checksum(bytes.NewReader(contents))
+	Expect(err).ToNot(HaveOccurred())
+
+	return sum
+}
+
 var _ = Describe("Fetcher", func() {
 	var dependency dependency_package.Dependency
 	var fetcher *Fetcher
@@ -104,6 +147,119 @@ var _ = Describe("Fetcher", func() {
 			})
 		})
 
+		Context("when the repo is on another version and has local changes", func() {
+			BeforeEach(func() {
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "HEAD"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("some-sha\n"))
+					return nil
+				})
+
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"status", "--porcelain"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(" M care\n"))
+					return nil
+				})
+			})
+
+			It("returns a DirtyRepositoryError without updating it", func() {
+				_, err := fetcher.Fetch(dependency)
+				Ω(err).Should(BeAssignableToTypeOf(DirtyRepositoryError{}))
+				Ω(err.(DirtyRepositoryError).Path).Should(Equal(dependency.Path))
+
+				Ω(runner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"fetch"},
+					},
+				))
+
+				Ω(runner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"checkout", "v1.2"},
+					},
+				))
+			})
+
+			Context("when forced", func() {
+				BeforeEach(func() {
+					fetcher.Force = true
+				})
+
+				It("updates and checks it out anyway", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Ω(runner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"fetch"},
+						},
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"checkout", "v1.2"},
+						},
+					))
+				})
+			})
+		})
+
+		Context("when the repo is at a locked version given in a shorter form and has local changes", func() {
+			BeforeEach(func() {
+				dependency.Version = "0123456"
+
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "HEAD"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("0123456789abcdef0123456789abcdef01234567\n"))
+					return nil
+				})
+
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "--verify", "0123456^{commit}"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("0123456789abcdef0123456789abcdef01234567\n"))
+					return nil
+				})
+
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"status", "--porcelain"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(" M care\n"))
+					return nil
+				})
+			})
+
+			It("leaves it alone, locking the full version", func() {
+				dep, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Ω(dep.Version).Should(Equal("0123456789abcdef0123456789abcdef01234567"))
+
+				Ω(runner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"fetch"},
+					},
+				))
+
+				Ω(runner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"checkout", "0123456"},
+					},
+				))
+			})
+		})
+
 		Context("when the dependency is bleeding-edge", func() {
 			Context("and the repository exists", func() {
 				BeforeEach(func() {
@@ -157,10 +313,10 @@ var _ = Describe("Fetcher", func() {
 							Path: exec.Command("git").Path,
 							Args: []string{"status", "--porcelain"},
 						}, func(cmd *exec.Cmd) error {
-							cmd.Stdout.Write([]byte("A taking\n"))
-							cmd.Stdout.Write([]byte("M care\n"))
-							cmd.Stdout.Write([]byte("D of\n"))
-							cmd.Stdout.Write([]byte("T business\n"))
+							cmd.Stdout.Write([]byte("A  taking\n"))
+							cmd.Stdout.Write([]byte(" M care\n"))
+							cmd.Stdout.Write([]byte(" D of\n"))
+							cmd.Stdout.Write([]byte(" T business\n"))
 							return nil
 						})
 					})
@@ -242,6 +398,516 @@ var _ = Describe("Fetcher", func() {
 			})
 		})
 
+		Context("with a depth", func() {
+			var gopathDir string
+
+			BeforeEach(func() {
+				gopathDir, _ = gopath.InstallationDirectory(os.Getenv("GOPATH"))
+
+				dependency = dependency_package.Dependency{
+					Path:    "github.com/vito/gocart-shallow/some/package",
+					Version: "v1.2",
+				}
+
+				fetcher.Depth = 1
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(filepath.Join(gopathDir, "src", "github.com", "vito", "gocart-shallow"))
+			})
+
+			It("shallowly clones the repository before go getting", func() {
+				_, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Ω(runner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{
+							"clone", "--depth", "1", "--no-single-branch",
+							"https://github.com/vito/gocart-shallow",
+							filepath.Join(gopathDir, "src", "github.com", "vito", "gocart-shallow"),
+						},
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("go").Path,
+						Args: []string{"get", "-d", "-v", dependency.Path},
+					},
+				))
+			})
+
+			Context("when the repository already exists", func() {
+				BeforeEach(func() {
+					err := os.MkdirAll(dependency.FullPath(gopathDir), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("does not clone it", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Ω(runner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{
+								"clone", "--depth", "1", "--no-single-branch",
+								"https://github.com/vito/gocart-shallow",
+								filepath.Join(gopathDir, "src", "github.com", "vito", "gocart-shallow"),
+							},
+						},
+					))
+				})
+			})
+
+			Context("when the clone URL cannot be determined from the path", func() {
+				BeforeEach(func() {
+					dependency.Path = "code.google.com/p/go.crypto/ssh"
+				})
+
+				It("leaves fetching to go get", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					for _, cmd := range runner.ExecutedCommands() {
+						Ω(cmd.Args).ShouldNot(ContainElement("clone"))
+					}
+				})
+			})
+		})
+
+		Context("with a rewrite rule for the path", func() {
+			var gopathDir string
+			var rootPath string
+
+			BeforeEach(func() {
+				gopathDir, _ = gopath.InstallationDirectory(os.Getenv("GOPATH"))
+
+				dependency = dependency_package.Dependency{
+					Path:    "github.com/ourco/lib/some/package",
+					Version: "v1.2",
+				}
+
+				rootPath = filepath.Join(gopathDir, "src", "github.com", "ourco", "lib")
+
+				fetcher.Rewrites = rewrite.Rules{
+					{Prefix: "github.com/ourco/*", Template: "ssh://git@git.ourco.com/{1}.git"},
+				}
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(filepath.Join(gopathDir, "src", "github.com", "ourco"))
+			})
+
+			It("clones the repository from the rewritten url before go getting", func() {
+				_, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Ω(runner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"clone", "ssh://git@git.ourco.com/lib.git", rootPath},
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("go").Path,
+						Args: []string{"get", "-d", "-v", dependency.Path},
+					},
+				))
+			})
+
+			It("records the url in the fetched dependency", func() {
+				dep, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Ω(dep.Remote).Should(Equal("ssh://git@git.ourco.com/lib.git"))
+			})
+
+			Context("with a depth", func() {
+				BeforeEach(func() {
+					fetcher.Depth = 1
+				})
+
+				It("clones shallowly", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Ω(runner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{
+								"clone", "--depth", "1", "--no-single-branch",
+								"ssh://git@git.ourco.com/lib.git",
+								rootPath,
+							},
+						},
+					))
+				})
+			})
+
+			Context("when the url is for another VCS", func() {
+				BeforeEach(func() {
+					fetcher.Rewrites = rewrite.Rules{
+						{Prefix: "github.com/ourco/*", Template: "hg+https://hg.ourco.com/{1}"},
+					}
+				})
+
+				It("clones it with that VCS", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Ω(runner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("hg").Path,
+							Args: []string{"clone", "https://hg.ourco.com/lib", rootPath},
+						},
+					))
+				})
+			})
+
+			Context("when the repository already exists", func() {
+				BeforeEach(func() {
+					err := os.MkdirAll(filepath.Join(rootPath, ".git"), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					runner.WhenRunning(fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"config", "--get", "remote.origin.url"},
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte("https://github.com/ourco/lib\n"))
+						return nil
+					})
+				})
+
+				It("points it at the rewritten url before updating", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Ω(runner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"remote", "set-url", "origin", "ssh://git@git.ourco.com/lib.git"},
+							Dir:  rootPath,
+						},
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("go").Path,
+							Args: []string{"get", "-d", "-v", dependency.Path},
+						},
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"fetch"},
+						},
+					))
+
+					for _, cmd := range runner.ExecutedCommands() {
+						Ω(cmd.Args).ShouldNot(ContainElement("clone"))
+					}
+				})
+			})
+		})
+
+		Context("when the dependency is an archive", func() {
+			var gopathDir string
+			var originalGopath string
+
+			var server *httptest.Server
+			var requests int
+
+			var v1, v2 []byte
+
+			BeforeEach(func() {
+				var err error
+
+				gopathDir, err = ioutil.TempDir("", "fetcher-gopath")
+				Expect(err).ToNot(HaveOccurred())
+
+				originalGopath = os.Getenv("GOPATH")
+				os.Setenv("GOPATH", gopathDir)
+
+				fetcher, err = New(runner)
+				Expect(err).ToNot(HaveOccurred())
+
+				v1 = tarball("lib-1.0/lib.go", "package lib // 1.0\n")
+				v2 = tarball("lib-2.0/lib.go", "package lib // 2.0\n")
+
+				requests = 0
+
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requests++
+
+					switch r.URL.Path {
+					case "/lib-1.0.tar.gz":
+						w.Write(v1)
+					case "/lib-2.0.tar.gz":
+						w.Write(v2)
+					default:
+						w.WriteHeader(http.StatusNotFound)
+					}
+				}))
+
+				dependency = dependency_package.Dependency{
+					Path:    "example.com/lib",
+					Version: checksum(v1),
+					Archive: server.URL + "/lib-1.0.tar.gz",
+				}
+			})
+
+			AfterEach(func() {
+				server.Close()
+
+				os.Setenv("GOPATH", originalGopath)
+				os.RemoveAll(gopathDir)
+			})
+
+			libSource := func() string {
+				contents, err := ioutil.ReadFile(filepath.Join(gopathDir, "src", "example.com", "lib", "lib.go"))
+				Expect(err).ToNot(HaveOccurred())
+
+				return string(contents)
+			}
+
+			It("downloads, verifies and unpacks it instead of go getting it", func() {
+				dep, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(dep.Version).To(Equal(checksum(v1)))
+				Expect(dep.Archive).To(Equal(server.URL + "/lib-1.0.tar.gz"))
+
+				Expect(libSource()).To(Equal("package lib // 1.0\n"))
+
+				Ω(runner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("go").Path,
+					},
+				))
+			})
+
+			It("does not download it again when it is already unpacked", func() {
+				_, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				fetcher, err = New(runner)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(requests).To(Equal(1))
+			})
+
+			Context("when the checksum does not match", func() {
+				BeforeEach(func() {
+					dependency.Version = checksum(v2)
+				})
+
+				It("returns an error and unpacks nothing", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).To(BeAssignableToTypeOf(archive.ChecksumMismatchError{}))
+
+					_, err = os.Stat(filepath.Join(gopathDir, "src", "example.com", "lib"))
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+			})
+
+			Context("when another version is unpacked", func() {
+				BeforeEach(func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					fetcher, err = New(runner)
+					Expect(err).ToNot(HaveOccurred())
+
+					dependency.Version = checksum(v2)
+					dependency.Archive = server.URL + "/lib-2.0.tar.gz"
+				})
+
+				It("replaces it", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(libSource()).To(Equal("package lib // 2.0\n"))
+				})
+
+				It("can roll back to it", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					restored, err := fetcher.Rollback(runner)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(restored).To(HaveLen(1))
+					Expect(restored[0].Version).To(Equal(checksum(v1)))
+
+					Expect(libSource()).To(Equal("package lib // 1.0\n"))
+				})
+
+				Context("and it has local changes", func() {
+					BeforeEach(func() {
+						err := ioutil.WriteFile(filepath.Join(gopathDir, "src", "example.com", "lib", "lib.go"), []byte("package changed\n"), 0644)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					It("returns a DirtyRepositoryError without replacing it", func() {
+						_, err := fetcher.Fetch(dependency)
+						Expect(err).To(BeAssignableToTypeOf(DirtyRepositoryError{}))
+
+						Expect(libSource()).To(Equal("package changed\n"))
+					})
+
+					Context("when forced", func() {
+						BeforeEach(func() {
+							fetcher.Force = true
+						})
+
+						It("replaces it anyway", func() {
+							_, err := fetcher.Fetch(dependency)
+							Expect(err).ToNot(HaveOccurred())
+
+							Expect(libSource()).To(Equal("package lib // 2.0\n"))
+						})
+					})
+				})
+			})
+
+			Context("with a cache", func() {
+				BeforeEach(func() {
+					fetcher.Cache = filepath.Join(gopathDir, "cache")
+				})
+
+				It("keeps the download for the next time it is unpacked", func() {
+					_, err := fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					err = os.RemoveAll(filepath.Join(gopathDir, "src"))
+					Expect(err).ToNot(HaveOccurred())
+
+					fetcher, err = New(runner)
+					Expect(err).ToNot(HaveOccurred())
+
+					fetcher.Cache = filepath.Join(gopathDir, "cache")
+
+					_, err = fetcher.Fetch(dependency)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(requests).To(Equal(1))
+					Expect(libSource()).To(Equal("package lib // 1.0\n"))
+				})
+			})
+		})
+
+		Context("when fetching fails because of the network", func() {
+			var goGets int
+
+			BeforeEach(func() {
+				goGets = 0
+
+				fetcher.Retry = retry.Policy{
+					Retries: 2,
+					Backoff: time.Millisecond,
+				}
+
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("go").Path,
+					Args: []string{"get", "-d", "-v", dependency.Path},
+				}, func(cmd *exec.Cmd) error {
+					goGets++
+
+					if goGets == 1 {
+						return command_runner.CommandFailedError{
+							OriginalError: errors.New("exit status 1"),
+
+							Command: cmd,
+							Output:  []byte("# cd .; git clone https://github.com/vito/gocart\nfatal: unable to access 'https://github.com/vito/gocart/': Could not resolve host: github.com\n"),
+						}
+					}
+
+					return nil
+				})
+			})
+
+			It("retries it", func() {
+				_, err := fetcher.Fetch(dependency)
+				Expect(err).ToNot(HaveOccurred())
+
+				Ω(goGets).Should(Equal(2))
+
+				Ω(runner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("go").Path,
+						Args: []string{"get", "-d", "-v", dependency.Path},
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("go").Path,
+						Args: []string{"get", "-d", "-v", dependency.Path},
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"checkout", "v1.2"},
+					},
+				))
+			})
+		})
+
+		Context("when checking out fails because the version is unknown", func() {
+			var checkouts int
+
+			BeforeEach(func() {
+				checkouts = 0
+
+				fetcher.Retry = retry.Policy{
+					Retries: 2,
+					Backoff: time.Millisecond,
+				}
+
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"checkout", "v1.2"},
+				}, func(cmd *exec.Cmd) error {
+					checkouts++
+
+					return command_runner.CommandFailedError{
+						OriginalError: errors.New("exit status 1"),
+
+						Command: cmd,
+						Output:  []byte("error: pathspec 'v1.2' did not match any file(s) known to git\n"),
+					}
+				})
+			})
+
+			It("does not retry it", func() {
+				_, err := fetcher.Fetch(dependency)
+				Expect(err).To(HaveOccurred())
+
+				Ω(checkouts).Should(Equal(1))
+			})
+		})
+
+		Context("when a command times out", func() {
+			var timedOut command_runner.CommandTimedOutError
+
+			BeforeEach(func() {
+				runner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: exec.Command("go").Path,
+					Args: []string{"get", "-d", "-v", dependency.Path},
+				}, func(cmd *exec.Cmd) error {
+					timedOut = command_runner.CommandTimedOutError{
+						Timeout: time.Minute,
+						Command: cmd,
+					}
+
+					return timedOut
+				})
+			})
+
+			It("returns a CommandKilledError naming the dependency", func() {
+				_, err := fetcher.Fetch(dependency)
+				Expect(err).To(Equal(CommandKilledError{
+					Path: dependency.Path,
+					Err:  timedOut,
+				}))
+
+				Expect(err.Error()).To(ContainSubstring(dependency.Path + ": "))
+			})
+		})
+
 		Context("when a different version has already been fetched", func() {
 			It("returns a VersionConflictError", func() {
 				count := 0
@@ -251,12 +917,15 @@ var _ = Describe("Fetcher", func() {
 					Args: []string{"rev-parse", "HEAD"},
 				}, func(cmd *exec.Cmd) error {
 					if count == 0 {
-						// initial check
+						// recorded for rolling back
 						cmd.Stdout.Write([]byte("xxx\n"))
 					} else if count == 1 {
+						// initial check
+						cmd.Stdout.Write([]byte("xxx\n"))
+					} else if count == 2 {
 						// first version
 						cmd.Stdout.Write([]byte("some-sha\n"))
-					} else if count == 2 {
+					} else if count == 3 {
 						// second check
 						cmd.Stdout.Write([]byte("some-sha\n"))
 					} else {
@@ -281,4 +950,73 @@ var _ = Describe("Fetcher", func() {
 			})
 		})
 	})
+
+	Describe("Rollback", func() {
+		var currentVersion string
+
+		BeforeEach(func() {
+			currentVersion = "old-sha"
+
+			runner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: exec.Command("git").Path,
+				Args: []string{"rev-parse", "HEAD"},
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(currentVersion + "\n"))
+				return nil
+			})
+
+			runner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: exec.Command("git").Path,
+				Args: []string{"checkout", "v1.2"},
+			}, func(cmd *exec.Cmd) error {
+				currentVersion = "new-sha"
+				return nil
+			})
+
+			runner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: exec.Command("git").Path,
+				Args: []string{"checkout", "old-sha"},
+			}, func(cmd *exec.Cmd) error {
+				currentVersion = "old-sha"
+				return nil
+			})
+		})
+
+		It("checks out fetched repositories at their previous versions", func() {
+			_, err := fetcher.Fetch(dependency)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(currentVersion).To(Equal("new-sha"))
+
+			restored, err := fetcher.Rollback(runner)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(restored).To(Equal([]dependency_package.Dependency{
+				{
+					Path:    dependency.Path,
+					Version: "old-sha",
+				},
+			}))
+
+			Expect(currentVersion).To(Equal("old-sha"))
+		})
+
+		It("leaves repositories that were not changed alone", func() {
+			dependency.Version = "old-sha"
+
+			_, err := fetcher.Fetch(dependency)
+			Expect(err).ToNot(HaveOccurred())
+
+			restored, err := fetcher.Rollback(runner)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(restored).To(BeEmpty())
+
+			Ω(runner).ShouldNot(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"checkout", "old-sha"},
+				},
+			))
+		})
+	})
 })
@@ -3,6 +3,7 @@ package gopath
 import (
 	"errors"
 	"path/filepath"
+	"strings"
 )
 
 var GoPathNotSet = errors.New("The GOPATH environment variable needs to be set.")
@@ -16,3 +17,25 @@ func InstallationDirectory(gopath string) (string, error) {
 
 	return gopath, nil
 }
+
+func ImportPath(gopath string, dir string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for _, root := range filepath.SplitList(gopath) {
+		rel, err := filepath.Rel(filepath.Join(root, "src"), absDir)
+		if err != nil {
+			continue
+		}
+
+		if rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		return filepath.ToSlash(rel), true
+	}
+
+	return "", false
+}
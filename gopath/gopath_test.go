@@ -31,3 +31,28 @@ var _ = Describe("GOPATH parsing", func() {
 		})
 	})
 })
+
+var _ = Describe("import path detection", func() {
+	Context("when the directory is inside the GOPATH", func() {
+		It("returns its path relative to src", func() {
+			path, ok := gopath.ImportPath("/some/gopath", "/some/gopath/src/github.com/vito/gocart")
+			Expect(ok).To(BeTrue())
+			Expect(path).To(Equal("github.com/vito/gocart"))
+		})
+	})
+
+	Context("when the directory is inside a later GOPATH element", func() {
+		It("returns its path relative to that element's src", func() {
+			path, ok := gopath.ImportPath("/some/gopath:/other/gopath", "/other/gopath/src/github.com/vito/gocart")
+			Expect(ok).To(BeTrue())
+			Expect(path).To(Equal("github.com/vito/gocart"))
+		})
+	})
+
+	Context("when the directory is outside the GOPATH", func() {
+		It("returns false", func() {
+			_, ok := gopath.ImportPath("/some/gopath", "/somewhere/else")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
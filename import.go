@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vito/gocart/importing"
+	"github.com/vito/gocart/repository"
+)
+
+func importDependencies(root string, file string, force bool) {
+	cartridgePath := filepath.Join(root, CartridgeFile)
+
+	if _, err := os.Stat(cartridgePath); err == nil && !force {
+		fatal(CartridgeFile + " already exists; use -force to replace it")
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		fatal(err)
+	}
+
+	var revisions map[string]string
+
+	if filepath.Base(file) == importing.GitmodulesFile {
+		revisions = submoduleRevisions(filepath.Dir(file))
+	}
+
+	deps, err := importing.Parse(file, content, revisions)
+	if err != nil {
+		fatal(err)
+	}
+
+	maxWidth := 0
+
+	for _, dep := range deps.Dependencies {
+		if len(dep.Path) > maxWidth {
+			maxWidth = len(dep.Path)
+		}
+	}
+
+	rewriteRules := []string{}
+
+	for i, dep := range deps.Dependencies {
+		fmt.Println(bold(dep.Path) + padding(maxWidth-len(dep.Path)+2) + cyan(dep.Version))
+
+		// gocart fetches from elsewhere by rewrite rule rather than per
+		// dependency
+		if dep.Remote != "" {
+			rewriteRules = append(rewriteRules, dep.Path+"="+dep.Remote)
+			deps.Dependencies[i].Remote = ""
+		}
+	}
+
+	cartridge := new(bytes.Buffer)
+
+	for _, dep := range deps.Dependencies {
+		line := dep.Path + "\t" + dep.Version
+
+		if len(dep.Tags) > 0 {
+			line += "\t" + strings.Join(dep.Tags, ",")
+		}
+
+		fmt.Fprintln(cartridge, line)
+	}
+
+	err = ioutil.WriteFile(cartridgePath, cartridge.Bytes(), 0644)
+	if err != nil {
+		fatal(err)
+	}
+
+	err = deps.SaveTo(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(rewriteRules) > 0 {
+		fmt.Println()
+		fmt.Println(file, "fetches some dependencies from elsewhere; to do the same, add to .gocart:")
+		fmt.Println()
+
+		for _, rule := range rewriteRules {
+			fmt.Println(indent(1, "rewrite "+rule))
+		}
+
+		fmt.Println()
+	}
+
+	fmt.Println(green("OK"))
+}
+
+// the commit each submodule is at, as recorded by the repository containing
+// .gitmodules
+func submoduleRevisions(dir string) map[string]string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fatal(err)
+	}
+
+	repo, err := repository.New(dir, Runner)
+	if err != nil {
+		fatal(err)
+	}
+
+	submoduleRepo, ok := repo.(repository.SubmoduleRepository)
+	if !ok {
+		fatal(fmt.Sprintf("%s is not a git repository", dir))
+	}
+
+	revisions, err := submoduleRepo.Submodules()
+	if err != nil {
+		fatal(err)
+	}
+
+	return revisions
+}
@@ -0,0 +1,420 @@
+package importing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/set"
+)
+
+type godeps struct {
+	Deps []struct {
+		ImportPath string
+		Rev        string
+	}
+}
+
+// Godeps/Godeps.json, which pins each package
+func Godeps(content []byte) ([]dependency.Dependency, error) {
+	var parsed godeps
+
+	err := json.Unmarshal(content, &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := []dependency.Dependency{}
+
+	for _, dep := range parsed.Deps {
+		if dep.Rev == "" {
+			return nil, set.MissingVersionError{Path: dep.ImportPath}
+		}
+
+		deps = append(deps, dependency.Dependency{
+			Path:    dep.ImportPath,
+			Version: dep.Rev,
+		})
+	}
+
+	return deps, nil
+}
+
+// glide.lock; testImports are tagged 'test'
+func Glide(content []byte) ([]dependency.Dependency, error) {
+	deps := []dependency.Dependency{}
+
+	var current *dependency.Dependency
+	var tags []string
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+
+		if current.Version == "" {
+			return set.MissingVersionError{Path: current.Path}
+		}
+
+		deps = append(deps, *current)
+		current = nil
+
+		return nil
+	}
+
+	lines := bufio.NewScanner(bytes.NewReader(content))
+
+	line := 0
+	for lines.Scan() {
+		line++
+
+		text := lines.Text()
+
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+
+		// a top-level key, e.g. 'imports:'
+		if !strings.HasPrefix(text, " ") && !strings.HasPrefix(text, "-") {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+
+			key := strings.SplitN(text, ":", 2)[0]
+
+			switch key {
+			case "imports":
+				tags = nil
+			case "testImports":
+				tags = []string{"test"}
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(text, "- name:") {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+
+			current = &dependency.Dependency{
+				Path: unquote(strings.TrimPrefix(text, "- name:")),
+				Tags: tags,
+			}
+
+			continue
+		}
+
+		if current == nil {
+			return nil, InvalidFileError{GlideFile, line}
+		}
+
+		segments := strings.SplitN(strings.TrimSpace(text), ":", 2)
+		if len(segments) != 2 {
+			// e.g. the entries of subpackages
+			continue
+		}
+
+		switch segments[0] {
+		case "version":
+			current.Version = unquote(segments[1])
+		case "repo":
+			current.Remote = unquote(segments[1])
+		}
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	return deps, nil
+}
+
+// Gopkg.lock, as written by dep
+func Dep(content []byte) ([]dependency.Dependency, error) {
+	deps := []dependency.Dependency{}
+
+	var current *dependency.Dependency
+
+	line := 0
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+
+		if current.Path == "" {
+			return InvalidFileError{DepFile, line}
+		}
+
+		if current.Version == "" {
+			return set.MissingVersionError{Path: current.Path}
+		}
+
+		deps = append(deps, *current)
+		current = nil
+
+		return nil
+	}
+
+	lines := bufio.NewScanner(bytes.NewReader(content))
+
+	for lines.Scan() {
+		line++
+
+		text := strings.TrimSpace(lines.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+
+			if text == "[[projects]]" {
+				current = &dependency.Dependency{}
+			}
+
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		segments := strings.SplitN(text, "=", 2)
+		if len(segments) != 2 {
+			// the continuation of a multi-line array
+			continue
+		}
+
+		switch strings.TrimSpace(segments[0]) {
+		case "name":
+			current.Path = unquote(segments[1])
+		case "revision":
+			current.Version = unquote(segments[1])
+		case "source":
+			current.Remote = unquote(segments[1])
+		}
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	return deps, nil
+}
+
+// .gitmodules; submodules beneath a 'vendor' or 'src' directory are taken to
+// be at their import path, and others are named after their URL
+func Gitmodules(content []byte, revisions map[string]string) ([]dependency.Dependency, error) {
+	deps := []dependency.Dependency{}
+
+	var path, url string
+
+	finish := func() error {
+		if path == "" && url == "" {
+			return nil
+		}
+
+		urlPath := importPathFromURL(url)
+
+		dep := dependency.Dependency{
+			Path:    importPathFromDirectory(path),
+			Version: revisions[path],
+		}
+
+		if dep.Path == "" {
+			dep.Path = urlPath
+		} else if dep.Path != urlPath {
+			dep.Remote = url
+		}
+
+		if dep.Version == "" {
+			return set.MissingVersionError{Path: dep.Path}
+		}
+
+		deps = append(deps, dep)
+
+		path, url = "", ""
+
+		return nil
+	}
+
+	lines := bufio.NewScanner(bytes.NewReader(content))
+
+	line := 0
+	for lines.Scan() {
+		line++
+
+		text := strings.TrimSpace(lines.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		segments := strings.SplitN(text, "=", 2)
+		if len(segments) != 2 {
+			return nil, InvalidFileError{GitmodulesFile, line}
+		}
+
+		switch strings.TrimSpace(segments[0]) {
+		case "path":
+			path = unquote(segments[1])
+		case "url":
+			url = unquote(segments[1])
+		}
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	return deps, nil
+}
+
+var pseudoVersion = regexp.MustCompile(`[-.]\d{14}-([0-9a-f]{12})$`)
+
+// go.mod; pseudo-versions are pinned to their revision, and replacements by
+// other modules are fetched from there
+func GoMod(content []byte) ([]dependency.Dependency, error) {
+	deps := []dependency.Dependency{}
+	replacements := map[string]dependency.Dependency{}
+
+	block := ""
+
+	lines := bufio.NewScanner(bytes.NewReader(content))
+
+	line := 0
+	for lines.Scan() {
+		line++
+
+		text := lines.Text()
+		if comment := strings.Index(text, "//"); comment != -1 {
+			text = text[:comment]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" && fields[0] == ")" {
+			block = ""
+			continue
+		}
+
+		directive := block
+
+		if block == "" {
+			directive = fields[0]
+			fields = fields[1:]
+
+			if len(fields) == 1 && fields[0] == "(" {
+				block = directive
+				continue
+			}
+		}
+
+		switch directive {
+		case "require":
+			if len(fields) != 2 {
+				return nil, InvalidFileError{GoModFile, line}
+			}
+
+			deps = append(deps, dependency.Dependency{
+				Path:    unquote(fields[0]),
+				Version: moduleRevision(fields[1]),
+			})
+		case "replace":
+			arrow := -1
+			for i, field := range fields {
+				if field == "=>" {
+					arrow = i
+				}
+			}
+
+			if arrow < 1 || arrow == len(fields)-1 {
+				return nil, InvalidFileError{GoModFile, line}
+			}
+
+			target := fields[arrow+1:]
+
+			// replacements by local directories can't be fetched
+			if len(target) != 2 {
+				continue
+			}
+
+			replacements[unquote(fields[0])] = dependency.Dependency{
+				Version: moduleRevision(target[1]),
+				Remote:  "https://" + unquote(target[0]),
+			}
+		}
+	}
+
+	for i, dep := range deps {
+		replacement, found := replacements[dep.Path]
+		if !found {
+			continue
+		}
+
+		deps[i].Version = replacement.Version
+		deps[i].Remote = replacement.Remote
+	}
+
+	return deps, nil
+}
+
+// the revision of a pseudo-version, or the tag of any other version
+func moduleRevision(version string) string {
+	version = strings.TrimSuffix(version, "+incompatible")
+
+	if match := pseudoVersion.FindStringSubmatch(version); match != nil {
+		return match[1]
+	}
+
+	return version
+}
+
+// e.g. 'vendor/github.com/a/b' or 'src/github.com/a/b' for github.com/a/b
+func importPathFromDirectory(dir string) string {
+	segments := strings.Split(strings.Trim(dir, "/"), "/")
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		if (segments[i] == "vendor" || segments[i] == "src") && i+1 < len(segments) {
+			return strings.Join(segments[i+1:], "/")
+		}
+	}
+
+	return ""
+}
+
+// e.g. 'https://github.com/a/b.git' or 'git@github.com:a/b' for
+// github.com/a/b
+func importPathFromURL(url string) string {
+	if scheme := strings.Index(url, "://"); scheme != -1 {
+		url = url[scheme+3:]
+	} else {
+		// scp-like, as 'user@host:path'
+		url = strings.Replace(url, ":", "/", 1)
+	}
+
+	if at := strings.Index(url, "@"); at != -1 && at < strings.Index(url+"/", "/") {
+		url = url[at+1:]
+	}
+
+	return strings.TrimSuffix(strings.Trim(url, "/"), ".git")
+}
@@ -0,0 +1,182 @@
+package importing
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/set"
+)
+
+const GodepsFile = "Godeps.json"
+const GlideFile = "glide.lock"
+const DepFile = "Gopkg.lock"
+const GitmodulesFile = ".gitmodules"
+const GoModFile = "go.mod"
+
+type UnknownFormatError struct {
+	Path string
+}
+
+func (e UnknownFormatError) Error() string {
+	return fmt.Sprintf(
+		"cannot import '%s'; expected one of %s, %s, %s, %s or %s",
+		e.Path,
+		GodepsFile,
+		GlideFile,
+		DepFile,
+		GitmodulesFile,
+		GoModFile,
+	)
+}
+
+type InvalidFileError struct {
+	Path string
+	Line int
+}
+
+func (e InvalidFileError) Error() string {
+	return fmt.Sprintf("cannot parse %s (line %d)", e.Path, e.Line)
+}
+
+type ConflictingRevisionsError struct {
+	Path string
+
+	RevisionA string
+	RevisionB string
+}
+
+func (e ConflictingRevisionsError) Error() string {
+	return fmt.Sprintf(
+		"packages of %s are pinned to different revisions: %s and %s",
+		e.Path,
+		e.RevisionA,
+		e.RevisionB,
+	)
+}
+
+// reads the dependencies from a file written by another tool, chosen by its
+// name; .gitmodules records no revisions, so they are given by submodule path
+func Parse(path string, content []byte, submoduleRevisions map[string]string) (*set.Set, error) {
+	var deps []dependency.Dependency
+	var err error
+
+	switch filepath.Base(path) {
+	case GodepsFile:
+		deps, err = Godeps(content)
+	case GlideFile:
+		deps, err = Glide(content)
+	case DepFile:
+		deps, err = Dep(content)
+	case GitmodulesFile:
+		deps, err = Gitmodules(content, submoduleRevisions)
+	case GoModFile:
+		deps, err = GoMod(content)
+	default:
+		return nil, UnknownFormatError{path}
+	}
+
+	if err != nil {
+		if invalid, ok := err.(InvalidFileError); ok {
+			invalid.Path = path
+			return nil, invalid
+		}
+
+		return nil, err
+	}
+
+	return Collapse(deps)
+}
+
+// hosts whose repositories are always this many path segments deep
+var repositoryDepths = map[string]int{
+	"github.com":        3,
+	"bitbucket.org":     3,
+	"gitlab.com":        3,
+	"golang.org":        3,
+	"code.google.com":   3,
+	"launchpad.net":     2,
+	"google.golang.org": 2,
+	"go.uber.org":       2,
+	"k8s.io":            2,
+}
+
+var gopkgVersion = regexp.MustCompile(`\.v\d+$`)
+
+// the import path of the repository containing the package, where the host
+// makes it apparent; otherwise the package itself
+func RepositoryRoot(importPath string) string {
+	segments := strings.Split(importPath, "/")
+
+	if segments[0] == "gopkg.in" {
+		for i, segment := range segments {
+			if gopkgVersion.MatchString(segment) {
+				return strings.Join(segments[:i+1], "/")
+			}
+		}
+
+		return importPath
+	}
+
+	depth, found := repositoryDepths[segments[0]]
+	if !found || len(segments) <= depth {
+		return importPath
+	}
+
+	return strings.Join(segments[:depth], "/")
+}
+
+// merges packages into their repositories, which must all be at the same
+// revision, so that no dependency is beneath another
+func Collapse(deps []dependency.Dependency) (*set.Set, error) {
+	roots := make([]dependency.Dependency, len(deps))
+
+	for i, dep := range deps {
+		roots[i] = dep
+		roots[i].Path = RepositoryRoot(dep.Path)
+	}
+
+	sort.Stable(byPath(roots))
+
+	collapsed := &set.Set{}
+
+	for _, dep := range roots {
+		merged := false
+
+		for i, existing := range collapsed.Dependencies {
+			if !existing.Contains(dep.Path) {
+				continue
+			}
+
+			if existing.Version != dep.Version {
+				return nil, ConflictingRevisionsError{existing.Path, existing.Version, dep.Version}
+			}
+
+			// only a test dependency if every package is
+			if len(dep.Tags) == 0 {
+				collapsed.Dependencies[i].Tags = nil
+			}
+
+			merged = true
+		}
+
+		if !merged {
+			collapsed.Dependencies = append(collapsed.Dependencies, dep)
+		}
+	}
+
+	return collapsed, nil
+}
+
+type byPath []dependency.Dependency
+
+func (deps byPath) Len() int           { return len(deps) }
+func (deps byPath) Less(i, j int) bool { return deps[i].Path < deps[j].Path }
+func (deps byPath) Swap(i, j int)      { deps[i], deps[j] = deps[j], deps[i] }
+
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"'`)
+}
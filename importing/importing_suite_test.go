@@ -0,0 +1,13 @@
+package importing_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestImporting(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Importing Suite")
+}
@@ -0,0 +1,211 @@
+package importing_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/importing"
+	"github.com/vito/gocart/set"
+)
+
+var _ = Describe("Importing", func() {
+	Describe("Parse", func() {
+		It("reads Godeps.json, collapsing packages into their repositories", func() {
+			deps, err := importing.Parse("Godeps/Godeps.json", []byte(`{
+	"ImportPath": "github.com/some/project",
+	"GoVersion": "go1.2",
+	"Deps": [
+		{
+			"ImportPath": "code.google.com/p/go.net/html",
+			"Rev": "abc"
+		},
+		{
+			"ImportPath": "code.google.com/p/go.net/websocket",
+			"Rev": "abc"
+		},
+		{
+			"ImportPath": "github.com/vito/lib",
+			"Comment": "v1.0",
+			"Rev": "def"
+		}
+	]
+}`), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(deps.Dependencies).To(Equal([]dependency.Dependency{
+				{Path: "code.google.com/p/go.net", Version: "abc"},
+				{Path: "github.com/vito/lib", Version: "def"},
+			}))
+		})
+
+		It("reads glide.lock, tagging testImports", func() {
+			deps, err := importing.Parse("glide.lock", []byte(`hash: abcdef
+updated: 2014-01-31T23:00:00Z
+imports:
+- name: github.com/vito/lib
+  version: abc
+  subpackages:
+  - sub
+- name: example.com/hglib
+  version: "42"
+  repo: https://example.com/hg/hglib
+  vcs: hg
+testImports:
+- name: github.com/onsi/ginkgo
+  version: def
+`), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(deps.Dependencies).To(Equal([]dependency.Dependency{
+				{Path: "example.com/hglib", Version: "42", Remote: "https://example.com/hg/hglib"},
+				{Path: "github.com/onsi/ginkgo", Version: "def", Tags: []string{"test"}},
+				{Path: "github.com/vito/lib", Version: "abc"},
+			}))
+		})
+
+		It("reads Gopkg.lock", func() {
+			deps, err := importing.Parse("Gopkg.lock", []byte(`# This file is autogenerated, do not edit; changes may be undone by the next 'dep ensure'.
+
+
+[[projects]]
+  branch = "master"
+  name = "github.com/vito/lib"
+  packages = [
+    ".",
+    "sub"
+  ]
+  revision = "abc"
+
+[[projects]]
+  name = "golang.org/x/net"
+  packages = ["context"]
+  revision = "def"
+  source = "https://github.com/golang/net"
+  version = "v0.1.0"
+
+[solve-meta]
+  analyzer-name = "dep"
+  inputs-digest = "123"
+`), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(deps.Dependencies).To(Equal([]dependency.Dependency{
+				{Path: "github.com/vito/lib", Version: "abc"},
+				{Path: "golang.org/x/net", Version: "def", Remote: "https://github.com/golang/net"},
+			}))
+		})
+
+		It("reads .gitmodules at the given revisions", func() {
+			deps, err := importing.Parse(".gitmodules", []byte(`[submodule "vendor/github.com/vito/lib"]
+	path = vendor/github.com/vito/lib
+	url = https://github.com/vito/lib.git
+[submodule "deps/other"]
+	path = deps/other
+	url = git@example.com:someone/other.git
+[submodule "vendor/example.com/fork"]
+	path = vendor/example.com/fork
+	url = https://github.com/someone/fork
+`), map[string]string{
+				"vendor/github.com/vito/lib": "abc",
+				"deps/other":                 "def",
+				"vendor/example.com/fork":    "123",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(deps.Dependencies).To(Equal([]dependency.Dependency{
+				{Path: "example.com/fork", Version: "123", Remote: "https://github.com/someone/fork"},
+				{Path: "example.com/someone/other", Version: "def"},
+				{Path: "github.com/vito/lib", Version: "abc"},
+			}))
+		})
+
+		Context("when a submodule has no revision", func() {
+			It("returns MissingVersionError", func() {
+				_, err := importing.Parse(".gitmodules", []byte(`[submodule "lib"]
+	path = vendor/github.com/vito/lib
+	url = https://github.com/vito/lib.git
+`), map[string]string{})
+				Expect(err).To(Equal(set.MissingVersionError{Path: "github.com/vito/lib"}))
+			})
+		})
+
+		It("reads go.mod, taking the revision of pseudo-versions", func() {
+			deps, err := importing.Parse("go.mod", []byte(`module github.com/some/project
+
+go 1.12
+
+require (
+	github.com/vito/lib v0.0.0-20140102030405-0123456789ab
+	github.com/vito/other/v2 v2.1.0
+	github.com/vito/old v1.2.1-0.20140102030405-abcdefabcdef+incompatible // indirect
+)
+
+require golang.org/x/net v0.1.0
+
+replace golang.org/x/net => github.com/golang/net v0.2.0
+
+replace github.com/vito/lib => ../lib
+`), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(deps.Dependencies).To(Equal([]dependency.Dependency{
+				{Path: "github.com/vito/lib", Version: "0123456789ab"},
+				{Path: "github.com/vito/old", Version: "abcdefabcdef"},
+				{Path: "github.com/vito/other", Version: "v2.1.0"},
+				{Path: "golang.org/x/net", Version: "v0.2.0", Remote: "https://github.com/golang/net"},
+			}))
+		})
+
+		Context("when packages of a repository are at different revisions", func() {
+			It("returns ConflictingRevisionsError", func() {
+				_, err := importing.Parse("Godeps.json", []byte(`{"Deps": [
+	{"ImportPath": "github.com/vito/lib/a", "Rev": "abc"},
+	{"ImportPath": "github.com/vito/lib/b", "Rev": "def"}
+]}`), nil)
+				Expect(err).To(Equal(importing.ConflictingRevisionsError{"github.com/vito/lib", "abc", "def"}))
+			})
+		})
+
+		Context("when a line can't be parsed", func() {
+			It("returns InvalidFileError with the file's path", func() {
+				_, err := importing.Parse("some/go.mod", []byte("module x\n\nrequire github.com/vito/lib\n"), nil)
+				Expect(err).To(Equal(importing.InvalidFileError{"some/go.mod", 3}))
+			})
+		})
+
+		Context("with any other file", func() {
+			It("returns UnknownFormatError", func() {
+				_, err := importing.Parse("Makefile", []byte{}, nil)
+				Expect(err).To(Equal(importing.UnknownFormatError{"Makefile"}))
+			})
+		})
+	})
+
+	Describe("RepositoryRoot", func() {
+		It("finds the repository of packages on well-known hosts", func() {
+			Expect(importing.RepositoryRoot("github.com/vito/lib/sub/pkg")).To(Equal("github.com/vito/lib"))
+			Expect(importing.RepositoryRoot("golang.org/x/net/context")).To(Equal("golang.org/x/net"))
+			Expect(importing.RepositoryRoot("gopkg.in/yaml.v2")).To(Equal("gopkg.in/yaml.v2"))
+			Expect(importing.RepositoryRoot("gopkg.in/someone/lib.v1/sub")).To(Equal("gopkg.in/someone/lib.v1"))
+		})
+
+		It("leaves other packages alone", func() {
+			Expect(importing.RepositoryRoot("example.com/lib/sub")).To(Equal("example.com/lib/sub"))
+		})
+	})
+
+	Describe("Collapse", func() {
+		It("merges packages beneath another dependency into it", func() {
+			deps, err := importing.Collapse([]dependency.Dependency{
+				{Path: "example.com/lib/sub", Version: "abc"},
+				{Path: "example.com/lib", Version: "abc", Tags: []string{"test"}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(deps.Dependencies).To(Equal([]dependency.Dependency{
+				{Path: "example.com/lib", Version: "abc"},
+			}))
+		})
+	})
+})
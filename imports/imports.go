@@ -0,0 +1,187 @@
+package imports
+
+import (
+	"bytes"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Imports struct {
+	Source []string
+	Test   []string
+}
+
+func Scan(root string, self string) (*Imports, error) {
+	source := map[string]bool{}
+	test := map[string]bool{}
+
+	fset := token.NewFileSet()
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != root && skipDir(info.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !strings.HasSuffix(info.Name(), ".go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+
+		isTest := strings.HasSuffix(info.Name(), "_test.go")
+
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return err
+			}
+
+			if IsStandard(importPath) {
+				continue
+			}
+
+			if self != "" && strings.HasPrefix(importPath+"/", self+"/") {
+				continue
+			}
+
+			if isTest {
+				test[importPath] = true
+			} else {
+				source[importPath] = true
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	imports := &Imports{}
+
+	for importPath := range source {
+		imports.Source = append(imports.Source, importPath)
+	}
+
+	for importPath := range test {
+		if !source[importPath] {
+			imports.Test = append(imports.Test, importPath)
+		}
+	}
+
+	sort.Strings(imports.Source)
+	sort.Strings(imports.Test)
+
+	return imports, nil
+}
+
+// changes every import that the function gives a new path for, returning the
+// files that were rewritten
+func Rewrite(root string, rewrite func(string) (string, bool)) ([]string, error) {
+	rewritten := []string{}
+
+	fset := token.NewFileSet()
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != root && skipDir(info.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !strings.HasSuffix(info.Name(), ".go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return err
+			}
+
+			newPath, found := rewrite(importPath)
+			if !found || newPath == importPath {
+				continue
+			}
+
+			spec.Path.Value = strconv.Quote(newPath)
+			changed = true
+		}
+
+		if !changed {
+			return nil
+		}
+
+		source := new(bytes.Buffer)
+
+		// as gofmt does, but without sorting the imports, which would
+		// separate them from their comments
+		printerConfig := &printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+		err = printerConfig.Fprint(source, fset, file)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(path, source.Bytes(), info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		rewritten = append(rewritten, path)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rewritten, nil
+}
+
+// standard library packages never have a dot in their first path element
+func IsStandard(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// vendor holds copies of dependencies (e.g. from 'gocart vendor'), whose
+// imports are theirs rather than the project's
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") ||
+		strings.HasPrefix(name, "_") ||
+		name == "testdata" ||
+		name == "vendor"
+}
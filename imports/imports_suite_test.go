@@ -0,0 +1,13 @@
+package imports_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestImports(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Imports Suite")
+}
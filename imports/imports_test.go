@@ -0,0 +1,236 @@
+package imports_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vito/gocart/imports"
+)
+
+var _ = Describe("Scan", func() {
+	var projectDir string
+
+	writeFile := func(path string, content string) {
+		fullPath := filepath.Join(projectDir, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(fullPath, []byte(content), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "gocart-project")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		projectDir = tmpdir
+
+		writeFile("main.go", `package main
+
+import (
+	"fmt"
+
+	"github.com/vito/cmdtest"
+	"github.com/vito/gocart/set"
+)
+`)
+
+		writeFile("foo/foo.go", `package foo
+
+import "launchpad.net/gocheck"
+`)
+
+		writeFile("foo/foo_test.go", `package foo_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	"launchpad.net/gocheck"
+)
+`)
+
+		writeFile(".hidden/hidden.go", `package hidden
+
+import "github.com/hidden/thing"
+`)
+
+		writeFile("_ignored/ignored.go", `package ignored
+
+import "github.com/ignored/thing"
+`)
+
+		writeFile("testdata/data.go", `package data
+
+import "github.com/testdata/thing"
+`)
+
+		writeFile("vendor/github.com/a/lib/lib.go", `package lib
+
+import "github.com/vendored/thing"
+`)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectDir)
+	})
+
+	It("returns the non-standard imports of the source files", func() {
+		imports, err := Scan(projectDir, "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(imports.Source).Should(Equal([]string{
+			"github.com/vito/cmdtest",
+			"github.com/vito/gocart/set",
+			"launchpad.net/gocheck",
+		}))
+	})
+
+	It("returns imports only made by test files separately", func() {
+		imports, err := Scan(projectDir, "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(imports.Test).Should(Equal([]string{
+			"github.com/onsi/ginkgo",
+		}))
+	})
+
+	It("skips imports of the package itself", func() {
+		imports, err := Scan(projectDir, "github.com/vito/gocart")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(imports.Source).Should(Equal([]string{
+			"github.com/vito/cmdtest",
+			"launchpad.net/gocheck",
+		}))
+	})
+
+	Context("when a file cannot be parsed", func() {
+		BeforeEach(func() {
+			writeFile("broken.go", "this is not go")
+		})
+
+		It("returns an error", func() {
+			_, err := Scan(projectDir, "")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("IsStandard", func() {
+	It("returns true for standard library packages", func() {
+		Ω(IsStandard("fmt")).Should(BeTrue())
+		Ω(IsStandard("net/http")).Should(BeTrue())
+	})
+
+	It("returns false for remote packages", func() {
+		Ω(IsStandard("github.com/vito/gocart")).Should(BeFalse())
+		Ω(IsStandard("launchpad.net/gocheck")).Should(BeFalse())
+	})
+})
+
+var _ = Describe("Rewrite", func() {
+	var projectDir string
+
+	writeFile := func(path string, content string) {
+		fullPath := filepath.Join(projectDir, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(fullPath, []byte(content), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	readFile := func(path string) string {
+		content, err := ioutil.ReadFile(filepath.Join(projectDir, path))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return string(content)
+	}
+
+	rewrite := func(importPath string) (string, bool) {
+		if importPath == "code.google.com/p/go.crypto/ssh" {
+			return "golang.org/x/crypto/ssh", true
+		}
+
+		return "", false
+	}
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "gocart-project")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		projectDir = tmpdir
+
+		writeFile("main.go", `package main
+
+import (
+	"fmt"
+
+	// for connecting
+	"code.google.com/p/go.crypto/ssh"
+	"github.com/vito/gocart/set"
+)
+
+func main() {
+	fmt.Println(ssh.CertTimeInfinity, set.CartridgeFile)
+}
+`)
+
+		writeFile("foo/foo.go", `package foo
+
+import "github.com/vito/cmdtest"
+`)
+
+		writeFile("_ignored/ignored.go", `package ignored
+
+import "code.google.com/p/go.crypto/ssh"
+`)
+
+		writeFile("vendor/github.com/a/lib/lib.go", `package lib
+
+import "code.google.com/p/go.crypto/ssh"
+`)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectDir)
+	})
+
+	It("rewrites the imports in each file, keeping their order and comments", func() {
+		rewritten, err := Rewrite(projectDir, rewrite)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(rewritten).Should(Equal([]string{filepath.Join(projectDir, "main.go")}))
+
+		Ω(readFile("main.go")).Should(Equal(`package main
+
+import (
+	"fmt"
+
+	// for connecting
+	"golang.org/x/crypto/ssh"
+	"github.com/vito/gocart/set"
+)
+
+func main() {
+	fmt.Println(ssh.CertTimeInfinity, set.CartridgeFile)
+}
+`))
+	})
+
+	It("leaves other files alone", func() {
+		_, err := Rewrite(projectDir, rewrite)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(readFile("foo/foo.go")).Should(ContainSubstring(`"github.com/vito/cmdtest"`))
+		Ω(readFile("_ignored/ignored.go")).Should(ContainSubstring(`"code.google.com/p/go.crypto/ssh"`))
+		Ω(readFile("vendor/github.com/a/lib/lib.go")).Should(ContainSubstring(`"code.google.com/p/go.crypto/ssh"`))
+	})
+})
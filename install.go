@@ -2,39 +2,98 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
-	"github.com/vito/gocart/command_runner"
 	"github.com/vito/gocart/fetcher"
+	"github.com/vito/gocart/lockfile"
+	"github.com/vito/gocart/policy"
+	"github.com/vito/gocart/repository"
 	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
 )
 
-func install(root string, recursive bool, exclude []string) {
+func install(root string, recursive bool, recordSubmodules bool, force bool, strict bool, depth int, filter tags.Filter, nested *tags.NestedFilters) {
+	locks := lockInstallation(root)
+	defer releaseLocks(locks)
+
 	cartridge, err := set.LoadFrom(root)
 	if err != nil {
 		fatal(err)
 	}
 
-	runner := command_runner.New(false)
+	canonicalizeLock(root, cartridge)
+
+	var rules *policy.Policy
+
+	if strict {
+		rules, err = loadPolicy(root)
+		if err != nil {
+			fatal(err)
+		}
+
+		// nothing has been locked yet; that is checked against the lock
+		// that is about to be saved
+		violations, err := policyViolations(rules.Allowing(policy.Unlocked), root, nil, filter, nested)
+		if err != nil {
+			fatal(err)
+		}
+
+		if len(violations) > 0 {
+			reportViolations(violations)
+			fatal("refusing to install dependencies that violate the policy")
+		}
+	}
+
+	if !force && findDirtyDependencies(cartridge, recursive, filter, nested, 0) {
+		fatal("refusing to check out new versions over local changes; commit or stash them, or use -force")
+	}
 
-	fetcher, err := fetcher.New(runner)
+	fetcher, err := fetcher.New(Runner)
 	if err != nil {
 		fatal(err)
 	}
 
-	err = installDependencies(fetcher, cartridge, recursive, exclude, 0)
+	fetcher.Depth = depth
+	fetcher.Force = force
+	fetcher.Retry = retryPolicy()
+	fetcher.Verbose = *verbose
+	fetcher.Rewrites = rewrites
+	fetcher.Cache = *archiveCache
+
+	err = installDependencies(fetcher, cartridge, recursive, recordSubmodules, filter, nested, 0)
 	if err != nil {
+		rollBack(fetcher)
 		fatal(err)
 	}
 
+	// the Cartridges of newly fetched dependencies, the branches of their
+	// checkouts, and the remotes they were fetched from can only be checked
+	// now, against the lock that is about to be saved
+	if strict {
+		violations, err := policyViolations(rules, root, cartridge, filter, nested)
+		if err != nil {
+			rollBack(fetcher)
+			fatal(err)
+		}
+
+		if len(violations) > 0 {
+			reportViolations(violations)
+			rollBack(fetcher)
+			fatal("refusing to install dependencies that violate the policy")
+		}
+	}
+
 	err = cartridge.SaveTo(root)
 	if err != nil {
+		rollBack(fetcher)
 		fatal(err)
 	}
 
 	fmt.Println(green("OK"))
 }
 
-func installDependencies(fetcher *fetcher.Fetcher, deps *set.Set, recursive bool, exclude []string, depth int) error {
+func installDependencies(fetcher *fetcher.Fetcher, deps *set.Set, recursive bool, recordSubmodules bool, filter tags.Filter, nested *tags.NestedFilters, depth int) error {
 	maxWidth := 0
 
 	for _, dep := range deps.Dependencies {
@@ -44,7 +103,7 @@ func installDependencies(fetcher *fetcher.Fetcher, deps *set.Set, recursive bool
 	}
 
 	for _, dep := range deps.Dependencies {
-		if tagsMatch(dep.Tags, exclude) {
+		if !filter.Matches(dep.Tags) {
 			continue
 		}
 
@@ -65,7 +124,11 @@ func installDependencies(fetcher *fetcher.Fetcher, deps *set.Set, recursive bool
 
 		lockedDependency, err := fetcher.Fetch(dep)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to install %s:\n%s", dep.Path, indent(1, err.Error()))
+		}
+
+		if !recordSubmodules {
+			lockedDependency.Submodules = nil
 		}
 
 		deps.Replace(lockedDependency)
@@ -78,7 +141,7 @@ func installDependencies(fetcher *fetcher.Fetcher, deps *set.Set, recursive bool
 				return err
 			}
 
-			err = installDependencies(fetcher, nextDeps, true, []string{"test"}, depth+1)
+			err = installDependencies(fetcher, nextDeps, true, recordSubmodules, nested.For(dep.Path), nested, depth+1)
 			if err != nil {
 				return err
 			}
@@ -88,14 +151,174 @@ func installDependencies(fetcher *fetcher.Fetcher, deps *set.Set, recursive bool
 	return nil
 }
 
-func tagsMatch(as, bs []string) bool {
-	for _, atag := range as {
-		for _, btag := range bs {
-			if atag == btag {
-				return true
+// keeps other gocart processes from modifying the project or the GOPATH it
+// installs into until the locks are released (or the process exits)
+func lockInstallation(root string) []*lockfile.Lock {
+	err := os.MkdirAll(GOPATH, 0755)
+	if err != nil {
+		fatal(err)
+	}
+
+	paths := []string{}
+
+	for _, path := range []string{root, GOPATH} {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			fatal(err)
+		}
+
+		if len(paths) == 0 || paths[0] != absPath {
+			paths = append(paths, absPath)
+		}
+	}
+
+	locks := []*lockfile.Lock{}
+
+	for _, path := range paths {
+		lock, err := lockfile.Acquire(path, func() {
+			fmt.Println("waiting for another gocart process using", path)
+		})
+		if err != nil {
+			fatal(err)
+		}
+
+		locks = append(locks, lock)
+	}
+
+	return locks
+}
+
+func releaseLocks(locks []*lockfile.Lock) {
+	for _, lock := range locks {
+		lock.Release()
+	}
+}
+
+// restores the dependencies that were already checked out to their previous
+// versions, so that they match Cartridge.lock again
+func rollBack(fetcher *fetcher.Fetcher) {
+	// still roll back if the install was interrupted
+	restored, err := fetcher.Rollback(Runner.Detached())
+
+	for _, dep := range restored {
+		fmt.Println(bold(dep.Path), "rolled back to", cyan(dep.Version))
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, red("failed to roll back:"), err)
+	}
+}
+
+// reports every dependency that installing would check out a new version of,
+// but that has local changes, before anything is modified
+func findDirtyDependencies(deps *set.Set, recursive bool, filter tags.Filter, nested *tags.NestedFilters, depth int) bool {
+	dirty := false
+
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		repoPath := dep.FullPath(GOPATH)
+
+		if _, err := os.Stat(repoPath); err != nil {
+			continue
+		}
+
+		// dirty bleeding-edge dependencies are already left alone
+		if !dep.BleedingEdge {
+			files := pendingChanges(repoPath, dep.Version)
+			if len(files) != 0 {
+				dirty = true
+
+				fmt.Println(indent(depth, bold(dep.Path)))
+				fmt.Println(indent(depth+1, DirtyState{Files: files}.Error()))
 			}
 		}
+
+		if !recursive {
+			continue
+		}
+
+		nextDeps, err := set.LoadFrom(repoPath)
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			fatal(err)
+		}
+
+		if findDirtyDependencies(nextDeps, true, nested.For(dep.Path), nested, depth+1) {
+			dirty = true
+		}
+	}
+
+	return dirty
+}
+
+// replaces versions in Cartridge.lock that are in a form older releases
+// locked, e.g. abbreviated hg node ids or bzr revnos, with the canonical form
+// that CurrentVersion returns, as far as the checkouts can resolve them; they
+// are written out along with the rest of the lock
+func canonicalizeLock(root string, cartridge *set.Set) {
+	lockPath := filepath.Join(root, CartridgeLockFile)
+
+	if _, err := os.Stat(lockPath); err != nil {
+		return
+	}
+
+	locked, err := set.ReadFile(lockPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, ldep := range locked.Dependencies {
+		dep, found := cartridge.Lookup(ldep.Path)
+		if !found || dep.Version != ldep.Version || dep.BleedingEdge || dep.Archive != "" {
+			continue
+		}
+
+		repoPath := dep.FullPath(GOPATH)
+
+		if _, err := os.Stat(repoPath); err != nil {
+			continue
+		}
+
+		repo, err := repository.New(repoPath, Runner)
+		if err != nil {
+			continue
+		}
+
+		// versions that aren't fetched yet are locked once they are
+		resolved, err := repo.ResolveVersion(dep.Version)
+		if err != nil || resolved == "" || resolved == dep.Version {
+			continue
+		}
+
+		dep.Version = resolved
+		cartridge.Replace(dep)
+	}
+}
+
+// the local changes to a checkout that is not at the given version
+func pendingChanges(repoPath string, version string) []repository.FileStatus {
+	repo, err := repository.New(repoPath, Runner)
+	if err != nil {
+		fatal(err)
+	}
+
+	atVersion, err := repository.AtVersion(repo, version)
+	if err != nil {
+		fatal(err)
+	}
+
+	if atVersion {
+		return nil
+	}
+
+	files, err := repo.Status()
+	if err != nil {
+		fatal(err)
 	}
 
-	return false
+	return files
 }
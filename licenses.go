@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vito/gocart/licenses"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+type licenseEntry struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+
+	licenses.Report
+}
+
+func listLicenses(root string, formatName string, recursive bool, deny []string, filter tags.Filter, nested *tags.NestedFilters) {
+	if formatName != "" && formatName != "table" && formatName != "json" {
+		fatal("unknown format for 'gocart licenses': '" + formatName + "'; expected 'table' or 'json'")
+	}
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	entries := []licenseEntry{}
+
+	err = collectLicenses(&entries, cartridge, recursive, filter, nested)
+	if err != nil {
+		fatal(err)
+	}
+
+	if formatName == "json" {
+		content, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Println(string(content))
+	} else {
+		printLicenses(entries)
+	}
+
+	allowed := true
+
+	for _, entry := range entries {
+		for _, name := range licenses.Denied(entry.Names(), deny) {
+			allowed = false
+			fmt.Fprintln(os.Stderr, red(entry.Path+": "+name+" is not allowed"))
+		}
+	}
+
+	if !allowed {
+		os.Exit(1)
+	}
+}
+
+func collectLicenses(entries *[]licenseEntry, deps *set.Set, recursive bool, filter tags.Filter, nested *tags.NestedFilters) error {
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		listed := false
+		for _, entry := range *entries {
+			if entry.Path == dep.Path {
+				listed = true
+			}
+		}
+
+		if listed {
+			continue
+		}
+
+		repoPath := dep.FullPath(GOPATH)
+
+		if _, err := os.Stat(repoPath); err != nil {
+			return fmt.Errorf("%s is not installed in %s; run 'gocart install' first", dep.Path, repoPath)
+		}
+
+		report, err := licenses.Scan(repoPath)
+		if err != nil {
+			return err
+		}
+
+		*entries = append(*entries, licenseEntry{
+			Path:    dep.Path,
+			Version: dep.Version,
+			Report:  report,
+		})
+
+		if !recursive {
+			continue
+		}
+
+		nextDeps, err := set.LoadFrom(repoPath)
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = collectLicenses(entries, nextDeps, true, nested.For(dep.Path), nested)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printLicenses(entries []licenseEntry) {
+	pathWidth := 0
+	namesWidth := 0
+
+	for _, entry := range entries {
+		if len(entry.Path) > pathWidth {
+			pathWidth = len(entry.Path)
+		}
+
+		names := strings.Join(entry.Names(), ", ")
+		if len(names) > namesWidth {
+			namesWidth = len(names)
+		}
+	}
+
+	for _, entry := range entries {
+		names := strings.Join(entry.Names(), ", ")
+
+		files := []string{}
+		for _, license := range entry.Licenses {
+			files = append(files, license.File)
+		}
+
+		files = append(files, entry.Notices...)
+
+		fmt.Println(
+			bold(entry.Path) + padding(pathWidth-len(entry.Path)+2) +
+				cyan(names) + padding(namesWidth-len(names)+2) +
+				strings.Join(files, ", "),
+		)
+	}
+}
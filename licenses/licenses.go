@@ -0,0 +1,200 @@
+package licenses
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// reported for license files that match no known license
+const Unknown = "unknown"
+
+// reported for dependencies with no license file
+const None = "none"
+
+type License struct {
+	File string `json:"file"`
+	Name string `json:"license"`
+}
+
+type Report struct {
+	Licenses []License `json:"licenses"`
+
+	// e.g. the NOTICE files of Apache-licensed code, which must be
+	// redistributed along with it
+	Notices []string `json:"notices,omitempty"`
+}
+
+// the distinct licenses found, or None
+func (r Report) Names() []string {
+	seen := map[string]bool{}
+	names := []string{}
+
+	for _, license := range r.Licenses {
+		if !seen[license.Name] {
+			seen[license.Name] = true
+			names = append(names, license.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return []string{None}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// classifies each license file at the top of the directory
+func Scan(dir string) (Report, error) {
+	report := Report{Licenses: []License{}}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return report, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		kind := fileKind(entry.Name())
+		if kind == "" {
+			continue
+		}
+
+		if kind == "NOTICE" {
+			report.Notices = append(report.Notices, entry.Name())
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return report, err
+		}
+
+		report.Licenses = append(report.Licenses, License{
+			File: entry.Name(),
+			Name: Classify(string(content)),
+		})
+	}
+
+	return report, nil
+}
+
+var filePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE", "NOTICE"}
+
+// e.g. LICENSE, LICENSE.txt, LICENSE-MIT or COPYING.LESSER
+func fileKind(name string) string {
+	upper := strings.ToUpper(name)
+
+	for _, prefix := range filePrefixes {
+		if upper == prefix || strings.HasPrefix(upper, prefix+".") || strings.HasPrefix(upper, prefix+"-") || strings.HasPrefix(upper, prefix+"_") {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+type matcher struct {
+	name string
+
+	// every phrase must appear
+	phrases []string
+
+	// and none of these
+	excluding []string
+}
+
+// checked in order, so that licenses that mention others (e.g. the LGPL
+// referring to the GPL, or the MPL to both) come first; titles include the
+// version, since the GPL family also names each other without one
+var matchers = []matcher{
+	{name: "MPL-2.0", phrases: []string{"mozilla public license version 2.0"}},
+	{name: "MPL-1.1", phrases: []string{"mozilla public license version 1.1"}},
+	{name: "AGPL-3.0", phrases: []string{"gnu affero general public license version 3"}},
+	{name: "LGPL-3.0", phrases: []string{"gnu lesser general public license version 3"}},
+	{name: "LGPL-2.1", phrases: []string{"gnu lesser general public license version 2.1"}},
+	{name: "LGPL-2.0", phrases: []string{"gnu library general public license version 2"}},
+	{name: "GPL-3.0", phrases: []string{"gnu general public license version 3"}},
+	{name: "GPL-2.0", phrases: []string{"gnu general public license version 2"}},
+	{name: "GPL-1.0", phrases: []string{"gnu general public license version 1"}},
+	{name: "EPL-2.0", phrases: []string{"eclipse public license v 2.0"}},
+	{name: "EPL-1.0", phrases: []string{"eclipse public license v 1.0"}},
+	{name: "Apache-2.0", phrases: []string{"apache license version 2.0"}},
+	{name: "BSL-1.0", phrases: []string{"boost software license version 1.0"}},
+	{name: "CC0-1.0", phrases: []string{"cc0 1.0 universal"}},
+	{name: "Unlicense", phrases: []string{"this is free and unencumbered software released into the public domain"}},
+	{name: "WTFPL", phrases: []string{"do what the fuck you want to public license"}},
+	{
+		name:    "BSD-3-Clause",
+		phrases: []string{"redistribution and use in source and binary forms", "may be used to endorse or promote products derived from this software"},
+	},
+	{
+		name:      "BSD-2-Clause",
+		phrases:   []string{"redistribution and use in source and binary forms"},
+		excluding: []string{"may be used to endorse or promote products derived from this software"},
+	},
+	{name: "MIT", phrases: []string{"permission is hereby granted free of charge to any person obtaining a copy"}},
+	{name: "ISC", phrases: []string{"permission to use copy modify and", "distribute this software for any purpose with or without fee is hereby granted"}},
+	{name: "Zlib", phrases: []string{"altered source versions must be plainly marked as such"}},
+}
+
+// the SPDX identifier of the license text, or Unknown
+func Classify(text string) string {
+	normalized := normalize(text)
+
+	for _, matcher := range matchers {
+		if matcher.matches(normalized) {
+			return matcher.name
+		}
+	}
+
+	return Unknown
+}
+
+func (m matcher) matches(normalized string) bool {
+	for _, phrase := range m.phrases {
+		if !strings.Contains(normalized, normalize(phrase)) {
+			return false
+		}
+	}
+
+	for _, phrase := range m.excluding {
+		if strings.Contains(normalized, normalize(phrase)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lowercases the text and reduces punctuation and line breaks to single
+// spaces, so that phrases match however the text is wrapped
+func normalize(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.'
+	}), " ")
+}
+
+// the licenses that the policy denies; each entry is a license, or a prefix
+// ending in '*', e.g. 'GPL-*'
+func Denied(names []string, deny []string) []string {
+	denied := []string{}
+
+	for _, name := range names {
+		for _, pattern := range deny {
+			if pattern == name || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))) {
+				denied = append(denied, name)
+				break
+			}
+		}
+	}
+
+	return denied
+}
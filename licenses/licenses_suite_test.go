@@ -0,0 +1,13 @@
+package licenses_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLicenses(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Licenses Suite")
+}
@@ -0,0 +1,118 @@
+package licenses_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/licenses"
+)
+
+const mitLicense = `The MIT License (MIT)
+
+Copyright (c) 2014 Someone
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction.
+`
+
+const bsdLicense = `Copyright (c) 2012 The Authors. All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+   * Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+   * Neither the name of Someone nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.
+`
+
+var _ = Describe("Licenses", func() {
+	Describe("Classify", func() {
+		It("identifies licenses however they are wrapped", func() {
+			Expect(licenses.Classify(mitLicense)).To(Equal("MIT"))
+			Expect(licenses.Classify(bsdLicense)).To(Equal("BSD-3-Clause"))
+			Expect(licenses.Classify("Redistribution and use in source and\nbinary forms, with or without modification")).To(Equal("BSD-2-Clause"))
+			Expect(licenses.Classify("                                 Apache License\n                           Version 2.0, January 2004")).To(Equal("Apache-2.0"))
+			Expect(licenses.Classify("Mozilla Public License Version 2.0\n==================================")).To(Equal("MPL-2.0"))
+		})
+
+		It("tells the GPL family apart, though they mention each other", func() {
+			gpl := "GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\n\n... use the GNU Lesser General Public License instead of this License."
+			Expect(licenses.Classify(gpl)).To(Equal("GPL-3.0"))
+
+			lgpl := "GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\n\n... version 3 of the GNU General Public License."
+			Expect(licenses.Classify(lgpl)).To(Equal("LGPL-3.0"))
+
+			Expect(licenses.Classify("GNU GENERAL PUBLIC LICENSE\nVersion 2, June 1991")).To(Equal("GPL-2.0"))
+		})
+
+		It("returns Unknown for anything else", func() {
+			Expect(licenses.Classify("All rights reserved.")).To(Equal(licenses.Unknown))
+		})
+	})
+
+	Describe("Scan", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+
+			dir, err = ioutil.TempDir("", "licenses")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		writeFile := func(name string, contents string) {
+			err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("classifies each license file, and lists notices", func() {
+			writeFile("LICENSE-MIT", mitLicense)
+			writeFile("license.txt", bsdLicense)
+			writeFile("NOTICE", "Some attribution.")
+			writeFile("README", mitLicense)
+
+			report, err := licenses.Scan(dir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(report.Licenses).To(Equal([]licenses.License{
+				{File: "LICENSE-MIT", Name: "MIT"},
+				{File: "license.txt", Name: "BSD-3-Clause"},
+			}))
+
+			Expect(report.Notices).To(Equal([]string{"NOTICE"}))
+			Expect(report.Names()).To(Equal([]string{"BSD-3-Clause", "MIT"}))
+		})
+
+		Context("when there are no license files", func() {
+			It("is named None", func() {
+				report, err := licenses.Scan(dir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(report.Licenses).To(BeEmpty())
+				Expect(report.Names()).To(Equal([]string{licenses.None}))
+			})
+		})
+	})
+
+	Describe("Denied", func() {
+		It("returns the licenses matching any entry", func() {
+			Expect(licenses.Denied([]string{"MIT", "GPL-3.0", "unknown"}, []string{"GPL-*", "unknown"})).To(Equal([]string{"GPL-3.0", "unknown"}))
+		})
+
+		It("returns nothing when the policy is empty", func() {
+			Expect(licenses.Denied([]string{"GPL-3.0"}, nil)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/gopath"
+	"github.com/vito/gocart/imports"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+type LintResult struct {
+	// imports with no covering Cartridge entry
+	Missing []string
+
+	// entries that nothing imports
+	Unused []string
+
+	// entries not tagged 'test' that only tests import
+	Untagged []string
+
+	// entries tagged 'test' that non-test code imports
+	Mistagged []string
+}
+
+func (self LintResult) Empty() bool {
+	return len(self.Missing) == 0 &&
+		len(self.Unused) == 0 &&
+		len(self.Untagged) == 0 &&
+		len(self.Mistagged) == 0
+}
+
+func (self LintResult) String() string {
+	out := ""
+
+	section := func(title string, paths []string) {
+		if len(paths) == 0 {
+			return
+		}
+
+		out += red(title) + "\n"
+
+		for _, path := range paths {
+			out += indent(1, path) + "\n"
+		}
+	}
+
+	section("missing dependencies:", self.Missing)
+	section("unused dependencies:", self.Unused)
+	section("only imported by tests (tag them 'test'):", self.Untagged)
+	section("tagged 'test' but imported by non-test code:", self.Mistagged)
+
+	return out
+}
+
+func lint(root string, recursive bool, filter tags.Filter, nested *tags.NestedFilters) {
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	self, _ := gopath.ImportPath(os.Getenv("GOPATH"), root)
+
+	if lintProject(root, self, cartridge, recursive, filter, nested, 0) {
+		os.Exit(1)
+	}
+
+	fmt.Println(green("OK"))
+}
+
+// entries the filter doesn't select are not linted or recursed into, but
+// still cover their imports; tests are only scanned if it selects 'test'
+func lintProject(dir string, self string, deps *set.Set, recursive bool, filter tags.Filter, nested *tags.NestedFilters, depth int) bool {
+	found, err := imports.Scan(dir, self)
+	if err != nil {
+		fatal(err)
+	}
+
+	tests := filter.Matches([]string{"test"})
+
+	if !tests {
+		found.Test = nil
+	}
+
+	if recursive {
+		found.Source = followImports(deps, found.Source)
+	}
+
+	problems := false
+
+	result := lintImports(deps, found, tests, filter)
+	if !result.Empty() {
+		problems = true
+		fmt.Println(indent(depth, result.String()))
+	}
+
+	if !recursive {
+		return problems
+	}
+
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) || !tests && isTestDependency(dep) {
+			continue
+		}
+
+		nextDeps, err := set.LoadFrom(dep.FullPath(GOPATH))
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			fatal(err)
+		}
+
+		fmt.Println(indent(depth, bold(dep.Path)))
+
+		if lintProject(dep.FullPath(GOPATH), dep.Path, nextDeps, true, nested.For(dep.Path), nested, depth+1) {
+			problems = true
+		} else {
+			fmt.Println(indent(depth+1, green("OK")))
+		}
+	}
+
+	return problems
+}
+
+// adds the imports of each fetched dependency that relies on this Cartridge
+// to provide its own dependencies (i.e. has no Cartridge of its own)
+func followImports(deps *set.Set, sourceImports []string) []string {
+	seen := map[string]bool{}
+	scanned := map[string]bool{}
+
+	queue := append([]string{}, sourceImports...)
+	all := []string{}
+
+	for len(queue) > 0 {
+		importPath := queue[0]
+		queue = queue[1:]
+
+		if seen[importPath] {
+			continue
+		}
+
+		seen[importPath] = true
+		all = append(all, importPath)
+
+		dep, found := deps.Lookup(importPath)
+		if !found || scanned[dep.Path] {
+			continue
+		}
+
+		scanned[dep.Path] = true
+
+		depPath := dep.FullPath(GOPATH)
+
+		if _, err := os.Stat(depPath); err != nil {
+			continue
+		}
+
+		if _, err := set.LoadFrom(depPath); err != set.NoCartridgeError {
+			continue
+		}
+
+		depImports, err := imports.Scan(depPath, dep.Path)
+		if err != nil {
+			fatal(err)
+		}
+
+		queue = append(queue, depImports.Source...)
+	}
+
+	return all
+}
+
+func lintImports(deps *set.Set, found *imports.Imports, tests bool, filter tags.Filter) LintResult {
+	result := LintResult{}
+
+	usedBySource := map[string]bool{}
+	usedByTests := map[string]bool{}
+
+	for _, importPath := range found.Source {
+		dep, covered := deps.Lookup(importPath)
+		if !covered {
+			result.Missing = append(result.Missing, importPath)
+			continue
+		}
+
+		usedBySource[dep.Path] = true
+	}
+
+	for _, importPath := range found.Test {
+		dep, covered := deps.Lookup(importPath)
+		if !covered {
+			result.Missing = append(result.Missing, importPath)
+			continue
+		}
+
+		usedByTests[dep.Path] = true
+	}
+
+	for _, dep := range deps.Dependencies {
+		isTest := isTestDependency(dep)
+
+		if !filter.Matches(dep.Tags) || !tests && isTest {
+			continue
+		}
+
+		switch {
+		case usedBySource[dep.Path] && isTest:
+			result.Mistagged = append(result.Mistagged, dep.Path)
+		case usedBySource[dep.Path]:
+		case usedByTests[dep.Path] && !isTest:
+			result.Untagged = append(result.Untagged, dep.Path)
+		case usedByTests[dep.Path]:
+		default:
+			result.Unused = append(result.Unused, dep.Path)
+		}
+	}
+
+	return result
+}
+
+func isTestDependency(dep dependency.Dependency) bool {
+	return tags.Intersect(dep.Tags, []string{"test"})
+}
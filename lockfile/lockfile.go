@@ -0,0 +1,56 @@
+package lockfile
+
+import (
+	"os"
+)
+
+// An advisory lock held on a file for the lifetime of the process, or until
+// released. Other gocart processes wait for it; nothing else is prevented
+// from touching the file.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire blocks until the lock on the file or directory at path is held,
+// creating a file if nothing exists there. If another process holds it,
+// waiting is called first.
+func Acquire(path string, waiting func()) (*Lock, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		file, err = os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, err := tryLock(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if !acquired {
+		if waiting != nil {
+			waiting()
+		}
+
+		err := lock(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return &Lock{file}, nil
+}
+
+func (l *Lock) Release() error {
+	err := unlock(l.file)
+	if err != nil {
+		l.file.Close()
+		return err
+	}
+
+	return l.file.Close()
+}
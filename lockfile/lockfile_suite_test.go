@@ -0,0 +1,13 @@
+package lockfile_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLockfile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Lockfile Suite")
+}
@@ -0,0 +1,93 @@
+package lockfile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vito/gocart/lockfile"
+)
+
+var _ = Describe("Acquire", func() {
+	var lockDir string
+	var lockPath string
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "gocart-lock")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		lockDir = tmpdir
+		lockPath = filepath.Join(lockDir, "some.lock")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(lockDir)
+	})
+
+	It("creates the file", func() {
+		lock, err := Acquire(lockPath, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		defer lock.Release()
+
+		_, err = os.Stat(lockPath)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("can lock a directory", func() {
+		lock, err := Acquire(lockDir, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = lock.Release()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("can be acquired again once released", func() {
+		lock, err := Acquire(lockPath, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = lock.Release()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		lock, err = Acquire(lockPath, func() {
+			Fail("should not have waited")
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		lock.Release()
+	})
+
+	Context("when the lock is already held", func() {
+		It("waits for it to be released", func() {
+			held, err := Acquire(lockPath, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			waited := make(chan bool, 1)
+			acquired := make(chan bool, 1)
+
+			go func() {
+				defer GinkgoRecover()
+
+				lock, err := Acquire(lockPath, func() {
+					waited <- true
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				acquired <- true
+
+				lock.Release()
+			}()
+
+			Eventually(waited).Should(Receive())
+			Consistently(acquired).ShouldNot(Receive())
+
+			err = held.Release()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(acquired).Should(Receive())
+		})
+	})
+})
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/vito/gocart/archive"
+	"github.com/vito/gocart/command_runner"
+	"github.com/vito/gocart/config"
 	"github.com/vito/gocart/gopath"
+	"github.com/vito/gocart/retry"
+	"github.com/vito/gocart/rewrite"
+	"github.com/vito/gocart/tags"
 )
 
 const GocartVersion = "0.1.0"
@@ -16,6 +27,9 @@ const CartridgeLockFile = "Cartridge.lock"
 
 var GOPATH string
 
+// runs every VCS command; canceled by Ctrl-C or when -timeout is reached
+var Runner *command_runner.RealCommandRunner
+
 var recursive = flag.Bool(
 	"r",
 	false,
@@ -28,6 +42,158 @@ var exclude = flag.String(
 	"exclude dependencies matching any of the (comma-separated) tags",
 )
 
+var tagExpression = flag.String(
+	"t",
+	"",
+	"select dependencies by a tag expression, e.g. 'integration,!test'",
+)
+
+var nested = tags.NewNestedFilters(tags.Filter{Exclude: []string{"test"}})
+
+func init() {
+	flag.Var(
+		nested,
+		"n",
+		"tag expression for nested Cartridges, either for all of them or as 'import/path=expression' (repeatable)",
+	)
+}
+
+var rewrites = rewrite.Rules{}
+
+func init() {
+	flag.Var(
+		&rewrites,
+		"rewrite",
+		"fetch import paths with a prefix from another URL, as 'prefix=url' (repeatable)",
+	)
+}
+
+var recordSubmodules = flag.Bool(
+	"s",
+	false,
+	"record the versions of git submodules in Cartridge.lock",
+)
+
+var shallowDepth = flag.Int(
+	"d",
+	0,
+	"clone git dependencies with only this many commits of history (0 for full clones)",
+)
+
+var force = flag.Bool(
+	"force",
+	false,
+	"install even over dependencies with local changes, or import over an existing Cartridge",
+)
+
+var strict = flag.Bool(
+	"strict",
+	false,
+	"with 'gocart install', refuse to install dependencies that violate the policy file",
+)
+
+var policyFile = flag.String(
+	"policy",
+	"",
+	"policy file for 'gocart policy check' and 'gocart install -strict' (default Cartridge.policy)",
+)
+
+var stash = flag.Bool(
+	"stash",
+	false,
+	"stash local changes to dependencies before syncing them",
+)
+
+var timeout = flag.Duration(
+	"timeout",
+	0,
+	"give up on the whole command after this long (e.g. '30m'; 0 for no limit)",
+)
+
+var commandTimeout = flag.Duration(
+	"command-timeout",
+	10*time.Minute,
+	"kill any single VCS command that runs longer than this (0 for no limit)",
+)
+
+var retries = flag.Int(
+	"retries",
+	2,
+	"retry network operations this many times when they fail because of the network",
+)
+
+var retryBackoff = flag.Duration(
+	"retry-backoff",
+	2*time.Second,
+	"wait this long before the first retry, doubling it for each one after",
+)
+
+var verbose = flag.Bool(
+	"verbose",
+	false,
+	"log every command run and every retry",
+)
+
+var installRoot = flag.String(
+	"install-root",
+	"",
+	"install dependencies into this directory instead of the first entry in $GOPATH",
+)
+
+var archiveCache = flag.String(
+	"cache",
+	defaultArchiveCache(),
+	"keep downloaded archives in this directory ('' to discard them)",
+)
+
+var output = flag.String(
+	"output",
+	"color",
+	"output format: 'color' or 'plain'",
+)
+
+var vendorCheck = flag.Bool(
+	"vendor",
+	false,
+	"with 'gocart check', verify the vendor directory against Cartridge.lock instead",
+)
+
+var format = flag.String(
+	"format",
+	"",
+	"file format for 'gocart export' ('godeps', 'glide', 'dep' or 'gomod') or 'gocart sbom' ('spdx-json' or 'cyclonedx-json'), or output format for 'gocart licenses' ('table' or 'json')",
+)
+
+var deniedLicenses = flag.String(
+	"deny-licenses",
+	"",
+	"with 'gocart licenses', fail if any of the (comma-separated) licenses are found, e.g. 'GPL-*,AGPL-3.0,unknown'",
+)
+
+var advisoryDatabase = flag.String(
+	"advisories",
+	"",
+	"directory of security advisories (.json files) for 'gocart audit'",
+)
+
+var migrationPaths = flag.String(
+	"paths",
+	"",
+	"file of 'old/path new/path' lines for 'gocart migrate', in addition to the built-in ones",
+)
+
+var migrationRevisions = flag.String(
+	"revisions",
+	"",
+	"file of 'old-revision new-revision' lines for 'gocart migrate', e.g. hg nodes to git commits",
+)
+
+var migrateImports = flag.Bool(
+	"imports",
+	false,
+	"also rewrite import statements in the project's .go files when migrating",
+)
+
 var showHelp = flag.Bool(
 	"h",
 	false,
@@ -45,8 +211,41 @@ func main() {
 
 	args := flag.Args()
 
+	// flags may also follow the command, e.g. 'gocart check -vendor'
+	if len(args) > 0 {
+		command := args[0]
+
+		flag.CommandLine.Parse(args[1:])
+
+		args = append([]string{command}, flag.Args()...)
+	}
+
+	configure(".")
+
 	command := ""
 
+	switch *output {
+	case "color":
+	case "plain":
+		plainOutput = true
+	default:
+		fatal("unknown output format: " + *output)
+	}
+
+	if *installRoot != "" {
+		root, err := filepath.Abs(*installRoot)
+		if err != nil {
+			fatal(err)
+		}
+
+		// go get installs into the first entry as well
+		if os.Getenv("GOPATH") == "" {
+			os.Setenv("GOPATH", root)
+		} else {
+			os.Setenv("GOPATH", root+string(filepath.ListSeparator)+os.Getenv("GOPATH"))
+		}
+	}
+
 	gopath, err := gopath.InstallationDirectory(os.Getenv("GOPATH"))
 	if err != nil {
 		fatal("GOPATH is not set.")
@@ -54,6 +253,10 @@ func main() {
 
 	GOPATH = gopath
 
+	Runner = command_runner.NewWithContext(interruptibleContext(*timeout), *verbose, *commandTimeout)
+
+	archive.Timeout = *commandTimeout
+
 	if len(args) == 0 {
 		command = "install"
 	} else {
@@ -70,35 +273,463 @@ func main() {
 		return
 	}
 
+	filter, err := tags.ParseFilter(*tagExpression)
+	if err != nil {
+		fatal(err)
+	}
+
+	filter = filter.Excluding(strings.Split(*exclude, ",")...)
+
 	if command == "install" {
-		install(".", *recursive, strings.Split(*exclude, ","))
+		install(".", *recursive, *recordSubmodules, *force, *strict, *shallowDepth, filter, nested)
 		return
 	}
 
 	if command == "check" {
-		check(".")
+		if *vendorCheck {
+			checkVendor(".", *recursive, filter, nested)
+		} else {
+			check(".", filter, nested)
+		}
+
+		return
+	}
+
+	if command == "sync" {
+		sync(".", *stash, filter, nested)
+		return
+	}
+
+	if command == "vendor" {
+		vendor(".", *recursive, filter, nested)
+		return
+	}
+
+	if command == "export" {
+		exportDependencies(".", *format, *recursive, filter, nested)
+		return
+	}
+
+	if command == "licenses" {
+		listLicenses(".", *format, *recursive, splitList(*deniedLicenses), filter, nested)
+		return
+	}
+
+	if command == "sbom" {
+		generateSBOM(".", *format, filter, nested)
+		return
+	}
+
+	if command == "audit" {
+		audit(".", *advisoryDatabase, *recursive, filter, nested)
+		return
+	}
+
+	if command == "policy" {
+		if len(args) != 2 || args[1] != "check" {
+			fatal("usage: gocart policy check")
+		}
+
+		checkPolicy(".", filter, nested)
+		return
+	}
+
+	if command == "import" {
+		if len(args) != 2 {
+			fatal("usage: gocart import <file>")
+		}
+
+		importDependencies(".", args[1], *force)
+		return
+	}
+
+	if command == "migrate" {
+		migrate(".", *migrationPaths, *migrationRevisions, *migrateImports)
+		return
+	}
+
+	if command == "lint" {
+		lint(".", *recursive, filter, nested)
 		return
 	}
 
 	unknownCommand()
 }
 
+// the comma-separated entries of a flag, or nothing if it is empty
+func splitList(value string) []string {
+	entries := []string{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+func defaultArchiveCache() string {
+	dir := config.UserCacheDirectory()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, "archives")
+}
+
+func retryPolicy() retry.Policy {
+	return retry.Policy{
+		Retries: *retries,
+		Backoff: *retryBackoff,
+	}
+}
+
+// canceled on SIGINT or SIGTERM, or once the timeout has passed
+func interruptibleContext(timeout time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-interrupts
+		cancel()
+
+		// a second interrupt exits immediately
+		signal.Stop(interrupts)
+	}()
+
+	return ctx
+}
+
 func help() {
 	fmt.Println(`gocart: a go package manager
 
 Usage:
 
+  Flags may be given before or after the command, e.g. 'gocart -r install'
+  or 'gocart check -vendor'.
+
   'gocart':
     Install dependencies described by Cartridge.lock or Cartridge, and
     update Cartridge.lock with locked-down dependency versions.
 
+    If any dependency fails to install, those already checked out at a new
+    version are restored to the version they were at before, and
+    Cartridge.lock is left untouched.
+
+    Only one gocart process installs into a project or GOPATH at a time;
+    others wait for it to finish. 'gocart sync' takes the same locks.
+
     The following flags are handled:
 
       -r: (recurse) if each dependency has a Cartridge, recursively run
           gocart for it as well
 
+      -t: (tags) only install dependencies selected by the tag expression
+          (see below)
+
+      -x: (exclude) skip dependencies with any of the given tags; shorthand
+          for '-t !tag1,!tag2'
+
+      -n: (nested) tag expression for the Cartridges of dependencies when
+          used with -r; defaults to '!test'. Given as 'import/path=expr' it
+          only applies to that library's Cartridge, and may be repeated
+
+      -d: (depth) clone new git dependencies shallowly, with only this many
+          commits of history. Locked versions that aren't present are
+          fetched individually or by deepening the clone. 'gocart check'
+          reports "unknown" instead of ahead/behind counts when it cannot
+          see enough history. Only github.com dependencies and those with
+          a rewrite rule are cloned shallowly; for others the clone URL
+          isn't known, so they are left to 'go get' and cloned in full
+
+      -s: (submodules) record the versions of each git dependency's
+          submodules in Cartridge.lock, so that 'gocart check' can detect
+          changes inside them
+
+      -rewrite: (repeatable) fetch repositories whose import paths start
+                with a prefix from another URL, as 'prefix=url'. Each '*' in
+                the prefix matches one path segment, substituted for {1},
+                {2}, etc. in the URL, and the matched prefix is taken as the
+                repository's root. URLs starting with 'hg+' or 'bzr+' are
+                cloned with that tool; others with git. The most specific
+                rule applies. For example:
+
+                  -rewrite 'github.com/ourco/*=ssh://git@git.ourco.com/{1}.git'
+                  -rewrite 'code.google.com/p/go.net=https://github.com/golang/net'
+
+                Existing clones are pointed at the new URL before updating,
+                and the URL is recorded in Cartridge.lock as 'remote=<url>'.
+                'gocart sync' applies the same rules
+
+      -force: check out new versions of dependencies even if they have
+              local changes. Without it, gocart lists every such dependency
+              and exits before modifying any of them
+
+      -strict: check the policy file (see 'gocart policy check') before
+               installing anything, and again before writing Cartridge.lock
+               once the Cartridges of new dependencies have been fetched,
+               rolling back if it is violated
+
+    Each VCS command is run non-interactively, so credential and host key
+    prompts fail instead of waiting for input. The following flags apply to
+    every command:
+
+      -command-timeout: kill any single VCS command that runs longer than
+                        this (default 10m; 0 for no limit)
+
+      -timeout: give up after this long in total (default no limit)
+
+    Interrupting gocart (Ctrl-C) kills the running command along with any
+    processes it started, and rolls back an install as if it had failed.
+
+    Fetching, cloning and updating are retried when they fail because of the
+    network (e.g. a host that can't be resolved or a dropped connection), but
+    not for errors like unknown revisions:
+
+      -retries: how many times to retry (default 2; 0 to never retry)
+
+      -retry-backoff: how long to wait before the first retry, doubling for
+                      each one after (default 2s)
+
+      -verbose: log every command run, and every retry
+
   'gocart check':
-    Check if any of the dependencies are in a modified/dirty state.
+    Check if any of the dependencies are in a modified/dirty state, including
+    git submodules that are not at the commit their repository expects or
+    at the version recorded with 'gocart -s'.
+
+    Dependencies on another version than the one locked are reported as
+    ahead of, behind, or diverged from it, counting commits from the most
+    recent common ancestor of the two.
+
+    Dependencies locked with a 'remote=<url>' are also reported if their
+    checkout is fetched from anywhere else.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+    As there, the Cartridges of dependencies are checked with '!test' unless
+    -n says otherwise, so their test dependencies are left out.
+
+    The following flags are handled:
+
+      -vendor: check the vendor directory instead, reporting dependencies
+               that are missing from it, vendored at another version than
+               the one locked, or changed since they were vendored, and
+               anything vendored that is no longer locked. With -r, the
+               Cartridges of vendored dependencies are checked as well
+
+  'gocart sync':
+    Update and check out every clean dependency that 'gocart check' reports
+    as being on another version than the one locked. Dependencies with local
+    changes are skipped and reported.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -stash: set local changes aside first (with git stash, hg shelve or
+              bzr shelve), and sync those dependencies as well
+
+  'gocart vendor':
+    Copy every dependency in Cartridge.lock into ./vendor/[import path] at
+    its locked version, without VCS metadata (using git archive, hg archive,
+    bzr export or svn export), for builds that use the vendor directory and
+    for self-contained source tarballs. Dependencies must be installed
+    first. What was vendored is recorded in vendor/gocart.manifest, and
+    dependencies no longer locked are removed.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -r: (recurse) also vendor the dependencies of vendored dependencies
+          that have their own Cartridge, into the same directory
+
+  'gocart export':
+    Write the dependencies in Cartridge.lock in another tool's format, for
+    collaborators or build systems that don't use gocart. Dependencies must
+    be installed first; their revisions and commit times are read from
+    their checkouts. Archive dependencies are skipped.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -format: one of
+                 godeps: Godeps/Godeps.json
+                 glide:  glide.lock, with 'test' dependencies as testImports
+                 dep:    Gopkg.lock
+                 gomod:  go.mod, requiring each dependency at a pseudo-version
+                         (v0.0.0-[commit time]-[revision]). The module path
+                         is taken from an existing go.mod, or from the
+                         project's place in $GOPATH
+
+      -r: (recurse) also include the dependencies of dependencies that have
+          their own Cartridge, marked '// indirect' in go.mod. Different
+          versions of the same dependency are reported as a conflict
+
+  'gocart licenses':
+    List the license of each dependency, read from the LICENSE, LICENCE,
+    COPYING and UNLICENSE files in its checkout and identified by SPDX name
+    (e.g. MIT, BSD-3-Clause, Apache-2.0, MPL-2.0, GPL-3.0). Files that
+    match no known license are reported as 'unknown', and dependencies with
+    none as 'none'. NOTICE files are listed alongside. Dependencies must be
+    installed first.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -r: (recurse) also list the dependencies of dependencies that have
+          their own Cartridge
+
+      -format: 'table' (the default) or 'json'
+
+      -deny-licenses: exit 1 if any of these (comma-separated) licenses is
+                      found, reporting which. A trailing '*' matches any
+                      license starting with what precedes it, e.g.
+                      'GPL-*,AGPL-*,unknown,none'
+
+  'gocart sbom':
+    Print a software bill of materials for the locked dependencies, and
+    those of their Cartridges in turn, with the import path, VCS, remote
+    URL, revision, license (as 'gocart licenses' identifies it) and a
+    sha256 of the files at that revision of each; both are read from the
+    revision itself, not from local changes to the checkout. Which
+    dependency requires which is taken from the Cartridges. Dependencies
+    must be installed first.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -format: 'spdx-json' (SPDX 2.3) or 'cyclonedx-json' (CycloneDX 1.4)
+
+  'gocart audit':
+    Check each locked dependency against a database of security advisories,
+    reporting those whose revision is affected along with the revision that
+    fixes it, and exiting 1 if there are any. Dependencies must be installed
+    first.
+
+    The database is a directory of .json files, each with one advisory or a
+    list of them, like:
+
+      {
+        "id": "GOCART-2014-0001",
+        "path": "github.com/some/lib",
+        "description": "Parsing untrusted input can panic.",
+        "affected": [{"introduced": "v1.0.0", "fixed": "v1.2.1"}]
+      }
+
+    .yml and .yaml files are refused; convert them to JSON.
+
+    A revision is affected if it descends from (or is) 'introduced' but not
+    'fixed', as determined by the dependency's history; either may be a
+    commit or tag, and either may be left out to mean since the beginning
+    or not yet fixed. Advisories for packages within a dependency apply to
+    the dependency.
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -advisories: the directory of advisories (required; may be set in
+                   the config file)
+
+      -r: (recurse) also audit the dependencies of dependencies that have
+          their own Cartridge
+
+  'gocart policy check':
+    Check the dependencies in Cartridge, and those of their Cartridges in
+    turn (as far as they are installed), against the rules in
+    Cartridge.policy, reporting every violation with the Cartridge or
+    Cartridge.lock file and line it comes from, and exiting 1 if there are
+    any. The policy file has one rule per line ('#' starts a comment):
+
+      allow-host github.com
+      allow-host *.example.com
+      deny bleeding-edge
+      deny unlocked
+      deny branches
+
+    allow-host: (repeatable) dependencies, and the remote or archive URLs
+                they are fetched from, must be on one of these hosts; '*'
+                matches within a name. Without it any host is allowed
+
+    deny bleeding-edge: no dependencies may be versioned '*'
+
+    deny unlocked: every dependency must have an entry in Cartridge.lock;
+                   'gocart install -strict' checks this only against the
+                   lock it is about to write
+
+    deny branches: no version in Cartridge or Cartridge.lock may name a
+                   branch (or hg bookmark) rather than a tag or commit, as
+                   told by the dependency's checkout
+
+    Dependencies are selected with -t, -x and -n as with 'gocart install'.
+
+    The following flags are handled:
+
+      -policy: read the rules from this file instead
+
+  'gocart import [file]':
+    Write Cartridge and Cartridge.lock from the dependencies pinned by
+    another tool: Godeps/Godeps.json, glide.lock, Gopkg.lock, .gitmodules
+    (at the commits recorded for each submodule) or go.mod (at the revision
+    of each pseudo-version, or its tag). Packages are collapsed into the
+    repositories that contain them, which must all be pinned to the same
+    revision. glide's testImports are tagged 'test'.
+
+    Dependencies fetched from somewhere other than their import path are
+    listed as rewrite rules to add to .gocart.
+
+    The following flags are handled:
+
+      -force: replace an existing Cartridge
+
+  'gocart lint':
+    Compare the packages imported by the project's .go files against
+    Cartridge, reporting imports with no Cartridge entry and entries that
+    nothing imports. Packages only imported by tests should be tagged 'test'.
+
+    Entries not selected with -t, -x and -n (as with 'gocart install') are
+    neither reported nor linted, though imports they cover are not missing.
+    Test files are only read where 'test' dependencies are selected, which
+    for dependencies' Cartridges is not the case by default.
+
+    The following flags are handled:
+
+      -r: (recurse) also follow the imports of fetched dependencies, and
+          lint dependencies that have their own Cartridge against it
+
+  'gocart migrate':
+    Rewrite Cartridge and Cartridge.lock entries for packages that have
+    moved, e.g. from code.google.com/p/go.crypto to golang.org/x/crypto.
+    Packages beneath a moved path move with it. A table of well-known moves
+    is built in.
+
+    Versions are translated for the new repository using the -revisions
+    file; 'tip' and 'default' become 'master'. Locked versions that can't
+    be translated are kept and reported, and can be updated by removing
+    them from Cartridge.lock and running 'gocart install'.
+
+    The following flags are handled:
+
+      -paths: a file of 'old/path new/path' lines, used before the
+              built-in moves
+
+      -revisions: a file of 'old-revision new-revision' lines, e.g. hg
+                  node ids and the git commit ids they were converted to
+
+      -imports: also rewrite the import statements in the project's .go
+                files
 
 Place your dependencies in a file called Cartridge with this format:
 
@@ -109,6 +740,55 @@ After getting them, it will take the "hard" ref (e.g. the sha in git), and save
 it in Cartridge.lock. The Cartridge.lock has the same format as Cartridge and
 has the same semantics; it will later be used by 'gocart install' if it exists.
 
+Dependencies may instead be downloaded as a tarball or zip, with the archive's
+sha256 checksum as the version and its URL as an 'archive' attribute:
+
+example.com/lib	sha256:[hex]	archive=https://example.com/lib-1.2.tar.gz
+
+The archive is verified against the checksum and unpacked in place of a
+checkout, without the top-level directory it may have. 'gocart check' reports
+files changed since it was unpacked. Downloads are kept in
+~/.cache/gocart/archives (or $XDG_CACHE_HOME/gocart/archives), or the
+directory given with -cache; '-cache ""' discards them.
+
+Dependencies may be tagged with a comma-separated list in a third column;
+attributes like 'archive=...' may come before or after it.
+Tag expressions are comma-separated tags, each optionally negated with '!'.
+Dependencies with a negated tag are skipped; if any tags are given without
+'!', tagged dependencies must have one of them. Untagged dependencies are
+always selected unless excluded. For example, '-t integration,!test' selects
+untagged and 'integration' dependencies, but nothing tagged 'test'.
+
+Configuration:
+
+  Any flag except -h and -v can be given a default in a config file, one
+  'name value' per line ('#' starts a comment), or in the environment as
+  GOCART_<NAME>, e.g. GOCART_COMMAND_TIMEOUT=5m. The single-letter flags
+  are named recursive (-r), exclude (-x), tags (-t), nested (-n),
+  submodules (-s) and depth (-d). Repeatable flags like -n may be given
+  more than once.
+
+  Settings are taken from the first of these that has them:
+
+    1. flags on the command line
+    2. the environment
+    3. .gocart in the project directory
+    4. ~/.config/gocart/config (or $XDG_CONFIG_HOME/gocart/config)
+
+  For example:
+
+    recursive true
+    exclude integration
+    install-root ~/go-deps
+    output plain
+
+  These settings have no flag of their own in the sections above:
+
+    -install-root: install dependencies into this directory rather than the
+                   first entry in $GOPATH
+
+    -output: 'color' (the default) or 'plain', without escape codes
+
 To update an individual dependency, simply remove its line from Cartridge.lock
 and run 'gocart install'. To update all dependencies, remove Cartridge.lock.
 `)
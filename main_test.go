@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -25,6 +26,7 @@ var currentDirectory,
 	fakeGitRepoPath, fakeGitRepoWithRevisionPath,
 	fakeLockedGitRepoWithNewDepPath,
 	fakeLockedGitRepoWithRemovedDepPath,
+	fakeLockedGitRepoWithMissingDepPath,
 	fakeHgRepoPath, fakeHgRepoWithRevisionPath,
 	fakeBzrRepoPath, fakeBzrRepoWithRevisionPath,
 	fakeUnlockedRepoWithRecursiveDependencies,
@@ -65,6 +67,11 @@ var _ = BeforeEach(func() {
 	)
 	Ω(err).ShouldNot(HaveOccurred())
 
+	fakeLockedGitRepoWithMissingDepPath, err = filepath.Abs(
+		path.Join(gocartDir, "fixtures", "fake_git_repo_locked_with_missing_dep"),
+	)
+	Ω(err).ShouldNot(HaveOccurred())
+
 	fakeGitRepoPath, err = filepath.Abs(
 		path.Join(gocartDir, "fixtures", "fake_git_repo"),
 	)
@@ -227,6 +234,72 @@ var _ = Describe("install", func() {
 			Expect(hgRevision(dependencyPath)).To(Say("1e7a3e301825"))
 		})
 
+		It("locks bzr dependencies to their revision-id", func() {
+			installCmd.Dir = fakeBzrRepoWithRevisionPath
+
+			install()
+
+			set, err := set.LoadFrom(installCmd.Dir)
+			Expect(err).ToNot(HaveOccurred())
+
+			dependencyPath := path.Join(gopath, "src", "launchpad.net", "gocheck")
+
+			Expect(set.Dependencies).To(HaveLen(1))
+			Expect(set.Dependencies[0].Version).To(Equal(currentBzrRevision(dependencyPath)))
+		})
+
+		It("locks hg dependencies to their full node id", func() {
+			installCmd.Dir = fakeHgRepoWithRevisionPath
+
+			install()
+
+			set, err := set.LoadFrom(installCmd.Dir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(set.Dependencies).To(HaveLen(1))
+			Expect(set.Dependencies[0].Version).To(MatchRegexp("^1e7a3e301825[0-9a-f]{28}$"))
+		})
+
+		Context("when Cartridge.lock has a version in the form an older release locked", func() {
+			var lockPath string
+
+			BeforeEach(func() {
+				installCmd.Dir = fakeHgRepoWithRevisionPath
+
+				install()
+
+				lockPath = path.Join(fakeHgRepoWithRevisionPath, "Cartridge.lock")
+
+				err := ioutil.WriteFile(lockPath, []byte("code.google.com/p/go.crypto/ssh\t1e7a3e301825+\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+
+				// local changes keep the checkout from being updated
+				dependencyPath := path.Join(gopath, "src", "code.google.com", "p", "go.crypto")
+
+				err = ioutil.WriteFile(path.Join(dependencyPath, "some-new-file"), []byte("hi"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+
+				env := installCmd.Env
+
+				installCmd = exec.Command(gocartPath, "install")
+				installCmd.Env = env
+				installCmd.Dir = fakeHgRepoWithRevisionPath
+			})
+
+			AfterEach(func() {
+				os.Remove(lockPath)
+			})
+
+			It("rewrites it in the canonical form", func() {
+				install()
+
+				lock, err := ioutil.ReadFile(lockPath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(string(lock)).To(MatchRegexp("^code.google.com/p/go.crypto/ssh\t1e7a3e301825[0-9a-f]{28}\n$"))
+			})
+		})
+
 		It("generates a Cartridge.lock file", func() {
 			installCmd.Dir = fakeDiverseRepoPath
 
@@ -252,6 +325,104 @@ var _ = Describe("install", func() {
 		})
 	})
 
+	Context("with configuration", func() {
+		var home string
+
+		BeforeEach(func() {
+			var err error
+
+			home, err = ioutil.TempDir(os.TempDir(), "fake_HOME")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = os.MkdirAll(path.Join(home, ".config", "gocart"), 0755)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(
+				path.Join(home, ".config", "gocart", "config"),
+				[]byte("# installs somewhere else\ninstall-root "+path.Join(home, "from-user-config")+"\n"),
+				0644,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			installCmd.Dir = fakeGitRepoPath
+			installCmd.Env = append(installCmd.Env, "HOME="+home)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(home)
+		})
+
+		It("uses settings from the user's config file", func() {
+			install()
+
+			Expect(listing(path.Join(home, "from-user-config", "src", "github.com", "vito", "gocart"))).To(ExitWith(0))
+			Expect(listing(path.Join(gopath, "src", "github.com", "vito", "gocart"))).ToNot(ExitWith(0))
+		})
+
+		It("prefers settings from the environment", func() {
+			installCmd.Env = append(installCmd.Env, "GOCART_INSTALL_ROOT="+path.Join(home, "from-env"))
+
+			install()
+
+			Expect(listing(path.Join(home, "from-env", "src", "github.com", "vito", "gocart"))).To(ExitWith(0))
+		})
+
+		It("prefers flags to both", func() {
+			installCmd.Env = append(installCmd.Env, "GOCART_INSTALL_ROOT="+path.Join(home, "from-env"))
+
+			flagCmd := exec.Command(gocartPath, "-install-root", path.Join(home, "from-flag"), "install")
+			flagCmd.Env = installCmd.Env
+			flagCmd.Dir = installCmd.Dir
+
+			installCmd = flagCmd
+
+			install()
+
+			Expect(listing(path.Join(home, "from-flag", "src", "github.com", "vito", "gocart"))).To(ExitWith(0))
+			Expect(listing(path.Join(home, "from-env"))).ToNot(ExitWith(0))
+		})
+
+		Context("when the config file has an unknown setting", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(path.Join(home, ".config", "gocart", "config"), []byte("recursiv true\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("exits with an error naming it", func() {
+				sess := installing()
+
+				Expect(sess).To(SayError("config:1: unknown setting 'recursiv'"))
+				Expect(sess).To(ExitWith(1))
+			})
+		})
+	})
+
+	Context("with a rewrite rule", func() {
+		BeforeEach(func() {
+			installCmd = exec.Command(gocartPath, "-rewrite", "github.com/vito/*=https://github.com/vito/{1}.git", "install")
+			installCmd.Env = []string{
+				"GOPATH=" + gopath,
+				"GOROOT=" + os.Getenv("GOROOT"),
+				"PATH=" + os.Getenv("PATH"),
+			}
+			installCmd.Dir = fakeGitRepoPath
+		})
+
+		It("clones from the rewritten url and records it in Cartridge.lock", func() {
+			install()
+
+			dependencyPath := path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+			Expect(gitRemote(dependencyPath)).To(Say("https://github.com/vito/gocart.git"))
+
+			set, err := set.LoadFrom(installCmd.Dir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(set.Dependencies).To(HaveLen(1))
+			Expect(set.Dependencies[0].Remote).To(Equal("https://github.com/vito/gocart.git"))
+		})
+	})
+
 	Context("with a Cartridge.lock", func() {
 		It("installs the locked-down versions", func() {
 			installCmd.Dir = fakeLockedGitRepoPath
@@ -263,6 +434,146 @@ var _ = Describe("install", func() {
 			Expect(gitRevision(dependencyPath, "HEAD")).To(Say("7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
 		})
 
+		Context("when a dependency on another version has local changes", func() {
+			var dependencyPath string
+
+			BeforeEach(func() {
+				installCmd.Dir = fakeLockedGitRepoPath
+
+				dependencyPath = path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+				install()
+
+				checkout := exec.Command("git", "checkout", "HEAD~1")
+				checkout.Dir = dependencyPath
+
+				err := checkout.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(dependencyPath, "some-new-file"), []byte("hi"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				env := installCmd.Env
+
+				installCmd = exec.Command(gocartPath, "install")
+				installCmd.Env = env
+				installCmd.Dir = fakeLockedGitRepoPath
+			})
+
+			It("reports it and exits without touching it", func() {
+				sess := installing()
+				Expect(sess).To(Say("github.com/vito/gocart"))
+				Expect(sess).To(Say("untracked +some-new-file"))
+				Expect(sess).To(SayError("refusing"))
+				Expect(sess).ToNot(ExitWith(0))
+
+				Expect(gitRevision(dependencyPath, "HEAD")).ToNot(Say("7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+			})
+
+			Context("with -force", func() {
+				BeforeEach(func() {
+					installCmd.Args = append([]string{installCmd.Args[0], "-force"}, installCmd.Args[1:]...)
+				})
+
+				It("installs the locked-down version anyway", func() {
+					install()
+
+					Expect(gitRevision(dependencyPath, "HEAD")).To(Say("7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+				})
+			})
+		})
+
+		Context("when a dependency locked by an abbreviated id is at that version and has local changes", func() {
+			var dependencyPath string
+			var lockPath string
+			var originalLock []byte
+
+			BeforeEach(func() {
+				installCmd.Dir = fakeLockedGitRepoPath
+
+				dependencyPath = path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+				install()
+
+				lockPath = path.Join(fakeLockedGitRepoPath, "Cartridge.lock")
+
+				var err error
+
+				originalLock, err = ioutil.ReadFile(lockPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(lockPath, []byte("github.com/vito/gocart\t7c9d1a95d4b7\n"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(dependencyPath, "some-new-file"), []byte("hi"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				env := installCmd.Env
+
+				installCmd = exec.Command(gocartPath, "install")
+				installCmd.Env = env
+				installCmd.Dir = fakeLockedGitRepoPath
+			})
+
+			AfterEach(func() {
+				err := ioutil.WriteFile(lockPath, originalLock, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("installs without -force, leaving the changes alone", func() {
+				install()
+
+				Expect(gitRevision(dependencyPath, "HEAD")).To(Say("7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+
+				_, err := os.Stat(path.Join(dependencyPath, "some-new-file"))
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+
+		Context("when a dependency fails to install", func() {
+			var dependencyPath string
+			var previousVersion string
+
+			BeforeEach(func() {
+				installCmd.Dir = fakeLockedGitRepoPath
+
+				dependencyPath = path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+				install()
+
+				checkout := exec.Command("git", "checkout", "HEAD~1")
+				checkout.Dir = dependencyPath
+
+				err := checkout.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				previousVersion = currentGitRevision(dependencyPath)
+
+				env := installCmd.Env
+
+				installCmd = exec.Command(gocartPath, "install")
+				installCmd.Env = env
+				installCmd.Dir = fakeLockedGitRepoWithMissingDepPath
+			})
+
+			It("restores the dependencies it already checked out and leaves Cartridge.lock alone", func() {
+				lockPath := path.Join(fakeLockedGitRepoWithMissingDepPath, "Cartridge.lock")
+
+				lockBefore, err := ioutil.ReadFile(lockPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				sess := installing()
+				Expect(sess).To(Say("github.com/vito/gocart.*rolled back to"))
+				Expect(sess).ToNot(ExitWith(0))
+
+				Expect(currentGitRevision(dependencyPath)).To(Equal(previousVersion))
+
+				lockAfter, err := ioutil.ReadFile(lockPath)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(lockAfter)).Should(Equal(string(lockBefore)))
+			})
+		})
+
 		Context("when there are new dependencies in the Cartridge", func() {
 			It("locks them down", func() {
 				installCmd.Dir = fakeLockedGitRepoWithNewDepPath
@@ -336,6 +647,25 @@ var _ = Describe("install", func() {
 			Expect(sess).To(SayError("version conflict"))
 			Expect(sess).ToNot(ExitWith(0))
 		})
+
+		Context("and -n for a specific library", func() {
+			BeforeEach(func() {
+				installCmd.Args = append(
+					[]string{installCmd.Args[0], "-n", "github.com/vito/gocart=test"},
+					installCmd.Args[1:]...,
+				)
+			})
+
+			It("installs that library's dependencies selected by the expression", func() {
+				installCmd.Dir = fakeUnlockedRepoWithRecursiveDependencies
+
+				sess := installing()
+				Expect(sess).To(Say("github.com/vito/gocart"))
+				Expect(sess).To(Say("github.com/onsi/(ginkgo|gomega)"))
+				Expect(sess).To(Say("OK"))
+				Expect(sess).To(ExitWith(0))
+			})
+		})
 	})
 
 	Context("with -x", func() {
@@ -356,6 +686,42 @@ var _ = Describe("install", func() {
 			Expect(sess).To(ExitWith(0))
 		})
 	})
+
+	Context("with -t", func() {
+		BeforeEach(func() {
+			installCmd.Args = append(
+				[]string{installCmd.Args[0], "-t", "development,!test"},
+				installCmd.Args[1:]...,
+			)
+		})
+
+		It("installs dependencies selected by the tag expression", func() {
+			installCmd.Dir = fakeUnlockedRepoWithTestDependencies
+
+			sess := installing()
+			Expect(sess).To(Say("github.com/vito/gocart"))
+			Expect(sess).To(Say("origin/master"))
+			Expect(sess).ToNot(Say("github.com/onsi/(ginkgo|gomega)"))
+			Expect(sess).To(ExitWith(0))
+		})
+	})
+
+	Context("with an invalid -t", func() {
+		BeforeEach(func() {
+			installCmd.Args = append(
+				[]string{installCmd.Args[0], "-t", "!"},
+				installCmd.Args[1:]...,
+			)
+		})
+
+		It("fails", func() {
+			installCmd.Dir = fakeUnlockedRepoWithTestDependencies
+
+			sess := installing()
+			Expect(sess).To(SayError("invalid tag expression"))
+			Expect(sess).ToNot(ExitWith(0))
+		})
+	})
 })
 
 var _ = Describe("check", func() {
@@ -487,43 +853,175 @@ var _ = Describe("check", func() {
 		})
 	})
 
-	Context("with recursive dependencies", func() {
+	Context("when the repo has diverged from the locked revision", func() {
 		BeforeEach(func() {
-			installCmd.Args = append([]string{installCmd.Args[0], "-r"}, installCmd.Args[1:]...)
-
-			installCmd.Dir = fakeUnlockedRepoWithRecursiveDependencies
-			checkCmd.Dir = fakeUnlockedRepoWithRecursiveDependencies
+			installCmd.Dir = fakeGitRepoPath
+			checkCmd.Dir = fakeGitRepoPath
 
 			install()
+
+			repoPath := path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+			checkout := exec.Command("git", "checkout", "HEAD~1")
+			checkout.Dir = repoPath
+
+			err = checkout.Run()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			commit := exec.Command(
+				"git",
+				"-c", "user.name=Someone",
+				"-c", "user.email=someone@example.com",
+				"commit", "--allow-empty", "-m", "a local commit",
+			)
+			commit.Dir = repoPath
+
+			err = commit.Run()
+			Ω(err).ShouldNot(HaveOccurred())
 		})
 
-		itCorrectlyDetectsDirtyDependency("github.com", "vito", "cmdtest")
+		It("reports how far each side is from the common ancestor", func() {
+			check := checking()
+			Expect(check).To(Say("github.com/vito/gocart"))
+			Expect(check).To(Say("diverged; .*1.* ahead, .*1.* behind"))
+			Expect(check).To(Say("a local commit"))
+			Expect(check).To(ExitWith(1))
+		})
 	})
 
-	Context("with a git dependency", func() {
+	Describe("gocart sync", func() {
+		var syncCmd *exec.Cmd
+		var repoPath string
+
+		syncing := func() *cmdtest.Session {
+			sess, err := cmdtest.StartWrapped(syncCmd, teeToStdout, teeToStdout)
+			Expect(err).ToNot(HaveOccurred())
+
+			return sess
+		}
+
 		BeforeEach(func() {
 			installCmd.Dir = fakeGitRepoPath
 			checkCmd.Dir = fakeGitRepoPath
 
+			syncCmd = exec.Command(gocartPath, "sync")
+			syncCmd.Env = installCmd.Env
+			syncCmd.Dir = fakeGitRepoPath
+
 			install()
-		})
 
-		itCorrectlyDetectsDirtyDependency("github.com", "vito", "gocart")
-	})
+			repoPath = path.Join(gopath, "src", "github.com", "vito", "gocart")
 
-	Context("with a hg dependency", func() {
-		BeforeEach(func() {
-			installCmd.Dir = fakeHgRepoPath
-			checkCmd.Dir = fakeHgRepoPath
+			checkout := exec.Command("git", "checkout", "HEAD~1")
+			checkout.Dir = repoPath
 
-			install()
+			err = checkout.Run()
+			Ω(err).ShouldNot(HaveOccurred())
 		})
 
-		itCorrectlyDetectsDirtyDependency("code.google.com", "p", "go.crypto", "ssh")
-	})
+		It("checks out the locked version of mismatched dependencies", func() {
+			sync := syncing()
+			Expect(sync).To(Say("github.com/vito/gocart.*synced to"))
+			Expect(sync).To(ExitWith(0))
 
-	Context("with a bzr dependency", func() {
-		BeforeEach(func() {
+			check := checking()
+			Expect(check).To(ExitWith(0))
+		})
+
+		Context("when a mismatched dependency has local changes", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(path.Join(repoPath, "README"), []byte("changed"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("skips it", func() {
+				sync := syncing()
+				Expect(sync).To(Say("github.com/vito/gocart.*skipped"))
+				Expect(sync).To(Say("dirty state"))
+				Expect(sync).To(ExitWith(1))
+			})
+
+			Context("with -stash", func() {
+				BeforeEach(func() {
+					syncCmd.Args = append([]string{syncCmd.Args[0], "-stash"}, syncCmd.Args[1:]...)
+				})
+
+				It("stashes the changes and syncs it", func() {
+					sync := syncing()
+					Expect(sync).To(Say("stashed local changes"))
+					Expect(sync).To(Say("synced to"))
+					Expect(sync).To(ExitWith(0))
+
+					stashes := exec.Command("git", "stash", "list")
+					stashes.Dir = repoPath
+
+					out, err := stashes.Output()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(out)).Should(ContainSubstring("gocart sync"))
+				})
+			})
+		})
+	})
+
+	Context("with recursive dependencies", func() {
+		BeforeEach(func() {
+			installCmd.Args = append([]string{installCmd.Args[0], "-r"}, installCmd.Args[1:]...)
+
+			installCmd.Dir = fakeUnlockedRepoWithRecursiveDependencies
+			checkCmd.Dir = fakeUnlockedRepoWithRecursiveDependencies
+
+			install()
+		})
+
+		itCorrectlyDetectsDirtyDependency("github.com", "vito", "cmdtest")
+
+		It("leaves out the test dependencies of dependencies' Cartridges", func() {
+			check := checking()
+			Expect(check).To(Say("github.com/vito/cmdtest"))
+			Expect(check).ToNot(Say("github.com/onsi/(ginkgo|gomega)"))
+			Expect(check).To(ExitWith(0))
+		})
+
+		Context("with -n selecting them", func() {
+			BeforeEach(func() {
+				checkCmd.Args = append(
+					[]string{checkCmd.Args[0], "-n", "github.com/vito/gocart=test"},
+					checkCmd.Args[1:]...,
+				)
+			})
+
+			It("checks them too", func() {
+				check := checking()
+				Expect(check).To(Say("github.com/onsi/(ginkgo|gomega)"))
+				Expect(check).To(ExitWith(0))
+			})
+		})
+	})
+
+	Context("with a git dependency", func() {
+		BeforeEach(func() {
+			installCmd.Dir = fakeGitRepoPath
+			checkCmd.Dir = fakeGitRepoPath
+
+			install()
+		})
+
+		itCorrectlyDetectsDirtyDependency("github.com", "vito", "gocart")
+	})
+
+	Context("with a hg dependency", func() {
+		BeforeEach(func() {
+			installCmd.Dir = fakeHgRepoPath
+			checkCmd.Dir = fakeHgRepoPath
+
+			install()
+		})
+
+		itCorrectlyDetectsDirtyDependency("code.google.com", "p", "go.crypto", "ssh")
+	})
+
+	Context("with a bzr dependency", func() {
+		BeforeEach(func() {
 			installCmd.Dir = fakeBzrRepoPath
 			checkCmd.Dir = fakeBzrRepoPath
 
@@ -534,6 +1032,183 @@ var _ = Describe("check", func() {
 	})
 })
 
+var _ = Describe("lint", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var lintCmd *exec.Cmd
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	linting := func() *cmdtest.Session {
+		sess, err := cmdtest.StartWrapped(lintCmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	writeSource := func(name, source string) {
+		err := ioutil.WriteFile(path.Join(lintCmd.Dir, name), []byte(source), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		lintCmd = exec.Command(gocartPath, "lint")
+
+		gopath, err := ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		lintCmd.Env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		lintCmd.Dir = fakeGitRepoPath
+	})
+
+	Context("when every import is covered by the Cartridge", func() {
+		BeforeEach(func() {
+			writeSource("main.go", `package main
+
+import (
+	"fmt"
+
+	"github.com/vito/gocart/set"
+)
+`)
+		})
+
+		It("exits 0", func() {
+			lint := linting()
+			Expect(lint).To(Say("OK"))
+			Expect(lint).To(ExitWith(0))
+		})
+	})
+
+	Context("when an import is not in the Cartridge", func() {
+		BeforeEach(func() {
+			writeSource("main.go", `package main
+
+import (
+	"github.com/vito/gocart/set"
+	"github.com/vito/cmdtest"
+)
+`)
+		})
+
+		It("reports it as missing", func() {
+			lint := linting()
+			Expect(lint).To(Say("missing dependencies"))
+			Expect(lint).To(Say("github.com/vito/cmdtest"))
+			Expect(lint).To(ExitWith(1))
+		})
+	})
+
+	Context("when a dependency is not imported", func() {
+		BeforeEach(func() {
+			writeSource("main.go", "package main\n")
+		})
+
+		It("reports it as unused", func() {
+			lint := linting()
+			Expect(lint).To(Say("unused dependencies"))
+			Expect(lint).To(Say("github.com/vito/gocart"))
+			Expect(lint).To(ExitWith(1))
+		})
+	})
+
+	Context("when vendored code imports something else", func() {
+		BeforeEach(func() {
+			writeSource("main.go", `package main
+
+import "github.com/vito/gocart/set"
+`)
+
+			err := os.MkdirAll(path.Join(lintCmd.Dir, "vendor", "github.com", "a", "lib"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			writeSource("vendor/github.com/a/lib/lib.go", `package lib
+
+import "github.com/b/other"
+`)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(path.Join(lintCmd.Dir, "vendor"))
+		})
+
+		It("ignores it", func() {
+			lint := linting()
+			Expect(lint).To(Say("OK"))
+			Expect(lint).To(ExitWith(0))
+		})
+	})
+
+	Context("when test dependencies are not imported", func() {
+		BeforeEach(func() {
+			lintCmd.Dir = fakeUnlockedRepoWithTestDependencies
+
+			writeSource("main.go", `package main
+
+import "github.com/vito/gocart/set"
+`)
+		})
+
+		AfterEach(func() {
+			os.Remove(path.Join(lintCmd.Dir, "main.go"))
+		})
+
+		It("reports them as unused", func() {
+			lint := linting()
+			Expect(lint).To(Say("unused dependencies"))
+			Expect(lint).To(Say("github.com/onsi/ginkgo"))
+			Expect(lint).To(ExitWith(1))
+		})
+
+		Context("with -x test", func() {
+			BeforeEach(func() {
+				lintCmd.Args = append(
+					[]string{lintCmd.Args[0], "-x", "test"},
+					lintCmd.Args[1:]...,
+				)
+			})
+
+			It("leaves them out", func() {
+				lint := linting()
+				Expect(lint).To(Say("OK"))
+				Expect(lint).To(ExitWith(0))
+			})
+		})
+	})
+
+	Context("when a dependency is only imported by tests", func() {
+		BeforeEach(func() {
+			writeSource("main_test.go", `package main_test
+
+import "github.com/vito/gocart/set"
+`)
+		})
+
+		It("reports that it should be tagged 'test'", func() {
+			lint := linting()
+			Expect(lint).To(Say("only imported by tests"))
+			Expect(lint).To(Say("github.com/vito/gocart"))
+			Expect(lint).To(ExitWith(1))
+		})
+	})
+})
+
 func gitRevision(path, rev string) *cmdtest.Session {
 	git := exec.Command("git", "rev-parse", rev)
 	git.Dir = path
@@ -544,8 +1219,18 @@ func gitRevision(path, rev string) *cmdtest.Session {
 	return sess
 }
 
+func gitRemote(path string) *cmdtest.Session {
+	git := exec.Command("git", "config", "--get", "remote.origin.url")
+	git.Dir = path
+
+	sess, err := cmdtest.Start(git)
+	Expect(err).ToNot(HaveOccurred())
+
+	return sess
+}
+
 func bzrRevision(path string) *cmdtest.Session {
-	bzr := exec.Command("bzr", "revno", "--tree")
+	bzr := exec.Command("bzr", "revision-info", "--tree")
 	bzr.Dir = path
 
 	sess, err := cmdtest.Start(bzr)
@@ -555,7 +1240,7 @@ func bzrRevision(path string) *cmdtest.Session {
 }
 
 func hgRevision(path string) *cmdtest.Session {
-	hg := exec.Command("hg", "id", "-i")
+	hg := exec.Command("hg", "log", "--template", "{node}", "-r", ".")
 	hg.Dir = path
 
 	sess, err := cmdtest.Start(hg)
@@ -575,7 +1260,8 @@ func currentBzrRevision(path string) string {
 	sess := bzrRevision(path)
 	Expect(sess).To(ExitWith(0))
 
-	return strings.Trim(string(sess.FullOutput()), "\n")
+	// revno followed by revision-id
+	return strings.Fields(string(sess.FullOutput()))[1]
 }
 
 func currentHgRevision(path string) string {
@@ -598,3 +1284,975 @@ func walkTheDinosaur(src, dest string) error {
 	cp.Stderr = os.Stderr
 	return cp.Run()
 }
+
+var _ = Describe("migrate", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var migrateCmd *exec.Cmd
+	var projectDir string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	migrating := func() *cmdtest.Session {
+		sess, err := cmdtest.StartWrapped(migrateCmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	writeFile := func(name, content string) {
+		err := ioutil.WriteFile(path.Join(projectDir, name), []byte(content), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	readFile := func(name string) string {
+		content, err := ioutil.ReadFile(path.Join(projectDir, name))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return string(content)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		projectDir, err = ioutil.TempDir(os.TempDir(), "fake_project")
+		Expect(err).ToNot(HaveOccurred())
+
+		cartridge, err := ioutil.ReadFile(path.Join(fakeDiverseRepoPath, "Cartridge"))
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile("Cartridge", string(cartridge))
+
+		writeFile("Cartridge.lock", "github.com/vito/gocart\t7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n"+
+			"code.google.com/p/go.crypto/ssh\t1e7a3e3018255d4c7fdc0a5bfb8a1a3d3d5b5b3e\n")
+
+		writeFile("main.go", `package main
+
+import (
+	"code.google.com/p/go.crypto/ssh"
+)
+
+var _ = ssh.CertTimeInfinity
+`)
+
+		migrateCmd = exec.Command(gocartPath, "migrate")
+		migrateCmd.Dir = projectDir
+		migrateCmd.Env = []string{
+			"GOPATH=" + os.Getenv("GOPATH"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectDir)
+	})
+
+	It("moves Cartridge and Cartridge.lock entries to their new paths", func() {
+		migrate := migrating()
+		Expect(migrate).To(Say("code.google.com/p/go.crypto/ssh.* -> .*golang.org/x/crypto/ssh"))
+		Expect(migrate).To(Say("kept locked version 1e7a3e3018255d4c7fdc0a5bfb8a1a3d3d5b5b3e"))
+		Expect(migrate).To(ExitWith(0))
+
+		Expect(readFile("Cartridge")).To(Equal("github.com/vito/gocart master\ngolang.org/x/crypto/ssh master\n"))
+		Expect(readFile("Cartridge.lock")).To(Equal("github.com/vito/gocart\t7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n" +
+			"golang.org/x/crypto/ssh\t1e7a3e3018255d4c7fdc0a5bfb8a1a3d3d5b5b3e\n"))
+
+		Expect(readFile("main.go")).To(ContainSubstring(`"code.google.com/p/go.crypto/ssh"`))
+	})
+
+	Context("with a revisions file", func() {
+		BeforeEach(func() {
+			writeFile("revisions", "1e7a3e3018255d4c7fdc0a5bfb8a1a3d3d5b5b3e 4d48e5fa3d62b5e6e71260571bf76c767198ca02\n")
+
+			migrateCmd.Args = []string{gocartPath, "-revisions", path.Join(projectDir, "revisions"), "migrate"}
+		})
+
+		It("translates the locked versions", func() {
+			migrate := migrating()
+			Expect(migrate).To(Say("golang.org/x/crypto/ssh.* locked to .*4d48e5fa3d62b5e6e71260571bf76c767198ca02"))
+			Expect(migrate).To(ExitWith(0))
+
+			Expect(readFile("Cartridge.lock")).To(ContainSubstring("golang.org/x/crypto/ssh\t4d48e5fa3d62b5e6e71260571bf76c767198ca02\n"))
+		})
+	})
+
+	Context("with a paths file", func() {
+		BeforeEach(func() {
+			writeFile("paths", "code.google.com/p/go.crypto/ssh github.com/someone/ssh\n")
+
+			migrateCmd.Args = []string{gocartPath, "-paths", path.Join(projectDir, "paths"), "migrate"}
+		})
+
+		It("prefers its mappings to the built-in ones", func() {
+			migrate := migrating()
+			Expect(migrate).To(ExitWith(0))
+
+			Expect(readFile("Cartridge")).To(ContainSubstring("github.com/someone/ssh master\n"))
+		})
+	})
+
+	Context("with -imports", func() {
+		BeforeEach(func() {
+			migrateCmd.Args = []string{gocartPath, "-imports", "migrate"}
+		})
+
+		It("rewrites the project's imports as well", func() {
+			migrate := migrating()
+			Expect(migrate).To(Say("rewrote imports in .*main.go"))
+			Expect(migrate).To(ExitWith(0))
+
+			Expect(readFile("main.go")).To(ContainSubstring(`"golang.org/x/crypto/ssh"`))
+		})
+
+		It("leaves vendored code alone", func() {
+			err := os.MkdirAll(path.Join(projectDir, "vendor", "github.com", "a", "lib"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			writeFile("vendor/github.com/a/lib/lib.go", `package lib
+
+import "code.google.com/p/go.crypto/ssh"
+
+var _ = ssh.CertTimeInfinity
+`)
+
+			migrate := migrating()
+			Expect(migrate).To(ExitWith(0))
+
+			Expect(readFile("vendor/github.com/a/lib/lib.go")).To(ContainSubstring(`"code.google.com/p/go.crypto/ssh"`))
+		})
+	})
+})
+
+var _ = Describe("vendor", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var env []string
+	var gopath string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = fakeLockedGitRepoPath
+		cmd.Env = env
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	vendoredPath := func() string {
+		return path.Join(fakeLockedGitRepoPath, "vendor", "github.com", "vito", "gocart")
+	}
+
+	// the first .go file in the vendored dependency
+	vendoredFile := func() string {
+		matches, err := filepath.Glob(path.Join(vendoredPath(), "*.go"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).ToNot(BeEmpty())
+
+		return filepath.Base(matches[0])
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		gopath, err = ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		install := run("install")
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(gopath)
+	})
+
+	It("exports locked dependencies into ./vendor without VCS metadata", func() {
+		vendor := run("vendor")
+		Expect(vendor).To(Say("github.com/vito/gocart.*7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+		Expect(vendor).To(ExitWith(0))
+
+		Expect(listing(vendoredPath())).To(Say(`\.go`))
+
+		_, err := os.Stat(path.Join(vendoredPath(), ".git"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		manifest, err := ioutil.ReadFile(path.Join(fakeLockedGitRepoPath, "vendor", "gocart.manifest"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(manifest)).To(ContainSubstring("github.com/vito/gocart\t7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n"))
+	})
+
+	It("exports the locked version even if another is checked out", func() {
+		dependencyPath := path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+		checkout := exec.Command("git", "checkout", "HEAD~1")
+		checkout.Dir = dependencyPath
+		Expect(checkout.Run()).ToNot(HaveOccurred())
+
+		vendor := run("vendor")
+		Expect(vendor).To(Say("7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+		Expect(vendor).To(ExitWith(0))
+	})
+
+	Context("when the dependencies are vendored", func() {
+		BeforeEach(func() {
+			vendor := run("vendor")
+			Expect(vendor).To(ExitWith(0))
+		})
+
+		It("passes check -vendor", func() {
+			check := run("check", "-vendor")
+			Expect(check).To(Say("github.com/vito/gocart.*OK"))
+			Expect(check).To(ExitWith(0))
+		})
+
+		Context("and a vendored file is changed", func() {
+			var changed string
+
+			BeforeEach(func() {
+				changed = vendoredFile()
+
+				err := ioutil.WriteFile(path.Join(vendoredPath(), changed), []byte("package changed\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("fails check -vendor", func() {
+				check := run("check", "-vendor")
+				Expect(check).To(Say("dirty state"))
+				Expect(check).To(Say("modified +" + regexp.QuoteMeta(changed)))
+				Expect(check).To(ExitWith(1))
+			})
+
+			It("is restored by vendoring again", func() {
+				vendor := run("vendor")
+				Expect(vendor).To(ExitWith(0))
+
+				check := run("check", "-vendor")
+				Expect(check).To(ExitWith(0))
+			})
+		})
+
+		Context("and Cartridge.lock is at another version", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(
+					path.Join(fakeLockedGitRepoPath, "Cartridge.lock"),
+					[]byte("github.com/vito/gocart\t3ffe9df9ab8a2d2ca44e6a8b3a1e3cd5c2ab3e71\n"),
+					0644,
+				)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("fails check -vendor", func() {
+				check := run("check", "-vendor")
+				Expect(check).To(Say("vendored version mismatch"))
+				Expect(check).To(ExitWith(1))
+			})
+		})
+
+		Context("and Cartridge.lock has the version abbreviated, as older releases locked it", func() {
+			var lock []byte
+
+			BeforeEach(func() {
+				var err error
+
+				lock, err = ioutil.ReadFile(path.Join(fakeLockedGitRepoPath, "Cartridge.lock"))
+				Expect(err).ToNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "Cartridge.lock"), []byte("github.com/vito/gocart\t7c9d1a95d4b7\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				err := ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "Cartridge.lock"), lock, 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("passes check -vendor", func() {
+				check := run("check", "-vendor")
+				Expect(check).ToNot(Say("vendored version mismatch"))
+				Expect(check).To(ExitWith(0))
+			})
+		})
+
+		Context("and the dependency is left out with -x", func() {
+			var cartridge []byte
+
+			BeforeEach(func() {
+				var err error
+
+				cartridge, err = ioutil.ReadFile(path.Join(fakeLockedGitRepoPath, "Cartridge"))
+				Expect(err).ToNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "Cartridge"), []byte("github.com/vito/gocart master integration\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				err := ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "Cartridge"), cartridge, 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("does not report it as no longer locked", func() {
+				check := run("check", "-vendor", "-x", "integration")
+				Expect(check).ToNot(Say("vendored, but not in Cartridge.lock"))
+				Expect(check).To(ExitWith(0))
+			})
+		})
+
+		Context("and a dependency is removed from Cartridge.lock", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "Cartridge"), []byte(""), 0644)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "Cartridge.lock"), []byte(""), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("fails check -vendor", func() {
+				check := run("check", "-vendor")
+				Expect(check).To(Say("vendored, but not in Cartridge.lock"))
+				Expect(check).To(ExitWith(1))
+			})
+
+			It("is removed by vendoring again", func() {
+				vendor := run("vendor")
+				Expect(vendor).To(Say("github.com/vito/gocart removed"))
+				Expect(vendor).To(ExitWith(0))
+
+				_, err := os.Stat(path.Join(fakeLockedGitRepoPath, "vendor", "github.com"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+})
+
+var _ = Describe("export", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var env []string
+	var gopath string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = fakeLockedGitRepoPath
+		cmd.Env = env
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	exported := func(file string) string {
+		content, err := ioutil.ReadFile(path.Join(fakeLockedGitRepoPath, file))
+		Expect(err).ToNot(HaveOccurred())
+
+		return string(content)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		gopath, err = ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		install := run("install")
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(gopath)
+	})
+
+	It("writes Gopkg.lock with the locked revisions", func() {
+		export := run("export", "-format", "dep")
+		Expect(export).To(Say("wrote Gopkg.lock"))
+		Expect(export).To(ExitWith(0))
+
+		Expect(exported("Gopkg.lock")).To(ContainSubstring(`name = "github.com/vito/gocart"`))
+		Expect(exported("Gopkg.lock")).To(ContainSubstring(`revision = "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"`))
+	})
+
+	It("writes glide.lock with the locked revisions", func() {
+		export := run("export", "-format", "glide")
+		Expect(export).To(ExitWith(0))
+
+		Expect(exported("glide.lock")).To(ContainSubstring("- name: github.com/vito/gocart\n  version: 7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n"))
+	})
+
+	Context("when the project has a go.mod", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(path.Join(fakeLockedGitRepoPath, "go.mod"), []byte("module example.com/fake\n\ngo 1.20\n\nreplace example.com/lib => ../lib\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("keeps its other directives", func() {
+			export := run("export", "-format", "gomod")
+			Expect(export).To(ExitWith(0))
+
+			Expect(exported("go.mod")).To(ContainSubstring("\ngo 1.20\n"))
+			Expect(exported("go.mod")).To(ContainSubstring("\nreplace example.com/lib => ../lib\n"))
+		})
+
+		It("rewrites it with a pseudo-version for each dependency", func() {
+			export := run("export", "-format", "gomod")
+			Expect(export).To(ExitWith(0))
+
+			Expect(exported("go.mod")).To(MatchRegexp(`^module example.com/fake\n`))
+			Expect(exported("go.mod")).To(MatchRegexp(`\tgithub.com/vito/gocart v0\.0\.0-\d{14}-7c9d1a95d4b7\n`))
+		})
+	})
+
+	Context("when the project is outside of GOPATH and has no go.mod", func() {
+		It("fails to write go.mod", func() {
+			export := run("export", "-format", "gomod")
+			Expect(export).To(Say("import path"))
+			Expect(export).To(ExitWith(1))
+		})
+	})
+
+	Context("with an unknown format", func() {
+		It("fails", func() {
+			export := run("export", "-format", "bogus")
+			Expect(export).To(Say("unknown export format 'bogus'"))
+			Expect(export).To(ExitWith(1))
+		})
+	})
+})
+
+var _ = Describe("import", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var projectPath string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = projectPath
+		cmd.Env = []string{
+			"GOPATH=" + projectPath,
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		projectPath, err = ioutil.TempDir(os.TempDir(), "fake_project")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = os.MkdirAll(path.Join(projectPath, "Godeps"), 0755)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = ioutil.WriteFile(path.Join(projectPath, "Godeps", "Godeps.json"), []byte(`{
+	"ImportPath": "example.com/project",
+	"Deps": [
+		{"ImportPath": "github.com/vito/gocart/set", "Rev": "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"},
+		{"ImportPath": "github.com/vito/gocart/dependency", "Rev": "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"}
+	]
+}`), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(projectPath)
+	})
+
+	It("writes Cartridge and Cartridge.lock for each repository", func() {
+		imported := run("import", "Godeps/Godeps.json")
+		Expect(imported).To(Say("github.com/vito/gocart.*7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+		Expect(imported).To(ExitWith(0))
+
+		cartridge, err := ioutil.ReadFile(path.Join(projectPath, "Cartridge"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(cartridge)).To(Equal("github.com/vito/gocart\t7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n"))
+
+		lock, err := ioutil.ReadFile(path.Join(projectPath, "Cartridge.lock"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(lock)).To(Equal("github.com/vito/gocart\t7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n"))
+	})
+
+	Context("when there is already a Cartridge", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(path.Join(projectPath, "Cartridge"), []byte("github.com/vito/other master\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("refuses to replace it", func() {
+			imported := run("import", "Godeps/Godeps.json")
+			Expect(imported).To(Say("Cartridge already exists"))
+			Expect(imported).To(ExitWith(1))
+		})
+
+		It("replaces it with -force", func() {
+			imported := run("import", "-force", "Godeps/Godeps.json")
+			Expect(imported).To(ExitWith(0))
+
+			cartridge, err := ioutil.ReadFile(path.Join(projectPath, "Cartridge"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(cartridge)).To(ContainSubstring("github.com/vito/gocart"))
+		})
+	})
+})
+
+var _ = Describe("licenses", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var env []string
+	var gopath string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = fakeLockedGitRepoPath
+		cmd.Env = env
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		gopath, err = ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		install := run("install")
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+
+		err = ioutil.WriteFile(path.Join(gopath, "src", "github.com", "vito", "gocart", "LICENSE"), []byte(`Copyright (c) 2014 Alex Suraci
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software").
+`), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(gopath)
+	})
+
+	It("lists the license of each dependency", func() {
+		licenses := run("licenses")
+		Expect(licenses).To(Say(`github.com/vito/gocart.*MIT.*LICENSE`))
+		Expect(licenses).To(ExitWith(0))
+	})
+
+	It("lists them as JSON", func() {
+		licenses := run("licenses", "-format", "json")
+		Expect(licenses).To(Say(`"path": "github.com/vito/gocart"`))
+		Expect(licenses).To(Say(`"license": "MIT"`))
+		Expect(licenses).To(ExitWith(0))
+	})
+
+	It("fails when a license is denied", func() {
+		licenses := run("licenses", "-deny-licenses", "GPL-*,MIT")
+		Expect(licenses).To(Say("github.com/vito/gocart: MIT is not allowed"))
+		Expect(licenses).To(ExitWith(1))
+	})
+})
+
+var _ = Describe("sbom", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var env []string
+	var gopath string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = fakeLockedGitRepoPath
+		cmd.Env = env
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		gopath, err = ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		install := run("install")
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(gopath)
+	})
+
+	It("describes each dependency in SPDX", func() {
+		sbom := run("sbom", "-format", "spdx-json")
+		Expect(sbom).To(Say(`"spdxVersion": "SPDX-2.3"`))
+		Expect(sbom).To(Say(`"name": "github.com/vito/gocart"`))
+		Expect(sbom).To(Say(`"versionInfo": "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"`))
+		Expect(sbom).To(Say(`"relationshipType": "DEPENDS_ON"`))
+		Expect(sbom).To(ExitWith(0))
+	})
+
+	It("describes each dependency in CycloneDX", func() {
+		sbom := run("sbom", "-format", "cyclonedx-json")
+		Expect(sbom).To(Say(`"bomFormat": "CycloneDX"`))
+		Expect(sbom).To(Say(`"purl": "pkg:golang/github.com/vito/gocart@7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"`))
+		Expect(sbom).To(ExitWith(0))
+	})
+
+	It("reads licenses from the locked revision rather than the checkout", func() {
+		checkoutPath := path.Join(gopath, "src", "github.com", "vito", "gocart")
+
+		err := ioutil.WriteFile(path.Join(checkoutPath, "LICENSE-WTFPL"), []byte("DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		sbom := run("sbom", "-format", "spdx-json")
+		Expect(sbom).To(Say(`"name": "github.com/vito/gocart"`))
+		Expect(sbom).ToNot(Say("WTFPL"))
+		Expect(sbom).To(ExitWith(0))
+	})
+
+	It("fails for an unknown format", func() {
+		sbom := run("sbom", "-format", "spdx-tv")
+		Expect(sbom).To(Say("unknown sbom format 'spdx-tv'"))
+		Expect(sbom).To(ExitWith(1))
+	})
+})
+
+var _ = Describe("audit", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var env []string
+	var gopath string
+	var advisoryDir string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = fakeLockedGitRepoPath
+		cmd.Env = env
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		gopath, err = ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		advisoryDir, err = ioutil.TempDir(os.TempDir(), "fake_advisories")
+		Expect(err).ToNot(HaveOccurred())
+
+		env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+
+		install := run("install")
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(gopath)
+		os.RemoveAll(advisoryDir)
+	})
+
+	It("reports dependencies locked to an affected revision", func() {
+		err := ioutil.WriteFile(path.Join(advisoryDir, "gocart.json"), []byte(`{
+  "id": "GOCART-2014-0001",
+  "path": "github.com/vito/gocart",
+  "description": "Something is wrong.",
+  "affected": [{"introduced": "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"}]
+}`), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		audit := run("audit", "-advisories", advisoryDir)
+		Expect(audit).To(Say("GOCART-2014-0001"))
+		Expect(audit).To(Say("Something is wrong."))
+		Expect(audit).To(Say("no fix available"))
+		Expect(audit).To(ExitWith(1))
+	})
+
+	It("passes when the locked revision is fixed", func() {
+		err := ioutil.WriteFile(path.Join(advisoryDir, "gocart.json"), []byte(`{
+  "id": "GOCART-2014-0002",
+  "path": "github.com/vito/gocart",
+  "affected": [{"fixed": "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"}]
+}`), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		audit := run("audit", "-advisories", advisoryDir)
+		Expect(audit).To(Say("OK"))
+		Expect(audit).To(ExitWith(0))
+	})
+})
+
+var _ = Describe("policy", func() {
+	gocartPath, err := cmdtest.Build("github.com/vito/gocart")
+	if err != nil {
+		panic(err)
+	}
+
+	// TODO: move to cmdtest
+	err = os.Chmod(gocartPath, 0755)
+	if err != nil {
+		panic(err)
+	}
+
+	var env []string
+	var gopath string
+	var policyFile string
+
+	teeToStdout := func(w io.Writer) io.Writer {
+		return io.MultiWriter(w, os.Stdout)
+	}
+
+	run := func(args ...string) *cmdtest.Session {
+		cmd := exec.Command(gocartPath, args...)
+		cmd.Dir = fakeLockedGitRepoPath
+		cmd.Env = env
+
+		sess, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		return sess
+	}
+
+	writePolicy := func(rules string) {
+		err := ioutil.WriteFile(policyFile, []byte(rules), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		gopath, err = ioutil.TempDir(os.TempDir(), "fake_repo_GOPATH")
+		Expect(err).ToNot(HaveOccurred())
+
+		policyFile = path.Join(gopath, "Cartridge.policy")
+
+		env = []string{
+			"GOPATH=" + gopath,
+			"GOROOT=" + os.Getenv("GOROOT"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(gopath)
+	})
+
+	It("passes when every rule is followed", func() {
+		writePolicy("allow-host github.com\ndeny bleeding-edge\ndeny unlocked\n")
+
+		check := run("-policy", policyFile, "policy", "check")
+		Expect(check).To(Say("OK"))
+		Expect(check).To(ExitWith(0))
+	})
+
+	It("reports each violation with the Cartridge line it comes from", func() {
+		writePolicy("allow-host golang.org\ndeny branches\n")
+
+		install := run("install")
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+
+		check := run("-policy", policyFile, "policy", "check")
+		Expect(check).To(SayError("Cartridge:1: github.com/vito/gocart: host github.com is not allowed"))
+		Expect(check).To(SayError("Cartridge:1: github.com/vito/gocart: 'master' is a branch"))
+		Expect(check).To(SayError("2 policy violations"))
+		Expect(check).To(ExitWith(1))
+	})
+
+	It("refuses to install with -strict when the policy is violated", func() {
+		writePolicy("deny branches\n")
+
+		install := run("-policy", policyFile, "-strict", "install")
+		Expect(install).To(SayError("'master' is a branch"))
+		Expect(install).To(SayError("refusing to install dependencies that violate the policy"))
+		Expect(install).To(ExitWith(1))
+	})
+
+	It("installs with -strict when unlocked dependencies are denied but nothing is locked yet", func() {
+		writePolicy("deny unlocked\n")
+
+		projectPath := path.Join(gopath, "project")
+
+		err := os.MkdirAll(projectPath, 0755)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = ioutil.WriteFile(path.Join(projectPath, "Cartridge"), []byte("github.com/vito/gocart 7c9d1a95d4b7979bc4180d4cb4aebfc036f276de\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		cmd := exec.Command(gocartPath, "-policy", policyFile, "-strict", "install")
+		cmd.Dir = projectPath
+		cmd.Env = env
+
+		install, err := cmdtest.StartWrapped(cmd, teeToStdout, teeToStdout)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(install).To(Say("OK"))
+		Expect(install).To(ExitWith(0))
+
+		_, err = os.Stat(path.Join(projectPath, "Cartridge.lock"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("when a rewrite fetches from a host that is not allowed", func() {
+		var mirrorPath string
+
+		BeforeEach(func() {
+			writePolicy("allow-host github.com\n")
+
+			install := run("install")
+			Expect(install).To(Say("OK"))
+			Expect(install).To(ExitWith(0))
+
+			mirrorPath = path.Join(gopath, "mirror", "gocart")
+
+			clone := exec.Command("git", "clone", path.Join(gopath, "src", "github.com", "vito", "gocart"), mirrorPath)
+			err := clone.Run()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("refuses to install with -strict, checking the lock that would be saved", func() {
+			lockPath := path.Join(fakeLockedGitRepoPath, "Cartridge.lock")
+
+			lock, err := ioutil.ReadFile(lockPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			install := run("-policy", policyFile, "-strict", "-rewrite", "github.com/vito/gocart="+mirrorPath, "install")
+			Expect(install).To(SayError("Cartridge.lock:1: github.com/vito/gocart: remote host " + mirrorPath + " is not allowed"))
+			Expect(install).To(SayError("refusing to install dependencies that violate the policy"))
+			Expect(install).To(ExitWith(1))
+
+			Expect(ioutil.ReadFile(lockPath)).To(Equal(lock))
+		})
+	})
+})
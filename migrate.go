@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/vito/gocart/imports"
+	"github.com/vito/gocart/migration"
+	"github.com/vito/gocart/set"
+)
+
+func migrate(root string, pathsFile string, revisionsFile string, rewriteImports bool) {
+	mappings := migration.Mappings{}
+
+	if pathsFile != "" {
+		userMappings, err := migration.LoadMappings(pathsFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		// given first so that they win over built-in mappings for the same path
+		mappings = append(mappings, userMappings...)
+	}
+
+	mappings = append(mappings, migration.Builtin...)
+
+	revisions := migration.Revisions{}
+
+	if revisionsFile != "" {
+		var err error
+
+		revisions, err = migration.LoadRevisions(revisionsFile)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	cartridgePath := filepath.Join(root, CartridgeFile)
+	lockPath := filepath.Join(root, CartridgeLockFile)
+
+	if _, err := os.Stat(cartridgePath); err != nil {
+		fatal(set.NoCartridgeError)
+	}
+
+	cartridge, cartridgeChanges := migrateFile(cartridgePath, mappings, revisions)
+
+	var lock []byte
+	var lockChanges []migration.Change
+
+	_, err := os.Stat(lockPath)
+	hasLock := err == nil
+
+	if hasLock {
+		lock, lockChanges = migrateFile(lockPath, mappings, revisions)
+	}
+
+	for _, change := range cartridgeChanges {
+		fmt.Println(bold(change.OldPath), "->", bold(change.NewPath))
+
+		if change.NewVersion != change.OldVersion {
+			fmt.Println(indent(1, change.OldVersion+" -> "+cyan(change.NewVersion)))
+		}
+	}
+
+	for _, change := range lockChanges {
+		if change.Untranslated {
+			fmt.Println(
+				bold(change.NewPath),
+				red("kept locked version "+change.OldVersion+", which may not exist in the new repository"),
+			)
+		} else if change.NewVersion != change.OldVersion {
+			fmt.Println(bold(change.NewPath), "locked to", cyan(change.NewVersion))
+		}
+	}
+
+	if len(cartridgeChanges) == 0 && len(lockChanges) == 0 {
+		fmt.Println("no dependencies to migrate")
+	}
+
+	writeFile(cartridgePath, cartridge)
+
+	if hasLock {
+		writeFile(lockPath, lock)
+	}
+
+	if rewriteImports {
+		rewritten, err := imports.Rewrite(root, mappings.Migrate)
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, path := range rewritten {
+			fmt.Println("rewrote imports in", path)
+		}
+	}
+}
+
+// migrates the Cartridge or Cartridge.lock, making sure it is still valid
+func migrateFile(path string, mappings migration.Mappings, revisions migration.Revisions) ([]byte, []migration.Change) {
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatal(err)
+	}
+
+	migrated, changes := migration.Rewrite(original, mappings, revisions)
+
+	err = (&set.Set{}).UnmarshalText(migrated)
+	if err != nil {
+		fatal(fmt.Sprintf("migrating %s would leave it invalid: %s", path, err))
+	}
+
+	return migrated, changes
+}
+
+func writeFile(path string, contents []byte) {
+	info, err := os.Stat(path)
+	if err != nil {
+		fatal(err)
+	}
+
+	err = ioutil.WriteFile(path, contents, info.Mode().Perm())
+	if err != nil {
+		fatal(err)
+	}
+}
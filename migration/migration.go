@@ -0,0 +1,239 @@
+package migration
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// a package that moved from Old to New, along with everything beneath it
+type Mapping struct {
+	Old string
+	New string
+}
+
+type Mappings []Mapping
+
+// well-known moves, mostly away from code.google.com
+var Builtin = Mappings{
+	{"code.google.com/p/go.crypto", "golang.org/x/crypto"},
+	{"code.google.com/p/go.net", "golang.org/x/net"},
+	{"code.google.com/p/go.text", "golang.org/x/text"},
+	{"code.google.com/p/go.tools", "golang.org/x/tools"},
+	{"code.google.com/p/go.image", "golang.org/x/image"},
+	{"code.google.com/p/go.exp", "golang.org/x/exp"},
+	{"code.google.com/p/go.blog", "golang.org/x/blog"},
+	{"code.google.com/p/go.talks", "golang.org/x/talks"},
+	{"code.google.com/p/go.codereview", "golang.org/x/review"},
+	{"code.google.com/p/goprotobuf", "github.com/golang/protobuf"},
+	{"code.google.com/p/gogoprotobuf", "github.com/gogo/protobuf"},
+	{"code.google.com/p/gomock", "github.com/golang/mock"},
+	{"code.google.com/p/snappy-go/snappy", "github.com/golang/snappy"},
+	{"code.google.com/p/go-uuid/uuid", "github.com/pborman/uuid"},
+	{"launchpad.net/gocheck", "gopkg.in/check.v1"},
+}
+
+// versions to translate from an old repository to its new one, e.g. hg node
+// ids to git commit ids
+type Revisions map[string]string
+
+// hg's default branch names, which mean nothing to git
+var hgBranches = map[string]string{
+	"tip":     "master",
+	"default": "master",
+}
+
+type InvalidLineError struct {
+	Source string
+	Line   int
+	Text   string
+}
+
+func (e InvalidLineError) Error() string {
+	return fmt.Sprintf("%s:%d: expected 'old new', got '%s'", e.Source, e.Line, e.Text)
+}
+
+// a Cartridge entry that was migrated
+type Change struct {
+	OldPath    string
+	NewPath    string
+	OldVersion string
+	NewVersion string
+
+	// set when the version could not be translated for the new repository
+	Untranslated bool
+}
+
+// reads 'old new' pairs, one per line; '#' starts a comment
+func LoadMappings(path string) (Mappings, error) {
+	mappings := Mappings{}
+
+	err := readPairs(path, func(old, new string) {
+		mappings = append(mappings, Mapping{
+			Old: strings.Trim(old, "/"),
+			New: strings.Trim(new, "/"),
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// reads 'old-version new-version' pairs, one per line; '#' starts a comment
+func LoadRevisions(path string) (Revisions, error) {
+	revisions := Revisions{}
+
+	err := readPairs(path, func(old, new string) {
+		revisions[old] = new
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// the new path for an import path, from the mapping with the longest
+// matching prefix; the earliest wins a tie
+func (mappings Mappings) Migrate(importPath string) (string, bool) {
+	var best Mapping
+
+	found := false
+
+	for _, mapping := range mappings {
+		if !strings.HasPrefix(importPath+"/", mapping.Old+"/") {
+			continue
+		}
+
+		if !found || len(mapping.Old) > len(best.Old) {
+			best = mapping
+			found = true
+		}
+	}
+
+	if !found {
+		return "", false
+	}
+
+	return best.New + strings.TrimPrefix(importPath, best.Old), true
+}
+
+// the version in the new repository; either may be abbreviated (e.g. by
+// 'hg id' or an older release's lock), so they match when one is a prefix of
+// the other
+func (revisions Revisions) Translate(version string) (string, bool) {
+	if translated, found := revisions[version]; found {
+		return translated, true
+	}
+
+	for old, translated := range revisions {
+		if len(old) < 12 || len(version) < 12 {
+			continue
+		}
+
+		if strings.HasPrefix(old, version) || strings.HasPrefix(version, old) {
+			return translated, true
+		}
+	}
+
+	if translated, found := hgBranches[version]; found {
+		return translated, true
+	}
+
+	return "", false
+}
+
+var entryPattern = regexp.MustCompile(`^(\s*)(\S+)(\s+)(\S+)(.*)$`)
+
+// rewrites the paths and versions of the entries in a Cartridge or
+// Cartridge.lock, leaving everything else (tags, comments, spacing) as-is
+func Rewrite(cartridge []byte, mappings Mappings, revisions Revisions) ([]byte, []Change) {
+	lines := strings.SplitAfter(string(cartridge), "\n")
+
+	changes := []Change{}
+
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		match := entryPattern.FindStringSubmatch(strings.TrimSuffix(line, "\n"))
+		if match == nil {
+			continue
+		}
+
+		path, version := match[2], match[4]
+
+		newPath, migrated := mappings.Migrate(path)
+		if !migrated {
+			continue
+		}
+
+		change := Change{
+			OldPath:    path,
+			NewPath:    newPath,
+			OldVersion: version,
+			NewVersion: version,
+		}
+
+		if version != "*" && !strings.HasPrefix(version, "#") {
+			translated, found := revisions.Translate(version)
+			if found {
+				change.NewVersion = translated
+			} else {
+				change.Untranslated = true
+			}
+		}
+
+		lines[i] = match[1] + newPath + match[3] + change.NewVersion + match[5]
+		if strings.HasSuffix(line, "\n") {
+			lines[i] += "\n"
+		}
+
+		changes = append(changes, change)
+	}
+
+	return []byte(strings.Join(lines, "")), changes
+}
+
+func readPairs(path string, pair func(string, string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return InvalidLineError{
+				Source: path,
+				Line:   line,
+				Text:   text,
+			}
+		}
+
+		pair(fields[0], fields[1])
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,194 @@
+package migration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vito/gocart/migration"
+)
+
+var _ = Describe("Migration", func() {
+	var mappings Mappings
+
+	BeforeEach(func() {
+		mappings = Mappings{
+			{Old: "code.google.com/p/go.crypto", New: "golang.org/x/crypto"},
+			{Old: "code.google.com/p/go.crypto/ssh/terminal", New: "github.com/someone/terminal"},
+		}
+	})
+
+	Describe("Migrate", func() {
+		It("moves paths beneath the mapping's old path", func() {
+			newPath, found := mappings.Migrate("code.google.com/p/go.crypto")
+			Ω(found).Should(BeTrue())
+			Ω(newPath).Should(Equal("golang.org/x/crypto"))
+
+			newPath, found = mappings.Migrate("code.google.com/p/go.crypto/ssh")
+			Ω(found).Should(BeTrue())
+			Ω(newPath).Should(Equal("golang.org/x/crypto/ssh"))
+		})
+
+		It("uses the mapping with the longest old path", func() {
+			newPath, found := mappings.Migrate("code.google.com/p/go.crypto/ssh/terminal")
+			Ω(found).Should(BeTrue())
+			Ω(newPath).Should(Equal("github.com/someone/terminal"))
+		})
+
+		It("only matches whole path segments", func() {
+			_, found := mappings.Migrate("code.google.com/p/go.cryptography")
+			Ω(found).Should(BeFalse())
+		})
+
+		It("knows well-known moves", func() {
+			newPath, found := Builtin.Migrate("code.google.com/p/go.net/websocket")
+			Ω(found).Should(BeTrue())
+			Ω(newPath).Should(Equal("golang.org/x/net/websocket"))
+		})
+	})
+
+	Describe("Translate", func() {
+		revisions := Revisions{
+			"1e7a3e301825bf9cb32e0535f4761d3d2e6d5a18": "4d48e5fa3d62b5e6e71260571bf76c767198ca02",
+		}
+
+		It("translates known revisions", func() {
+			translated, found := revisions.Translate("1e7a3e301825bf9cb32e0535f4761d3d2e6d5a18")
+			Ω(found).Should(BeTrue())
+			Ω(translated).Should(Equal("4d48e5fa3d62b5e6e71260571bf76c767198ca02"))
+		})
+
+		It("translates abbreviated revisions", func() {
+			translated, found := revisions.Translate("1e7a3e301825")
+			Ω(found).Should(BeTrue())
+			Ω(translated).Should(Equal("4d48e5fa3d62b5e6e71260571bf76c767198ca02"))
+		})
+
+		It("translates revisions that abbreviated ones were given for", func() {
+			abbreviated := Revisions{"1e7a3e301825": "4d48e5fa3d62b5e6e71260571bf76c767198ca02"}
+
+			translated, found := abbreviated.Translate("1e7a3e301825bf9cb32e0535f4761d3d2e6d5a18")
+			Ω(found).Should(BeTrue())
+			Ω(translated).Should(Equal("4d48e5fa3d62b5e6e71260571bf76c767198ca02"))
+		})
+
+		It("translates hg's default branch names to master", func() {
+			for _, branch := range []string{"tip", "default"} {
+				translated, found := revisions.Translate(branch)
+				Ω(found).Should(BeTrue())
+				Ω(translated).Should(Equal("master"))
+			}
+		})
+
+		It("does not translate unknown revisions", func() {
+			_, found := revisions.Translate("deadbeefdeadbeef")
+			Ω(found).Should(BeFalse())
+
+			_, found = revisions.Translate("1e7a")
+			Ω(found).Should(BeFalse())
+		})
+	})
+
+	Describe("Rewrite", func() {
+		revisions := Revisions{
+			"1e7a3e301825bf9cb32e0535f4761d3d2e6d5a18": "4d48e5fa3d62b5e6e71260571bf76c767198ca02",
+		}
+
+		It("rewrites moved entries, keeping everything else", func() {
+			cartridge := "# crypto\ncode.google.com/p/go.crypto/ssh\ttip\ttest\ngithub.com/vito/gocart master\n\n"
+
+			migrated, changes := Rewrite([]byte(cartridge), mappings, revisions)
+
+			Ω(string(migrated)).Should(Equal("# crypto\ngolang.org/x/crypto/ssh\tmaster\ttest\ngithub.com/vito/gocart master\n\n"))
+
+			Ω(changes).Should(Equal([]Change{
+				{
+					OldPath:    "code.google.com/p/go.crypto/ssh",
+					NewPath:    "golang.org/x/crypto/ssh",
+					OldVersion: "tip",
+					NewVersion: "master",
+				},
+			}))
+		})
+
+		It("translates locked versions, keeping attributes", func() {
+			lock := "code.google.com/p/go.crypto/ssh\t1e7a3e301825bf9cb32e0535f4761d3d2e6d5a18\tremote=https://example.com\n"
+
+			migrated, _ := Rewrite([]byte(lock), mappings, revisions)
+
+			Ω(string(migrated)).Should(Equal("golang.org/x/crypto/ssh\t4d48e5fa3d62b5e6e71260571bf76c767198ca02\tremote=https://example.com\n"))
+		})
+
+		It("reports versions it could not translate, leaving them as they were", func() {
+			lock := "code.google.com/p/go.crypto/ssh\t0123456789abcdef0123456789abcdef01234567\n"
+
+			migrated, changes := Rewrite([]byte(lock), mappings, revisions)
+
+			Ω(string(migrated)).Should(Equal("golang.org/x/crypto/ssh\t0123456789abcdef0123456789abcdef01234567\n"))
+
+			Ω(changes).Should(HaveLen(1))
+			Ω(changes[0].Untranslated).Should(BeTrue())
+		})
+
+		It("leaves bleeding-edge versions alone", func() {
+			migrated, changes := Rewrite([]byte("code.google.com/p/go.crypto/ssh *\n"), mappings, revisions)
+
+			Ω(string(migrated)).Should(Equal("golang.org/x/crypto/ssh *\n"))
+			Ω(changes[0].Untranslated).Should(BeFalse())
+		})
+	})
+
+	Describe("loading files", func() {
+		var tmpdir string
+
+		BeforeEach(func() {
+			var err error
+
+			tmpdir, err = ioutil.TempDir("", "gocart-migration")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpdir)
+		})
+
+		It("reads mappings from 'old new' lines", func() {
+			path := filepath.Join(tmpdir, "paths")
+
+			err := ioutil.WriteFile(path, []byte("# moves\ncode.google.com/p/foo/  github.com/someone/foo\n\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			loaded, err := LoadMappings(path)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(loaded).Should(Equal(Mappings{
+				{Old: "code.google.com/p/foo", New: "github.com/someone/foo"},
+			}))
+		})
+
+		It("reads revisions from 'old new' lines", func() {
+			path := filepath.Join(tmpdir, "revisions")
+
+			err := ioutil.WriteFile(path, []byte("abc123 def456\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			loaded, err := LoadRevisions(path)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(loaded).Should(Equal(Revisions{"abc123": "def456"}))
+		})
+
+		It("fails on lines without two fields", func() {
+			path := filepath.Join(tmpdir, "paths")
+
+			err := ioutil.WriteFile(path, []byte("a b\nc\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = LoadMappings(path)
+			Ω(err).Should(Equal(InvalidLineError{Source: path, Line: 2, Text: "c"}))
+		})
+	})
+})
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vito/gocart/policy"
+	"github.com/vito/gocart/repository"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+func checkPolicy(root string, filter tags.Filter, nested *tags.NestedFilters) {
+	rules, err := loadPolicy(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	violations, err := policyViolations(rules, root, nil, filter, nested)
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(violations) > 0 {
+		reportViolations(violations)
+		os.Exit(1)
+	}
+
+	fmt.Println(green("OK"))
+}
+
+// reads the policy file given with -policy, or the one in the root
+func loadPolicy(root string) (*policy.Policy, error) {
+	policyPath := *policyFile
+	if policyPath == "" {
+		policyPath = filepath.Join(root, policy.DefaultFile)
+	}
+
+	rules, err := policy.Load(policyPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no policy file at %s; write one or give another with -policy", policyPath)
+	}
+
+	return rules, err
+}
+
+// evaluates the policy over the dependencies declared in Cartridge and those
+// of their Cartridges in turn, as far as they are installed
+//
+// when given, resolved is checked in place of the root's Cartridge.lock, e.g.
+// while installing, before it is saved
+func policyViolations(rules *policy.Policy, root string, resolved *set.Set, filter tags.Filter, nested *tags.NestedFilters) ([]policy.Violation, error) {
+	if _, err := os.Stat(filepath.Join(root, CartridgeFile)); err != nil {
+		return nil, set.NoCartridgeError
+	}
+
+	nodes := []policy.Node{}
+
+	err := collectPolicyNodes(&nodes, map[string]bool{}, root, resolved, filter, nested)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules.Check(nodes)
+}
+
+func reportViolations(violations []policy.Violation) {
+	for _, violation := range violations {
+		fmt.Fprintln(os.Stderr, red(violation.Error()))
+	}
+
+	if len(violations) == 1 {
+		fmt.Fprintln(os.Stderr, "1 policy violation")
+	} else {
+		fmt.Fprintf(os.Stderr, "%d policy violations\n", len(violations))
+	}
+}
+
+func collectPolicyNodes(nodes *[]policy.Node, visited map[string]bool, dir string, resolved *set.Set, filter tags.Filter, nested *tags.NestedFilters) error {
+	cartridgePath := filepath.Join(dir, CartridgeFile)
+
+	declared, err := set.ReadFile(cartridgePath)
+	if err != nil {
+		return err
+	}
+
+	declaredLines, err := set.Lines(cartridgePath)
+	if err != nil {
+		return err
+	}
+
+	lockPath := filepath.Join(dir, CartridgeLockFile)
+
+	locked := &set.Set{}
+	lockedLines := map[string]int{}
+
+	if resolved != nil {
+		locked = resolved
+
+		// each dependency is written on its own line
+		for i, dep := range resolved.Dependencies {
+			lockedLines[dep.Path] = i + 1
+		}
+	} else if _, err := os.Stat(lockPath); err == nil {
+		locked, err = set.ReadFile(lockPath)
+		if err != nil {
+			return err
+		}
+
+		lockedLines, err = set.Lines(lockPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dep := range declared.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		node := policy.Node{
+			Declared: policy.Declaration{
+				Dependency: dep,
+				File:       cartridgePath,
+				Line:       declaredLines[dep.Path],
+			},
+		}
+
+		for _, ldep := range locked.Dependencies {
+			if ldep.Path == dep.Path {
+				node.Locked = &policy.Declaration{
+					Dependency: ldep,
+					File:       lockPath,
+					Line:       lockedLines[ldep.Path],
+				}
+			}
+		}
+
+		repoPath := dep.FullPath(GOPATH)
+
+		if _, err := os.Stat(repoPath); err == nil {
+			repo, err := repository.New(repoPath, Runner)
+			if err != nil {
+				return err
+			}
+
+			if branchRepo, ok := repo.(repository.BranchRepository); ok {
+				node.Repository = branchRepo
+			}
+		}
+
+		*nodes = append(*nodes, node)
+
+		if visited[repoPath] {
+			continue
+		}
+
+		visited[repoPath] = true
+
+		if _, err := os.Stat(filepath.Join(repoPath, CartridgeFile)); err != nil {
+			continue
+		}
+
+		err = collectPolicyNodes(nodes, visited, repoPath, nil, nested.For(dep.Path), nested)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
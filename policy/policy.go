@@ -0,0 +1,264 @@
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/vito/gocart/config"
+	"github.com/vito/gocart/dependency"
+)
+
+// read from the project's root directory
+const DefaultFile = "Cartridge.policy"
+
+// the things that 'deny' rules may forbid
+const (
+	BleedingEdge = "bleeding-edge"
+	Unlocked     = "unlocked"
+	Branches     = "branches"
+)
+
+type Policy struct {
+	// where the rules were read from
+	Source string
+
+	// patterns for the hosts dependencies may come from, e.g. 'github.com'
+	// or '*.example.com'; any host if there are none
+	AllowedHosts []string
+
+	Denied []string
+}
+
+type UnknownRuleError struct {
+	Source string
+	Line   int
+	Text   string
+}
+
+func (e UnknownRuleError) Error() string {
+	return fmt.Sprintf(
+		"%s:%d: unknown rule '%s'; expected 'allow-host <host>' or 'deny %s|%s|%s'",
+		e.Source,
+		e.Line,
+		e.Text,
+		BleedingEdge,
+		Unlocked,
+		Branches,
+	)
+}
+
+// a line in a Cartridge or Cartridge.lock
+type Declaration struct {
+	Dependency dependency.Dependency
+
+	File string
+	Line int
+}
+
+// the part of a repository needed to tell branches from tags and commits
+type BranchRepository interface {
+	IsBranch(name string) (bool, error)
+}
+
+// a dependency in the graph, as declared in a Cartridge and locked
+type Node struct {
+	Declared Declaration
+
+	// the entry in the Cartridge.lock alongside, if any
+	Locked *Declaration
+
+	// the dependency's checkout, if installed and able to tell
+	Repository BranchRepository
+}
+
+type Violation struct {
+	File string
+	Line int
+
+	Path string
+	Rule string
+
+	Message string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", v.File, v.Line, v.Path, v.Message, v.Rule)
+}
+
+// reads the policy file; it is an error for it not to exist
+func Load(file string) (*Policy, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+
+	rules, err := config.Load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{Source: file}
+
+	for _, rule := range rules.Settings {
+		switch rule.Name {
+		case "allow-host":
+			policy.AllowedHosts = append(policy.AllowedHosts, strings.Fields(rule.Value)...)
+		case "deny":
+			switch rule.Value {
+			case BleedingEdge, Unlocked, Branches:
+				policy.Denied = append(policy.Denied, rule.Value)
+			default:
+				return nil, UnknownRuleError{file, rule.Line, rule.Name + " " + rule.Value}
+			}
+		default:
+			return nil, UnknownRuleError{file, rule.Line, rule.Name + " " + rule.Value}
+		}
+	}
+
+	return policy, nil
+}
+
+func (p *Policy) Denies(thing string) bool {
+	for _, denied := range p.Denied {
+		if denied == thing {
+			return true
+		}
+	}
+
+	return false
+}
+
+// a copy of the policy that no longer denies the thing
+func (p *Policy) Allowing(thing string) *Policy {
+	allowing := *p
+	allowing.Denied = []string{}
+
+	for _, denied := range p.Denied {
+		if denied != thing {
+			allowing.Denied = append(allowing.Denied, denied)
+		}
+	}
+
+	return &allowing
+}
+
+// every violation of the policy, in the order of the nodes
+func (p *Policy) Check(nodes []Node) ([]Violation, error) {
+	violations := []Violation{}
+
+	for _, node := range nodes {
+		nodeViolations, err := p.checkNode(node)
+		if err != nil {
+			return nil, err
+		}
+
+		violations = append(violations, nodeViolations...)
+	}
+
+	return violations, nil
+}
+
+func (p *Policy) checkNode(node Node) ([]Violation, error) {
+	violations := []Violation{}
+
+	violation := func(at Declaration, rule string, message string) {
+		violations = append(violations, Violation{
+			File:    at.File,
+			Line:    at.Line,
+			Path:    at.Dependency.Path,
+			Rule:    rule,
+			Message: message,
+		})
+	}
+
+	declared := node.Declared.Dependency
+
+	if len(p.AllowedHosts) > 0 {
+		hostRule := "allow-host"
+
+		if host := importHost(declared.Path); !p.allowsHost(host) {
+			violation(node.Declared, hostRule, "host "+host+" is not allowed")
+		}
+
+		if host := urlHost(declared.Archive); declared.Archive != "" && !p.allowsHost(host) {
+			violation(node.Declared, hostRule, "archive host "+host+" is not allowed")
+		}
+
+		if node.Locked != nil {
+			locked := node.Locked.Dependency
+
+			if host := urlHost(locked.Remote); locked.Remote != "" && !p.allowsHost(host) {
+				violation(*node.Locked, hostRule, "remote host "+host+" is not allowed")
+			}
+
+			if host := urlHost(locked.Archive); locked.Archive != "" && locked.Archive != declared.Archive && !p.allowsHost(host) {
+				violation(*node.Locked, hostRule, "archive host "+host+" is not allowed")
+			}
+		}
+	}
+
+	if p.Denies(BleedingEdge) && declared.BleedingEdge {
+		violation(node.Declared, "deny "+BleedingEdge, "'*' follows the latest version")
+	}
+
+	if p.Denies(Unlocked) && node.Locked == nil {
+		violation(node.Declared, "deny "+Unlocked, "not locked in Cartridge.lock")
+	}
+
+	if p.Denies(Branches) && node.Repository != nil {
+		declarations := []Declaration{node.Declared}
+		if node.Locked != nil {
+			declarations = append(declarations, *node.Locked)
+		}
+
+		for _, declaration := range declarations {
+			dep := declaration.Dependency
+
+			if dep.BleedingEdge || dep.Archive != "" {
+				continue
+			}
+
+			isBranch, err := node.Repository.IsBranch(dep.Version)
+			if err != nil {
+				return nil, err
+			}
+
+			if isBranch {
+				violation(declaration, "deny "+Branches, "'"+dep.Version+"' is a branch; use a tag or commit")
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+func (p *Policy) allowsHost(host string) bool {
+	for _, pattern := range p.AllowedHosts {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// e.g. github.com for github.com/a/b
+func importHost(importPath string) string {
+	return strings.SplitN(importPath, "/", 2)[0]
+}
+
+// the host of a URL, including scp-like git URLs such as git@host:path
+func urlHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err == nil && parsed.Host != "" {
+		return parsed.Hostname()
+	}
+
+	if at := strings.Index(rawURL, "@"); at != -1 {
+		rawURL = rawURL[at+1:]
+	}
+
+	return strings.SplitN(rawURL, ":", 2)[0]
+}
@@ -0,0 +1,182 @@
+package policy_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/policy"
+)
+
+type fakeBranches []string
+
+func (b fakeBranches) IsBranch(name string) (bool, error) {
+	for _, branch := range b {
+		if branch == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func declared(dep dependency.Dependency, line int) policy.Declaration {
+	return policy.Declaration{Dependency: dep, File: "Cartridge", Line: line}
+}
+
+func locked(dep dependency.Dependency, line int) *policy.Declaration {
+	return &policy.Declaration{Dependency: dep, File: "Cartridge.lock", Line: line}
+}
+
+var _ = Describe("Policy", func() {
+	Describe("Load", func() {
+		var policyFile string
+
+		write := func(content string) {
+			err := ioutil.WriteFile(policyFile, []byte(content), 0644)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "policy")
+			Expect(err).ToNot(HaveOccurred())
+
+			file.Close()
+
+			policyFile = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(policyFile)
+		})
+
+		It("reads each rule", func() {
+			write("# release branches\nallow-host github.com\nallow-host *.example.com golang.org\ndeny bleeding-edge\ndeny branches\n")
+
+			rules, err := policy.Load(policyFile)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(rules.AllowedHosts).To(Equal([]string{"github.com", "*.example.com", "golang.org"}))
+			Expect(rules.Denies(policy.BleedingEdge)).To(BeTrue())
+			Expect(rules.Denies(policy.Branches)).To(BeTrue())
+			Expect(rules.Denies(policy.Unlocked)).To(BeFalse())
+		})
+
+		It("reports unknown rules with their line", func() {
+			write("deny unlocked\ndeny everything\n")
+
+			_, err := policy.Load(policyFile)
+			Expect(err).To(Equal(policy.UnknownRuleError{
+				Source: policyFile,
+				Line:   2,
+				Text:   "deny everything",
+			}))
+		})
+
+		It("fails when the file does not exist", func() {
+			_, err := policy.Load(policyFile + "-missing")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("Allowing", func() {
+		It("returns a copy that no longer denies the thing", func() {
+			rules := &policy.Policy{
+				AllowedHosts: []string{"github.com"},
+				Denied:       []string{policy.BleedingEdge, policy.Unlocked},
+			}
+
+			allowing := rules.Allowing(policy.Unlocked)
+			Expect(allowing.AllowedHosts).To(Equal([]string{"github.com"}))
+			Expect(allowing.Denies(policy.BleedingEdge)).To(BeTrue())
+			Expect(allowing.Denies(policy.Unlocked)).To(BeFalse())
+
+			Expect(rules.Denies(policy.Unlocked)).To(BeTrue())
+		})
+	})
+
+	Describe("Check", func() {
+		It("allows anything without rules", func() {
+			violations, err := (&policy.Policy{}).Check([]policy.Node{
+				{Declared: declared(dependency.Dependency{Path: "example.com/a", BleedingEdge: true}, 1)},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("reports dependencies from hosts that are not allowed", func() {
+			rules := &policy.Policy{AllowedHosts: []string{"github.com", "*.example.com"}}
+
+			violations, err := rules.Check([]policy.Node{
+				{
+					Declared: declared(dependency.Dependency{Path: "github.com/a/b", Version: "v1"}, 1),
+					Locked:   locked(dependency.Dependency{Path: "github.com/a/b", Version: "abc", Remote: "git@evil.com:a/b.git"}, 3),
+				},
+				{
+					Declared: declared(dependency.Dependency{Path: "git.example.com/c", Version: "v2"}, 2),
+				},
+				{
+					Declared: declared(dependency.Dependency{Path: "bitbucket.org/d/e", Version: "v3"}, 4),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(violations).To(Equal([]policy.Violation{
+				{File: "Cartridge.lock", Line: 3, Path: "github.com/a/b", Rule: "allow-host", Message: "remote host evil.com is not allowed"},
+				{File: "Cartridge", Line: 4, Path: "bitbucket.org/d/e", Rule: "allow-host", Message: "host bitbucket.org is not allowed"},
+			}))
+		})
+
+		It("reports bleeding-edge and unlocked dependencies", func() {
+			rules := &policy.Policy{Denied: []string{policy.BleedingEdge, policy.Unlocked}}
+
+			violations, err := rules.Check([]policy.Node{
+				{
+					Declared: declared(dependency.Dependency{Path: "github.com/a/b", BleedingEdge: true}, 1),
+					Locked:   locked(dependency.Dependency{Path: "github.com/a/b", Version: "abc"}, 1),
+				},
+				{
+					Declared: declared(dependency.Dependency{Path: "github.com/c/d", Version: "v1"}, 2),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(violations).To(HaveLen(2))
+			Expect(violations[0].Rule).To(Equal("deny bleeding-edge"))
+			Expect(violations[0].Line).To(Equal(1))
+			Expect(violations[1].Rule).To(Equal("deny unlocked"))
+			Expect(violations[1].Path).To(Equal("github.com/c/d"))
+		})
+
+		It("reports branch names in Cartridge and Cartridge.lock", func() {
+			rules := &policy.Policy{Denied: []string{policy.Branches}}
+
+			violations, err := rules.Check([]policy.Node{
+				{
+					Declared:   declared(dependency.Dependency{Path: "github.com/a/b", Version: "master"}, 1),
+					Locked:     locked(dependency.Dependency{Path: "github.com/a/b", Version: "develop"}, 2),
+					Repository: fakeBranches{"master", "develop"},
+				},
+				{
+					Declared:   declared(dependency.Dependency{Path: "github.com/c/d", Version: "v1.0"}, 2),
+					Repository: fakeBranches{"master"},
+				},
+				{
+					// not installed, so nothing can be told
+					Declared: declared(dependency.Dependency{Path: "github.com/e/f", Version: "master"}, 3),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(violations).To(Equal([]policy.Violation{
+				{File: "Cartridge", Line: 1, Path: "github.com/a/b", Rule: "deny branches", Message: "'master' is a branch; use a tag or commit"},
+				{File: "Cartridge.lock", Line: 2, Path: "github.com/a/b", Rule: "deny branches", Message: "'develop' is a branch; use a tag or commit"},
+			}))
+
+			Expect(violations[0].Error()).To(Equal("Cartridge:1: github.com/a/b: 'master' is a branch; use a tag or commit (deny branches)"))
+		})
+	})
+})
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vito/gocart/archive"
+)
+
+// an unpacked archive; its version is the archive's checksum, and it can only
+// be changed by fetching a different archive
+type ArchiveRepository struct {
+	path string
+}
+
+// returned when asked to check out a version other than the current one
+var ReadOnlyRepositoryError = errors.New("archive dependencies can only be changed by installing a different archive")
+
+func (r *ArchiveRepository) Checkout(version string) error {
+	current, err := r.CurrentVersion()
+	if err != nil {
+		return err
+	}
+
+	if version != current {
+		return ReadOnlyRepositoryError
+	}
+
+	return nil
+}
+
+// copies the unpacked files, leaving out the manifest
+func (r *ArchiveRepository) Export(version string, dest string) error {
+	err := r.Checkout(version)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(r.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(r.path, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == archive.ManifestFile {
+			return nil
+		}
+
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+// there is nothing to fetch; the archive is all there is
+func (r *ArchiveRepository) Update() error {
+	return nil
+}
+
+func (r *ArchiveRepository) CurrentVersion() (string, error) {
+	manifest, err := archive.ReadManifest(r.path)
+	if err != nil {
+		return "", err
+	}
+
+	return manifest.Version, nil
+}
+
+func (r *ArchiveRepository) ResolveVersion(version string) (string, error) {
+	if !strings.HasPrefix(version, archive.ChecksumPrefix) {
+		return "", archive.InvalidChecksumError{Checksum: version}
+	}
+
+	return version, nil
+}
+
+func (r *ArchiveRepository) Status() ([]FileStatus, error) {
+	manifest, err := archive.ReadManifest(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	modified, missing, untracked, err := manifest.Verify(r.path)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []FileStatus{}
+
+	for _, path := range modified {
+		statuses = append(statuses, FileStatus{Path: path, State: Modified})
+	}
+
+	for _, path := range missing {
+		statuses = append(statuses, FileStatus{Path: path, State: Missing})
+	}
+
+	for _, path := range untracked {
+		statuses = append(statuses, FileStatus{Path: path, State: Untracked})
+	}
+
+	return statuses, nil
+}
+
+// archives have no history; different checksums are unrelated
+func (r *ArchiveRepository) Log(from, to string) ([]Commit, error) {
+	if from == to {
+		return []Commit{}, nil
+	}
+
+	return nil, NoCommonAncestorError
+}
+
+func (r *ArchiveRepository) IsAncestor(ancestor, descendant string) (bool, error) {
+	return ancestor == descendant, nil
+}
+
+func (r *ArchiveRepository) MergeBase(a, b string) (string, error) {
+	if a == b {
+		return a, nil
+	}
+
+	return "", NoCommonAncestorError
+}
+
+func copyFile(from string, to string, mode os.FileMode) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+
+	defer source.Close()
+
+	dest, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dest, source)
+
+	closeErr := dest.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
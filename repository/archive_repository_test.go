@@ -0,0 +1,118 @@
+package repository_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/archive"
+	"github.com/vito/gocart/command_runner/fake_command_runner"
+	"github.com/vito/gocart/repository"
+)
+
+var _ = Describe("an archive repository", func() {
+	var repoPath string
+	var repo repository.Repository
+
+	BeforeEach(func() {
+		var err error
+
+		repoPath, err = ioutil.TempDir(os.TempDir(), "archive_repo")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(repoPath, "lib.go"), []byte("package lib\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = archive.WriteManifest(repoPath, "sha256:abc", "https://example.com/lib.tar.gz")
+		Expect(err).ToNot(HaveOccurred())
+
+		repo, err = repository.New(repoPath, fake_command_runner.New())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(repoPath)
+	})
+
+	It("is identified by its manifest", func() {
+		_, correctType := repo.(*repository.ArchiveRepository)
+		Expect(correctType).To(BeTrue())
+	})
+
+	It("is versioned by the archive's checksum", func() {
+		version, err := repo.CurrentVersion()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version).To(Equal("sha256:abc"))
+	})
+
+	It("can only be checked out at its current version", func() {
+		Expect(repo.Checkout("sha256:abc")).ToNot(HaveOccurred())
+		Expect(repo.Checkout("sha256:def")).To(Equal(repository.ReadOnlyRepositoryError))
+	})
+
+	It("shares no history with other versions", func() {
+		_, err := repo.MergeBase("sha256:abc", "sha256:def")
+		Expect(err).To(Equal(repository.NoCommonAncestorError))
+	})
+
+	Describe("Export", func() {
+		var exportDir string
+		var dest string
+
+		BeforeEach(func() {
+			var err error
+
+			exportDir, err = ioutil.TempDir(os.TempDir(), "archive_export")
+			Expect(err).ToNot(HaveOccurred())
+
+			dest = filepath.Join(exportDir, "export")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(exportDir)
+		})
+
+		It("copies the files without the manifest", func() {
+			err := repo.(repository.ExportRepository).Export("sha256:abc", dest)
+			Expect(err).ToNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(dest, "lib.go"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("package lib\n"))
+
+			_, err = os.Stat(filepath.Join(dest, archive.ManifestFile))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("cannot export another version", func() {
+			err := repo.(repository.ExportRepository).Export("sha256:def", dest)
+			Expect(err).To(Equal(repository.ReadOnlyRepositoryError))
+		})
+	})
+
+	Describe("Status", func() {
+		It("is clean when nothing has changed", func() {
+			statuses, err := repo.Status()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statuses).To(BeEmpty())
+		})
+
+		It("reports files changed since the archive was unpacked", func() {
+			err := ioutil.WriteFile(filepath.Join(repoPath, "lib.go"), []byte("package changed\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(repoPath, "new.go"), []byte("package lib\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			statuses, err := repo.Status()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(statuses).To(Equal([]repository.FileStatus{
+				{Path: "lib.go", State: repository.Modified},
+				{Path: "new.go", State: repository.Untracked},
+			}))
+		})
+	})
+})
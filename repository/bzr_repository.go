@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/vito/gocart/command_runner"
 )
@@ -35,40 +37,250 @@ func (repo *BzrRepository) LogCommand(from, to string) *exec.Cmd {
 }
 
 func (r *BzrRepository) Checkout(version string) error {
-	return r.runner.Run(r.bzrCmd("update", "-r", version))
+	return r.runner.Run(r.bzrCmd("update", "-r", revisionSpec(version)))
 }
 
+// the revision-id of the working tree; unlike revnos, these identify the
+// same revision on every branch
 func (r *BzrRepository) CurrentVersion() (string, error) {
-	cmd := r.bzrCmd("revno", "--tree")
+	return r.revisionID("--tree")
+}
+
+func (r *BzrRepository) ResolveVersion(version string) (string, error) {
+	return r.revisionID("-r", revisionSpec(version))
+}
+
+func (r *BzrRepository) Export(version string, dest string) error {
+	return r.runner.Run(r.bzrCmd("export", "-r", revisionSpec(version), dest))
+}
+
+func (r *BzrRepository) Update() error {
+	return r.runner.Run(r.bzrCmd("pull"))
+}
 
-	out, err := r.cmdOutput(cmd)
+// the branch's parent, which 'bzr pull' uses by default
+func (r *BzrRepository) Remote() (string, error) {
+	out, err := r.cmdOutput(r.bzrCmd("config", "parent_location"))
 	if err != nil {
 		return "", err
 	}
 
-	return strings.TrimRight(out, "\n"), nil
+	return strings.TrimSpace(out), nil
 }
 
-func (r *BzrRepository) Update() error {
-	return r.runner.Run(r.bzrCmd("pull"))
+func (r *BzrRepository) SetRemote(url string) error {
+	return r.runner.Run(r.bzrCmd("config", "parent_location="+url))
 }
 
-func (r *BzrRepository) Status() (string, error) {
-	out, err := r.cmdOutput(r.bzrCmd("status"))
+func (r *BzrRepository) Stash(message string) error {
+	return r.runner.Run(r.bzrCmd("shelve", "--all", "-m", message))
+}
+
+func (r *BzrRepository) Status() ([]FileStatus, error) {
+	out, err := r.cmdOutput(r.bzrCmd("status", "--short"))
 	if err != nil {
-		return out, err
+		return nil, err
 	}
 
-	return strings.Replace(
-		out,
-		"working tree is out of date, run 'bzr update'\n",
-		"",
-		1,
-	), nil
+	statuses := []FileStatus{}
+
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 5 || line == "working tree is out of date, run 'bzr update'" {
+			continue
+		}
+
+		path := strings.TrimSpace(line[4:])
+
+		// renames show as 'from => to'
+		if arrow := strings.Index(path, " => "); arrow != -1 {
+			path = path[arrow+4:]
+		}
+
+		statuses = append(statuses, FileStatus{
+			Path:  path,
+			State: bzrFileState(line[0], line[1]),
+		})
+	}
+
+	return statuses, nil
 }
 
-func (r *BzrRepository) Log(from, to string) (string, error) {
-	return r.cmdOutput(r.bzrCmd("log", "--line", "-r", fmt.Sprintf("%s..%s", from, to)))
+// unlike git's from..to, bzr's from..to includes 'from' itself, so it is
+// looked up and excluded explicitly
+func (r *BzrRepository) Log(from, to string) ([]Commit, error) {
+	fromCommits, err := r.log(revisionSpec(from))
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := r.log(fmt.Sprintf("%s..%s", revisionSpec(from), revisionSpec(to)))
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{}
+	for _, commit := range fromCommits {
+		excluded[commit.ID] = true
+	}
+
+	log := []Commit{}
+
+	for _, commit := range commits {
+		if !excluded[commit.ID] {
+			log = append(log, commit)
+		}
+	}
+
+	return log, nil
+}
+
+// ancestry follows each version's left-hand (mainline) history
+func (r *BzrRepository) Commit(version string) (Commit, error) {
+	commits, err := r.log(revisionSpec(version))
+	if err != nil {
+		return Commit{}, err
+	}
+
+	if len(commits) != 1 {
+		return Commit{}, fmt.Errorf("no revision %s", version)
+	}
+
+	return commits[0], nil
+}
+
+func (r *BzrRepository) IsAncestor(ancestor, descendant string) (bool, error) {
+	ancestorCommits, err := r.log(revisionSpec(ancestor))
+	if err != nil {
+		return false, err
+	}
+
+	mainline, err := r.log("1.." + revisionSpec(descendant))
+	if err != nil {
+		return false, err
+	}
+
+	for _, commit := range mainline {
+		for _, ancestorCommit := range ancestorCommits {
+			if commit.ID == ancestorCommit.ID {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (r *BzrRepository) MergeBase(a, b string) (string, error) {
+	mainlineA, err := r.log("1.." + revisionSpec(a))
+	if err != nil {
+		return "", err
+	}
+
+	mainlineB, err := r.log("1.." + revisionSpec(b))
+	if err != nil {
+		return "", err
+	}
+
+	inB := map[string]bool{}
+	for _, commit := range mainlineB {
+		inB[commit.ID] = true
+	}
+
+	// logs are newest-first, so the first shared revision is the most recent
+	for _, commit := range mainlineA {
+		if inB[commit.ID] {
+			return commit.ID, nil
+		}
+	}
+
+	return "", NoCommonAncestorError
+}
+
+func (r *BzrRepository) log(revisions string) ([]Commit, error) {
+	out, err := r.cmdOutput(r.bzrCmd("log", "--long", "--show-ids", "-n1", "-r", revisions))
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+
+	var commit *Commit
+	inMessage := false
+
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "------------") {
+			if commit != nil {
+				commits = append(commits, *commit)
+			}
+
+			commit = &Commit{}
+			inMessage = false
+
+			continue
+		}
+
+		if commit == nil {
+			continue
+		}
+
+		if inMessage {
+			if commit.Subject == "" {
+				commit.Subject = strings.TrimSpace(line)
+			}
+
+			continue
+		}
+
+		segments := strings.SplitN(line, ": ", 2)
+		if len(segments) != 2 {
+			if strings.TrimSpace(line) == "message:" {
+				inMessage = true
+			}
+
+			continue
+		}
+
+		value := strings.TrimSpace(segments[1])
+
+		switch strings.TrimSpace(segments[0]) {
+		case "revno":
+			commit.ShortID = strings.Fields(value)[0]
+		case "revision-id":
+			commit.ID = value
+		case "committer":
+			if commit.Author == "" {
+				commit.Author = value
+			}
+		case "author":
+			commit.Author = value
+		case "timestamp":
+			date, err := time.Parse("Mon 2006-01-02 15:04:05 -0700", value)
+			if err == nil {
+				commit.Date = date.UTC()
+			}
+		}
+	}
+
+	if commit != nil {
+		commits = append(commits, *commit)
+	}
+
+	return commits, nil
+}
+
+// 'bzr revision-info' prints the revno followed by the revision-id
+func (r *BzrRepository) revisionID(args ...string) (string, error) {
+	out, err := r.cmdOutput(r.bzrCmd(append([]string{"revision-info"}, args...)...))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected output from bzr revision-info: %q", out)
+	}
+
+	return fields[1], nil
 }
 
 func (r *BzrRepository) bzrCmd(args ...string) *exec.Cmd {
@@ -82,7 +294,6 @@ func (r *BzrRepository) cmdOutput(cmd *exec.Cmd) (string, error) {
 	buf := new(bytes.Buffer)
 
 	cmd.Stdout = buf
-	cmd.Stderr = buf
 
 	err := r.runner.Run(cmd)
 	if err != nil {
@@ -91,3 +302,61 @@ func (r *BzrRepository) cmdOutput(cmd *exec.Cmd) (string, error) {
 
 	return string(buf.Bytes()), nil
 }
+
+// the first column of 'bzr status --short' describes versioning changes, and
+// the second describes content changes
+func bzrFileState(versioning, content byte) FileState {
+	switch versioning {
+	case '+':
+		return Added
+	case '-':
+		return Deleted
+	case 'R':
+		return Renamed
+	case '?':
+		return Untracked
+	case 'X':
+		return Missing
+	case 'C':
+		return Conflicted
+	}
+
+	switch content {
+	case 'N':
+		return Added
+	case 'D':
+		return Deleted
+	default:
+		return Modified
+	}
+}
+
+var bzrRevno = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)*$`)
+
+// turns a locked version into a revision specifier; versions are either
+// revision-ids, revnos locked by older releases, explicit specifiers such as
+// 'tag:v1' or 'revno:1', or names such as tags, left to bzr to look up
+func revisionSpec(version string) string {
+	if bzrRevno.MatchString(version) {
+		return version
+	}
+
+	prefixes := []string{
+		"revid:", "revno:", "tag:", "date:", "last:", "before:", "ancestor:",
+		"branch:", "submit:", "mainline:", "annotate:",
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(version, prefix) {
+			return version
+		}
+	}
+
+	// e.g. someone@example.com-20140101000000-abc, or svn-v4:... for
+	// imported branches, which bzr would take for a specifier
+	if strings.ContainsAny(version, "@:") {
+		return "revid:" + version
+	}
+
+	return version
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -42,14 +43,43 @@ var _ = Describe("BzrRepository", func() {
 	})
 
 	Describe("Checkout", func() {
-		It("runs bzr update -r", func() {
-			err := bzrRepo.Checkout("some-ref")
+		It("runs bzr update -r with the revision-id", func() {
+			err := bzrRepo.Checkout("someone@example.com-20140101000000-abc")
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(runner).To(HaveExecutedSerially(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("bzr").Path,
-					Args: []string{"update", "-r", "some-ref"},
+					Args: []string{"update", "-r", "revid:someone@example.com-20140101000000-abc"},
+					Dir:  repoPath,
+				},
+			))
+		})
+
+		It("passes revnos, explicit revision specifiers and tags through", func() {
+			err := bzrRepo.Checkout("42")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = bzrRepo.Checkout("tag:v1")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = bzrRepo.Checkout("v1.0")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"update", "-r", "42"},
+					Dir:  repoPath,
+				},
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"update", "-r", "tag:v1"},
+					Dir:  repoPath,
+				},
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"update", "-r", "v1.0"},
 					Dir:  repoPath,
 				},
 			))
@@ -62,7 +92,7 @@ var _ = Describe("BzrRepository", func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("bzr").Path,
-						Args: []string{"update", "-r", "some-ref"},
+						Args: []string{"update", "-r", "42"},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -70,7 +100,7 @@ var _ = Describe("BzrRepository", func() {
 			})
 
 			It("returns the error", func() {
-				err := bzrRepo.Checkout("some-ref")
+				err := bzrRepo.Checkout("42")
 				Expect(err).To(HaveOccurred())
 
 				Expect(err).To(Equal(disaster))
@@ -79,13 +109,13 @@ var _ = Describe("BzrRepository", func() {
 	})
 
 	Describe("CurrentVersion", func() {
-		It("runs bzr revno --tree and returns its output", func() {
+		It("returns the revision-id of the working tree", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("bzr").Path,
-					Args: []string{"revno", "--tree"},
+					Args: []string{"revision-info", "--tree"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
+					cmd.Stdout.Write([]byte("2 someone@example.com-20140101000000-abc\n"))
 					return nil
 				},
 			)
@@ -93,17 +123,17 @@ var _ = Describe("BzrRepository", func() {
 			ver, err := bzrRepo.CurrentVersion()
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(ver).To(Equal("abc"))
+			Expect(ver).To(Equal("someone@example.com-20140101000000-abc"))
 		})
 
-		Context("when bzr revno --tree fails", func() {
+		Context("when bzr revision-info fails", func() {
 			disaster := errors.New("oh no!")
 
 			BeforeEach(func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("bzr").Path,
-						Args: []string{"revno", "--tree"},
+						Args: []string{"revision-info", "--tree"},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -119,6 +149,25 @@ var _ = Describe("BzrRepository", func() {
 		})
 	})
 
+	Describe("ResolveVersion", func() {
+		It("returns the revision-id of a revno", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"revision-info", "-r", "2"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("2 someone@example.com-20140101000000-abc\n"))
+					return nil
+				},
+			)
+
+			ver, err := bzrRepo.ResolveVersion("2")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ver).To(Equal("someone@example.com-20140101000000-abc"))
+		})
+	})
+
 	Describe("Update", func() {
 		It("runs bzr pull", func() {
 			err := bzrRepo.Update()
@@ -156,15 +205,107 @@ var _ = Describe("BzrRepository", func() {
 		})
 	})
 
+	Describe("Export", func() {
+		It("runs bzr export at the revision", func() {
+			err := bzrRepo.Export("someone@example.com-20140101000000-abc", "/some/dest")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"export", "-r", "revid:someone@example.com-20140101000000-abc", "/some/dest"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
+	Describe("Stash", func() {
+		It("runs bzr shelve on all changes", func() {
+			err := bzrRepo.Stash("some message")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"shelve", "--all", "-m", "some message"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
+	Describe("Remote", func() {
+		It("returns the branch's parent", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"config", "parent_location"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("bzr+ssh://bazaar.launchpad.net/+branch/gocheck/\n"))
+					return nil
+				},
+			)
+
+			remote, err := bzrRepo.Remote()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(remote).To(Equal("bzr+ssh://bazaar.launchpad.net/+branch/gocheck/"))
+		})
+	})
+
+	Describe("SetRemote", func() {
+		It("changes the branch's parent", func() {
+			err := bzrRepo.SetRemote("https://bzr.example.com/gocheck")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"config", "parent_location=https://bzr.example.com/gocheck"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
 	Describe("Status", func() {
-		It("runs bzr status and returns its output", func() {
+		It("runs bzr status --short and parses each file's state", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"status", "--short"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(" M  modified\n"))
+					cmd.Stdout.Write([]byte("+N  added\n"))
+					cmd.Stdout.Write([]byte("-D  removed\n"))
+					cmd.Stdout.Write([]byte("R   old => renamed\n"))
+					cmd.Stdout.Write([]byte("C   conflicted\n"))
+					cmd.Stdout.Write([]byte("?   untracked file\n"))
+					return nil
+				},
+			)
+
+			status, err := bzrRepo.Status()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+				{"added", Added},
+				{"removed", Deleted},
+				{"renamed", Renamed},
+				{"conflicted", Conflicted},
+				{"untracked file", Untracked},
+			}))
+		})
+
+		It("does not mistake warnings on stderr for files", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("bzr").Path,
-					Args: []string{"status"},
+					Args: []string{"status", "--short"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
-					cmd.Stderr.Write([]byte("def\n"))
+					cmd.Stdout.Write([]byte(" M  modified\n"))
+					cmd.Stderr.Write([]byte("bzr: warning: some compiled extensions could not be loaded; see ``bzr help missing-extensions``\n"))
 					return nil
 				},
 			)
@@ -172,7 +313,9 @@ var _ = Describe("BzrRepository", func() {
 			status, err := bzrRepo.Status()
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(status).To(Equal("abc\ndef\n"))
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+			}))
 		})
 
 		Context("when bzr status fails", func() {
@@ -182,7 +325,7 @@ var _ = Describe("BzrRepository", func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("bzr").Path,
-						Args: []string{"status"},
+						Args: []string{"status", "--short"},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -202,41 +345,83 @@ var _ = Describe("BzrRepository", func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("bzr").Path,
-						Args: []string{"status"},
+						Args: []string{"status", "--short"},
 					}, func(cmd *exec.Cmd) error {
 						cmd.Stdout.Write([]byte("working tree is out of date, run 'bzr update'\n"))
-						cmd.Stderr.Write([]byte("abc\n"))
 						return nil
 					},
 				)
 			})
 
-			It("strips it from the output", func() {
+			It("does not consider it a modification", func() {
 				status, err := bzrRepo.Status()
 				Expect(err).ToNot(HaveOccurred())
 
-				Expect(status).To(Equal("abc\n"))
+				Expect(status).To(BeEmpty())
 			})
 		})
 	})
 
 	Describe("Log", func() {
-		It("runs bzr log --line -r OLD..NEW and returns its output", func() {
+		BeforeEach(func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "revid:old@example.com-1"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 1
+revision-id: someone@example.com-20131231000000-old
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Tue 2013-12-31 00:00:00 +0000
+message:
+  old commit
+`))
+					return nil
+				},
+			)
+		})
+
+		It("runs bzr log from OLD to NEW, excluding OLD, and parses each commit", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("bzr").Path,
-					Args: []string{"log", "--line", "-r", "OLD..NEW"},
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "revid:old@example.com-1..revid:new@example.com-2"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
-					cmd.Stderr.Write([]byte("def\n"))
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 2 [merge]
+revision-id: someone@example.com-20140101010000-new
+committer: Someone <someone@example.com>
+author: Someone Else <else@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 01:00:00 +0100
+message:
+  new commit
+
+  with a body
+------------------------------------------------------------
+revno: 1
+revision-id: someone@example.com-20131231000000-old
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Tue 2013-12-31 00:00:00 +0000
+message:
+  old commit
+`))
 					return nil
 				},
 			)
 
-			log, err := bzrRepo.Log("OLD", "NEW")
+			log, err := bzrRepo.Log("old@example.com-1", "new@example.com-2")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(log).To(Equal("abc\ndef\n"))
+			Expect(log).To(HaveLen(1))
+			Expect(log[0].ID).To(Equal("someone@example.com-20140101010000-new"))
+			Expect(log[0].ShortID).To(Equal("2"))
+			Expect(log[0].Author).To(Equal("Someone Else <else@example.com>"))
+			Expect(log[0].Date).To(Equal(time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)))
+			Expect(log[0].Subject).To(Equal("new commit"))
 		})
 
 		Context("when bzr log fails", func() {
@@ -246,7 +431,7 @@ var _ = Describe("BzrRepository", func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("bzr").Path,
-						Args: []string{"log", "--line", "-r", "OLD..NEW"},
+						Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "revid:old@example.com-1..revid:new@example.com-2"},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -254,11 +439,189 @@ var _ = Describe("BzrRepository", func() {
 			})
 
 			It("returns the error", func() {
-				_, err := bzrRepo.Log("OLD", "NEW")
+				_, err := bzrRepo.Log("old@example.com-1", "new@example.com-2")
 				Expect(err).To(HaveOccurred())
 
 				Expect(err).To(Equal(disaster))
 			})
 		})
 	})
+
+	Describe("Commit", func() {
+		It("runs bzr log on the version and parses the commit", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "revid:new@example.com-2"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 2
+revision-id: someone@example.com-20140101010000-new
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 01:00:00 +0100
+message:
+  new commit
+`))
+					return nil
+				},
+			)
+
+			commit, err := bzrRepo.Commit("new@example.com-2")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(commit.ID).To(Equal("someone@example.com-20140101010000-new"))
+			Expect(commit.Date).To(Equal(time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)))
+			Expect(commit.Subject).To(Equal("new commit"))
+		})
+
+		Context("when bzr log fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("bzr").Path,
+						Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "revid:new@example.com-2"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := bzrRepo.Commit("new@example.com-2")
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("ancestry", func() {
+		BeforeEach(func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "2"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 2
+revision-id: rev-2
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 2
+`))
+					return nil
+				},
+			)
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "1..3"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 3
+revision-id: rev-3
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 3
+------------------------------------------------------------
+revno: 2
+revision-id: rev-2
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 2
+------------------------------------------------------------
+revno: 1
+revision-id: rev-1
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 1
+`))
+					return nil
+				},
+			)
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "1..tag:other"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 2
+revision-id: rev-other
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 2
+------------------------------------------------------------
+revno: 1
+revision-id: rev-1
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 1
+`))
+					return nil
+				},
+			)
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("bzr").Path,
+					Args: []string{"log", "--long", "--show-ids", "-n1", "-r", "1..tag:unrelated"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`------------------------------------------------------------
+revno: 1
+revision-id: rev-unrelated
+committer: Someone <someone@example.com>
+branch nick: trunk
+timestamp: Wed 2014-01-01 00:00:00 +0000
+message:
+  commit 1
+`))
+					return nil
+				},
+			)
+		})
+
+		Describe("IsAncestor", func() {
+			It("returns true when the version is in the mainline of the other", func() {
+				isAncestor, err := bzrRepo.IsAncestor("2", "3")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isAncestor).To(BeTrue())
+			})
+
+			It("returns false when it is not", func() {
+				isAncestor, err := bzrRepo.IsAncestor("2", "tag:other")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isAncestor).To(BeFalse())
+			})
+		})
+
+		Describe("MergeBase", func() {
+			It("returns the most recent revision in both mainlines", func() {
+				base, err := bzrRepo.MergeBase("3", "tag:other")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(base).To(Equal("rev-1"))
+			})
+
+			Context("when the versions share no history", func() {
+				It("returns NoCommonAncestorError", func() {
+					_, err := bzrRepo.MergeBase("3", "tag:unrelated")
+					Expect(err).To(Equal(NoCommonAncestorError))
+				})
+			})
+		})
+	})
 })
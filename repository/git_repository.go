@@ -1,9 +1,14 @@
 package repository
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/vito/gocart/command_runner"
@@ -14,8 +19,102 @@ type GitRepository struct {
 	runner command_runner.CommandRunner
 }
 
+// how many commits to deepen a shallow clone by at a time, and how many
+// times to try before fetching the rest of its history
+const ShallowDeepenStep = 50
+const ShallowDeepenAttempts = 4
+
 func (r *GitRepository) Checkout(version string) error {
-	return r.runner.Run(r.gitCmd("checkout", version))
+	if r.isShallow() {
+		err := r.fetchVersion(version)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := r.runner.Run(r.gitCmd("checkout", version))
+	if err != nil {
+		return err
+	}
+
+	if !r.hasSubmodules() {
+		return nil
+	}
+
+	err = r.runner.Run(r.gitCmd("submodule", "sync", "--recursive"))
+	if err != nil {
+		return err
+	}
+
+	return r.runner.Run(r.gitCmd("submodule", "update", "--init", "--recursive"))
+}
+
+// git archive only writes archive files, so a tarball is written next to the
+// destination and unpacked with tar; submodules are exported in the same way,
+// at the commits the version records for them
+func (r *GitRepository) Export(version string, dest string) error {
+	if r.isShallow() {
+		err := r.fetchVersion(version)
+		if err != nil {
+			return err
+		}
+	}
+
+	tarball := dest + ".tar"
+
+	defer os.Remove(tarball)
+
+	err := r.runner.Run(r.gitCmd("archive", "--format=tar", "--output="+tarball, version))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = r.runner.Run(exec.Command("tar", "-xf", tarball, "-C", dest))
+	if err != nil {
+		return err
+	}
+
+	if !r.hasSubmodules() {
+		return nil
+	}
+
+	out, err := r.cmdOutput(r.gitCmd("ls-tree", "-r", version))
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		// e.g. '160000 commit <sha>\t<path>'
+		tab := strings.Index(line, "\t")
+		if tab == -1 {
+			continue
+		}
+
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 || fields[1] != "commit" {
+			continue
+		}
+
+		submodulePath := line[tab+1:]
+		submodule := &GitRepository{path.Join(r.path, submodulePath), r.runner}
+
+		submoduleDest := path.Join(dest, submodulePath)
+
+		// tar leaves an empty directory for the submodule
+		os.Remove(submoduleDest)
+
+		err := submodule.Export(fields[2], submoduleDest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (r *GitRepository) CurrentVersion() (string, error) {
@@ -29,16 +128,367 @@ func (r *GitRepository) CurrentVersion() (string, error) {
 	return strings.TrimRight(out, "\n"), nil
 }
 
+func (r *GitRepository) ResolveVersion(version string) (string, error) {
+	out, err := r.cmdOutput(r.gitCmd("rev-parse", "--verify", version+"^{commit}"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(out, "\n"), nil
+}
+
 func (r *GitRepository) Update() error {
 	return r.runner.Run(r.gitCmd("fetch"))
 }
 
-func (r *GitRepository) Status() (string, error) {
-	return r.cmdOutput(r.gitCmd("status", "--porcelain"))
+func (r *GitRepository) Remote() (string, error) {
+	out, err := r.cmdOutput(r.gitCmd("config", "--get", "remote.origin.url"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+func (r *GitRepository) SetRemote(url string) error {
+	return r.runner.Run(r.gitCmd("remote", "set-url", "origin", url))
+}
+
+func (r *GitRepository) Stash(message string) error {
+	return r.runner.Run(r.gitCmd("stash", "push", "--include-untracked", "-m", message))
+}
+
+func (r *GitRepository) Status() ([]FileStatus, error) {
+	out, err := r.cmdOutput(r.gitCmd("status", "--porcelain"))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []FileStatus{}
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+
+		path := line[3:]
+
+		// renames and copies show as 'from -> to'
+		if arrow := strings.Index(path, " -> "); arrow != -1 {
+			path = path[arrow+4:]
+		}
+
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+
+		seen[path] = true
+
+		statuses = append(statuses, FileStatus{
+			Path:  path,
+			State: gitFileState(line[0:2]),
+		})
+	}
+
+	if !r.hasSubmodules() {
+		return statuses, nil
+	}
+
+	submodules, err := r.submoduleStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, submodule := range submodules {
+		if seen[submodule.path] {
+			continue
+		}
+
+		switch submodule.state {
+		case '+':
+			statuses = append(statuses, FileStatus{submodule.path, Modified})
+		case '-':
+			statuses = append(statuses, FileStatus{submodule.path, Missing})
+		case 'U':
+			statuses = append(statuses, FileStatus{submodule.path, Conflicted})
+		}
+	}
+
+	return statuses, nil
+}
+
+func (r *GitRepository) Submodules() (map[string]string, error) {
+	if !r.hasSubmodules() {
+		return nil, nil
+	}
+
+	submodules, err := r.submoduleStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string)
+
+	for _, submodule := range submodules {
+		versions[submodule.path] = submodule.version
+	}
+
+	return versions, nil
+}
+
+func (r *GitRepository) Log(from, to string) ([]Commit, error) {
+	out, err := r.cmdOutput(r.gitCmd(
+		"log",
+		"--format=%H%x1f%h%x1f%an%x1f%at%x1f%s",
+		fmt.Sprintf("%s..%s", from, to),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+
+		commits = append(commits, Commit{
+			ID:      fields[0],
+			ShortID: fields[1],
+			Author:  fields[2],
+			Date:    parseUnixTime(fields[3]),
+			Subject: fields[4],
+		})
+	}
+
+	if r.isShallow() {
+		truncated, err := r.reachesShallowBoundary(commits)
+		if err != nil {
+			return nil, err
+		}
+
+		if truncated {
+			return nil, TruncatedHistoryError
+		}
+	}
+
+	return commits, nil
+}
+
+func (r *GitRepository) Commit(version string) (Commit, error) {
+	out, err := r.cmdOutput(r.gitCmd(
+		"log",
+		"-1",
+		"--format=%H%x1f%h%x1f%an%x1f%ct%x1f%s",
+		version,
+	))
+	if err != nil {
+		return Commit{}, err
+	}
+
+	fields := strings.Split(strings.TrimRight(out, "\n"), "\x1f")
+	if len(fields) != 5 {
+		return Commit{}, fmt.Errorf("unexpected output from git log: %q", out)
+	}
+
+	// the committer date, as for go pseudo-versions
+	return Commit{
+		ID:      fields[0],
+		ShortID: fields[1],
+		Author:  fields[2],
+		Date:    parseUnixTime(fields[3]),
+		Subject: fields[4],
+	}, nil
+}
+
+// a local or remote branch, unless a tag of the same name takes precedence
+func (r *GitRepository) IsBranch(name string) (bool, error) {
+	out, err := r.cmdOutput(r.gitCmd(
+		"for-each-ref",
+		"--format=%(refname)",
+		"refs/tags/"+name,
+		"refs/heads/"+name,
+		"refs/remotes/origin/"+name,
+	))
+	if err != nil {
+		return false, err
+	}
+
+	branch := false
+
+	for _, ref := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		switch ref {
+		case "refs/tags/" + name:
+			return false, nil
+		case "refs/heads/" + name, "refs/remotes/origin/" + name:
+			branch = true
+		}
+	}
+
+	return branch, nil
+}
+
+func (r *GitRepository) IsAncestor(ancestor, descendant string) (bool, error) {
+	err := r.runner.Run(r.gitCmd("merge-base", "--is-ancestor", ancestor, descendant))
+	if err == nil {
+		return true, nil
+	}
+
+	// exit status 1 means "no"; anything else is a real failure
+	if exitedWith(err, 1) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (r *GitRepository) MergeBase(a, b string) (string, error) {
+	out, err := r.cmdOutput(r.gitCmd("merge-base", a, b))
+	if err != nil {
+		if !exitedWith(err, 1) {
+			return "", err
+		}
+
+		// the common history may just not have been fetched
+		if r.isShallow() {
+			return "", TruncatedHistoryError
+		}
+
+		return "", NoCommonAncestorError
+	}
+
+	return strings.TrimRight(out, "\n"), nil
+}
+
+// fetches just the given version into a shallow clone, deepening it
+// incrementally if that doesn't work (e.g. for servers that don't allow
+// fetching arbitrary SHAs), and finally fetching the full history
+func (r *GitRepository) fetchVersion(version string) error {
+	if r.hasVersion(version) {
+		return nil
+	}
+
+	err := r.runner.Run(r.gitCmd("fetch", "--depth", "1", "origin", version))
+	if err == nil && r.hasVersion(version) {
+		return nil
+	}
+
+	for i := 0; i < ShallowDeepenAttempts; i++ {
+		err := r.runner.Run(r.gitCmd("fetch", fmt.Sprintf("--deepen=%d", ShallowDeepenStep)))
+		if err != nil {
+			return err
+		}
+
+		if r.hasVersion(version) {
+			return nil
+		}
+	}
+
+	return r.runner.Run(r.gitCmd("fetch", "--unshallow"))
+}
+
+func (r *GitRepository) hasVersion(version string) bool {
+	return r.runner.Run(r.gitCmd("cat-file", "-e", version+"^{commit}")) == nil
 }
 
-func (r *GitRepository) Log(from, to string) (string, error) {
-	return r.cmdOutput(r.gitCmd("log", "--oneline", fmt.Sprintf("%s..%s", from, to)))
+func (r *GitRepository) reachesShallowBoundary(commits []Commit) (bool, error) {
+	out, err := r.cmdOutput(r.gitCmd("rev-parse", "--git-path", "shallow"))
+	if err != nil {
+		return false, err
+	}
+
+	// relative to the repository's path unless .git is elsewhere
+	shallowPath := strings.TrimSpace(out)
+	if !path.IsAbs(shallowPath) {
+		shallowPath = path.Join(r.path, shallowPath)
+	}
+
+	shallow, err := ioutil.ReadFile(shallowPath)
+	if err != nil {
+		return false, err
+	}
+
+	boundary := map[string]bool{}
+	for _, sha := range strings.Fields(string(shallow)) {
+		boundary[sha] = true
+	}
+
+	for _, commit := range commits {
+		if boundary[commit.ID] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// asks git rather than looking for .git/shallow, which isn't there when the
+// repository's path is beneath the top of the work tree or .git is a file
+func (r *GitRepository) isShallow() bool {
+	out, err := r.cmdOutput(r.gitCmd("rev-parse", "--is-shallow-repository"))
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+type gitSubmodule struct {
+	// ' ' if checked out at the recorded commit, '+' if not, '-' if not
+	// initialized, and 'U' if conflicted
+	state byte
+
+	version string
+	path    string
+}
+
+func (r *GitRepository) submoduleStatus() ([]gitSubmodule, error) {
+	buf := new(bytes.Buffer)
+
+	cmd := r.gitCmd("submodule", "status", "--recursive")
+	cmd.Stdout = buf
+
+	err := r.runner.Run(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	submodules := []gitSubmodule{}
+
+	lines := bufio.NewScanner(buf)
+	for lines.Scan() {
+		line := lines.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			continue
+		}
+
+		submodules = append(submodules, gitSubmodule{
+			state:   line[0],
+			version: fields[0],
+			path:    fields[1],
+		})
+	}
+
+	return submodules, nil
+}
+
+func (r *GitRepository) hasSubmodules() bool {
+	out, err := r.cmdOutput(r.gitCmd("rev-parse", "--show-toplevel"))
+	if err != nil {
+		return false
+	}
+
+	topLevel := strings.TrimSpace(out)
+	if topLevel == "" {
+		return false
+	}
+
+	_, err = os.Stat(path.Join(topLevel, ".gitmodules"))
+	return err == nil
 }
 
 func (r *GitRepository) gitCmd(args ...string) *exec.Cmd {
@@ -52,7 +502,6 @@ func (r *GitRepository) cmdOutput(cmd *exec.Cmd) (string, error) {
 	buf := new(bytes.Buffer)
 
 	cmd.Stdout = buf
-	cmd.Stderr = buf
 
 	err := r.runner.Run(cmd)
 	if err != nil {
@@ -61,3 +510,23 @@ func (r *GitRepository) cmdOutput(cmd *exec.Cmd) (string, error) {
 
 	return string(buf.Bytes()), nil
 }
+
+func gitFileState(xy string) FileState {
+	switch {
+	case xy == "??":
+		return Untracked
+	case strings.Contains(xy, "U") || xy == "AA" || xy == "DD":
+		return Conflicted
+	}
+
+	switch strings.TrimSpace(xy)[0] {
+	case 'A', 'C':
+		return Added
+	case 'D':
+		return Deleted
+	case 'R':
+		return Renamed
+	default:
+		return Modified
+	}
+}
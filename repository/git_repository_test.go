@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -78,6 +79,419 @@ var _ = Describe("GitRepository", func() {
 		})
 	})
 
+	Context("when the repository has submodules", func() {
+		var submoduleStatusError error
+
+		BeforeEach(func() {
+			submoduleStatusError = nil
+
+			err := ioutil.WriteFile(path.Join(repoPath, ".gitmodules"), []byte{}, 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "--show-toplevel"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(repoPath + "\n"))
+					return nil
+				},
+			)
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"submodule", "status", "--recursive"},
+				}, func(cmd *exec.Cmd) error {
+					if submoduleStatusError != nil {
+						return submoduleStatusError
+					}
+
+					cmd.Stdout.Write([]byte(" abc vendor/clean (heads/master)\n"))
+					cmd.Stdout.Write([]byte("+def vendor/drifted (heads/master)\n"))
+					cmd.Stdout.Write([]byte("-ghi vendor/uninitialized\n"))
+					return nil
+				},
+			)
+		})
+
+		Describe("Checkout", func() {
+			It("syncs and updates the submodules after checking out", func() {
+				err := gitRepo.Checkout("some-ref")
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(runner).To(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"checkout", "some-ref"},
+						Dir:  repoPath,
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"submodule", "sync", "--recursive"},
+						Dir:  repoPath,
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"submodule", "update", "--init", "--recursive"},
+						Dir:  repoPath,
+					},
+				))
+			})
+
+			Context("when updating the submodules fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					runner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"submodule", "update", "--init", "--recursive"},
+						}, func(*exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("returns the error", func() {
+					err := gitRepo.Checkout("some-ref")
+					Expect(err).To(Equal(disaster))
+				})
+			})
+		})
+
+		Describe("Export", func() {
+			It("exports each submodule at the commit the version records for it", func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"ls-tree", "-r", "some-ref"},
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte("100644 blob aaa\tmain.go\n"))
+						cmd.Stdout.Write([]byte("160000 commit abc\tvendor/clean\n"))
+						return nil
+					},
+				)
+
+				dest := path.Join(repoPath, "export")
+
+				err := gitRepo.Export("some-ref", dest)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(runner).To(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"archive", "--format=tar", "--output=" + dest + ".tar", "some-ref"},
+						Dir:  repoPath,
+					},
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"archive", "--format=tar", "--output=" + path.Join(dest, "vendor/clean") + ".tar", "abc"},
+						Dir:  path.Join(repoPath, "vendor/clean"),
+					},
+				))
+			})
+		})
+
+		Describe("Status", func() {
+			It("includes submodules that are not at their recorded commit", func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"status", "--porcelain"},
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte(" M vendor/drifted\n"))
+						return nil
+					},
+				)
+
+				status, err := gitRepo.Status()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(status).To(Equal([]FileStatus{
+					{"vendor/drifted", Modified},
+					{"vendor/uninitialized", Missing},
+				}))
+			})
+		})
+
+		Describe("Submodules", func() {
+			It("returns the version of each submodule by path", func() {
+				submodules, err := gitRepo.Submodules()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(submodules).To(Equal(map[string]string{
+					"vendor/clean":         "abc",
+					"vendor/drifted":       "def",
+					"vendor/uninitialized": "ghi",
+				}))
+			})
+
+			Context("when git submodule status fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					submoduleStatusError = disaster
+				})
+
+				It("returns the error", func() {
+					_, err := gitRepo.Submodules()
+					Expect(err).To(Equal(disaster))
+				})
+			})
+		})
+	})
+
+	Context("when the repository is a shallow clone", func() {
+		BeforeEach(func() {
+			err := os.Chmod(path.Join(repoPath, ".git"), 0755)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(repoPath, ".git", "shallow"), []byte("boundary-sha\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "--is-shallow-repository"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("true\n"))
+					return nil
+				},
+			)
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "--git-path", "shallow"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(".git/shallow\n"))
+					return nil
+				},
+			)
+		})
+
+		Describe("Checkout", func() {
+			Context("when the version is present", func() {
+				It("checks it out without fetching", func() {
+					err := gitRepo.Checkout("some-ref")
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(runner).To(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"cat-file", "-e", "some-ref^{commit}"},
+							Dir:  repoPath,
+						},
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"checkout", "some-ref"},
+							Dir:  repoPath,
+						},
+					))
+
+					Expect(runner).ToNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"fetch", "--depth", "1", "origin", "some-ref"},
+						},
+					))
+				})
+			})
+
+			Context("when the version is missing", func() {
+				var fetched bool
+
+				BeforeEach(func() {
+					fetched = false
+
+					runner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"cat-file", "-e", "some-ref^{commit}"},
+						}, func(*exec.Cmd) error {
+							if fetched {
+								return nil
+							}
+
+							return errors.New("missing")
+						},
+					)
+				})
+
+				It("fetches just that version before checking out", func() {
+					runner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"fetch", "--depth", "1", "origin", "some-ref"},
+						}, func(*exec.Cmd) error {
+							fetched = true
+							return nil
+						},
+					)
+
+					err := gitRepo.Checkout("some-ref")
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(runner).To(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"fetch", "--depth", "1", "origin", "some-ref"},
+							Dir:  repoPath,
+						},
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"checkout", "some-ref"},
+							Dir:  repoPath,
+						},
+					))
+				})
+
+				Context("and it cannot be fetched directly", func() {
+					BeforeEach(func() {
+						runner.WhenRunning(
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"fetch", "--depth", "1", "origin", "some-ref"},
+							}, func(*exec.Cmd) error {
+								return errors.New("not allowed")
+							},
+						)
+					})
+
+					It("deepens the clone until it is present", func() {
+						deepened := 0
+
+						runner.WhenRunning(
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"fetch", "--deepen=50"},
+							}, func(*exec.Cmd) error {
+								deepened++
+								fetched = deepened == 2
+								return nil
+							},
+						)
+
+						err := gitRepo.Checkout("some-ref")
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(deepened).To(Equal(2))
+
+						Expect(runner).ToNot(HaveExecutedSerially(
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"fetch", "--unshallow"},
+							},
+						))
+
+						Expect(runner).To(HaveExecutedSerially(
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"checkout", "some-ref"},
+								Dir:  repoPath,
+							},
+						))
+					})
+
+					It("fetches the full history as a last resort", func() {
+						err := gitRepo.Checkout("some-ref")
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(runner).To(HaveExecutedSerially(
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"fetch", "--deepen=50"},
+							},
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"fetch", "--unshallow"},
+								Dir:  repoPath,
+							},
+							fake_command_runner.CommandSpec{
+								Path: exec.Command("git").Path,
+								Args: []string{"checkout", "some-ref"},
+								Dir:  repoPath,
+							},
+						))
+					})
+				})
+			})
+		})
+
+		Describe("MergeBase", func() {
+			Context("when git finds no merge base", func() {
+				It("returns TruncatedHistoryError, as the common history may not be fetched", func() {
+					runner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"merge-base", "OLD", "NEW"},
+						}, func(*exec.Cmd) error {
+							return exec.Command("sh", "-c", "exit 1").Run()
+						},
+					)
+
+					_, err := gitRepo.MergeBase("OLD", "NEW")
+					Expect(err).To(Equal(TruncatedHistoryError))
+				})
+			})
+		})
+
+		Describe("Log", func() {
+			Context("when the range stops short of the shallow boundary", func() {
+				It("returns the log", func() {
+					runner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"log", "--format=%H%x1f%h%x1f%an%x1f%at%x1f%s", "OLD..NEW"},
+						}, func(cmd *exec.Cmd) error {
+							cmd.Stdout.Write([]byte("abc-sha\x1fabc\x1fSomeone\x1f0\x1fsome commit\n"))
+							return nil
+						},
+					)
+
+					log, err := gitRepo.Log("OLD", "NEW")
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(log).To(HaveLen(1))
+					Expect(log[0].ID).To(Equal("abc-sha"))
+				})
+			})
+
+			Context("when the range reaches the shallow boundary", func() {
+				It("returns TruncatedHistoryError", func() {
+					runner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: exec.Command("git").Path,
+							Args: []string{"log", "--format=%H%x1f%h%x1f%an%x1f%at%x1f%s", "OLD..NEW"},
+						}, func(cmd *exec.Cmd) error {
+							cmd.Stdout.Write([]byte("abc-sha\x1fabc\x1fSomeone\x1f0\x1fsome commit\n"))
+							cmd.Stdout.Write([]byte("boundary-sha\x1fboundary\x1fSomeone\x1f0\x1foldest commit\n"))
+							return nil
+						},
+					)
+
+					_, err := gitRepo.Log("OLD", "NEW")
+					Expect(err).To(Equal(TruncatedHistoryError))
+				})
+			})
+		})
+	})
+
+	Context("when the repository has no submodules", func() {
+		Describe("Submodules", func() {
+			It("returns nothing without running git submodule", func() {
+				submodules, err := gitRepo.Submodules()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(submodules).To(BeEmpty())
+
+				for _, cmd := range runner.ExecutedCommands() {
+					Expect(cmd.Args).ToNot(ContainElement("submodule"))
+				}
+			})
+		})
+	})
+
 	Describe("CurrentVersion", func() {
 		It("runs git rev-parse HEAD and returns its output", func() {
 			runner.WhenRunning(
@@ -119,6 +533,25 @@ var _ = Describe("GitRepository", func() {
 		})
 	})
 
+	Describe("ResolveVersion", func() {
+		It("runs git rev-parse on the commit the version refers to", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"rev-parse", "--verify", "v1.0^{commit}"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("abc-sha\n"))
+					return nil
+				},
+			)
+
+			ver, err := gitRepo.ResolveVersion("v1.0")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ver).To(Equal("abc-sha"))
+		})
+	})
+
 	Describe("Update", func() {
 		It("runs git fetch", func() {
 			err := gitRepo.Update()
@@ -156,15 +589,150 @@ var _ = Describe("GitRepository", func() {
 		})
 	})
 
+	Describe("Export", func() {
+		It("writes a tarball with git archive and unpacks it into the destination", func() {
+			dest := path.Join(repoPath, "export")
+
+			err := gitRepo.Export("some-ref", dest)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"archive", "--format=tar", "--output=" + dest + ".tar", "some-ref"},
+					Dir:  repoPath,
+				},
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("tar").Path,
+					Args: []string{"-xf", dest + ".tar", "-C", dest},
+				},
+			))
+		})
+
+		Context("when git archive fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				dest := path.Join(repoPath, "export")
+
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"archive", "--format=tar", "--output=" + dest + ".tar", "some-ref"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error without unpacking anything", func() {
+				err := gitRepo.Export("some-ref", path.Join(repoPath, "export"))
+				Expect(err).To(Equal(disaster))
+
+				Expect(runner).ToNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("tar").Path,
+					},
+				))
+			})
+		})
+	})
+
+	Describe("Stash", func() {
+		It("runs git stash, including untracked files", func() {
+			err := gitRepo.Stash("some message")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"stash", "push", "--include-untracked", "-m", "some message"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
+	Describe("Remote", func() {
+		It("returns the url of origin", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"config", "--get", "remote.origin.url"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("https://github.com/vito/gocart\n"))
+					return nil
+				},
+			)
+
+			remote, err := gitRepo.Remote()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(remote).To(Equal("https://github.com/vito/gocart"))
+		})
+	})
+
+	Describe("SetRemote", func() {
+		It("changes the url of origin", func() {
+			err := gitRepo.SetRemote("ssh://git@example.com/gocart.git")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"remote", "set-url", "origin", "ssh://git@example.com/gocart.git"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
 	Describe("Status", func() {
-		It("runs git status --porcelain and returns its output", func() {
+		It("runs git status --porcelain and parses each file's state", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("git").Path,
 					Args: []string{"status", "--porcelain"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
-					cmd.Stderr.Write([]byte("def\n"))
+					cmd.Stdout.Write([]byte(" M modified\n"))
+					cmd.Stdout.Write([]byte("M  staged\n"))
+					cmd.Stdout.Write([]byte("A  added\n"))
+					cmd.Stdout.Write([]byte(" D deleted\n"))
+					cmd.Stdout.Write([]byte("R  old -> renamed\n"))
+					cmd.Stdout.Write([]byte("UU conflicted\n"))
+					cmd.Stdout.Write([]byte("?? \"untracked file\"\n"))
+					return nil
+				},
+			)
+
+			status, err := gitRepo.Status()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+				{"staged", Modified},
+				{"added", Added},
+				{"deleted", Deleted},
+				{"renamed", Renamed},
+				{"conflicted", Conflicted},
+				{"untracked file", Untracked},
+			}))
+		})
+
+		It("returns nothing when the working tree is clean", func() {
+			status, err := gitRepo.Status()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(status).To(BeEmpty())
+		})
+
+		It("does not mistake warnings on stderr for files", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"status", "--porcelain"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(" M modified\n"))
+					cmd.Stderr.Write([]byte("warning: could not open directory 'private/': Permission denied\n"))
 					return nil
 				},
 			)
@@ -172,7 +740,9 @@ var _ = Describe("GitRepository", func() {
 			status, err := gitRepo.Status()
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(status).To(Equal("abc\ndef\n"))
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+			}))
 		})
 
 		Context("when git status fails", func() {
@@ -199,14 +769,14 @@ var _ = Describe("GitRepository", func() {
 	})
 
 	Describe("Log", func() {
-		It("runs git log --oneline OLD..NEW and returns its output", func() {
+		It("runs git log OLD..NEW and parses each commit", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("git").Path,
-					Args: []string{"log", "--oneline", "OLD..NEW"},
+					Args: []string{"log", "--format=%H%x1f%h%x1f%an%x1f%at%x1f%s", "OLD..NEW"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
-					cmd.Stderr.Write([]byte("def\n"))
+					cmd.Stdout.Write([]byte("abc-sha\x1fabc\x1fSomeone\x1f1388534400\x1fsome commit\n"))
+					cmd.Stdout.Write([]byte("def-sha\x1fdef\x1fSomeone Else\x1f1388620800\x1fanother commit\n"))
 					return nil
 				},
 			)
@@ -214,7 +784,22 @@ var _ = Describe("GitRepository", func() {
 			log, err := gitRepo.Log("OLD", "NEW")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(log).To(Equal("abc\ndef\n"))
+			Expect(log).To(Equal([]Commit{
+				{
+					ID:      "abc-sha",
+					ShortID: "abc",
+					Author:  "Someone",
+					Date:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+					Subject: "some commit",
+				},
+				{
+					ID:      "def-sha",
+					ShortID: "def",
+					Author:  "Someone Else",
+					Date:    time.Date(2014, 1, 2, 0, 0, 0, 0, time.UTC),
+					Subject: "another commit",
+				},
+			}))
 		})
 
 		Context("when git log fails", func() {
@@ -224,7 +809,7 @@ var _ = Describe("GitRepository", func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("git").Path,
-						Args: []string{"log", "--oneline", "OLD..NEW"},
+						Args: []string{"log", "--format=%H%x1f%h%x1f%an%x1f%at%x1f%s", "OLD..NEW"},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -239,4 +824,177 @@ var _ = Describe("GitRepository", func() {
 			})
 		})
 	})
+
+	Describe("Commit", func() {
+		It("runs git log -1 on the version and parses the commit", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"log", "-1", "--format=%H%x1f%h%x1f%an%x1f%ct%x1f%s", "abc-sha"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("abc-sha\x1fabc\x1fSomeone\x1f1388534400\x1fsome commit\n"))
+					return nil
+				},
+			)
+
+			commit, err := gitRepo.Commit("abc-sha")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(commit).To(Equal(Commit{
+				ID:      "abc-sha",
+				ShortID: "abc",
+				Author:  "Someone",
+				Date:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+				Subject: "some commit",
+			}))
+		})
+
+		Context("when git log fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"log", "-1", "--format=%H%x1f%h%x1f%an%x1f%ct%x1f%s", "abc-sha"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := gitRepo.Commit("abc-sha")
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("IsBranch", func() {
+		branchRefsSpec := func(name string) fake_command_runner.CommandSpec {
+			return fake_command_runner.CommandSpec{
+				Path: exec.Command("git").Path,
+				Args: []string{"for-each-ref", "--format=%(refname)", "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/origin/" + name},
+			}
+		}
+
+		It("is true for a local or remote branch", func() {
+			runner.WhenRunning(branchRefsSpec("master"), func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("refs/remotes/origin/master\n"))
+				return nil
+			})
+
+			isBranch, err := gitRepo.IsBranch("master")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isBranch).To(BeTrue())
+		})
+
+		It("is false for a tag, even with a branch of the same name", func() {
+			runner.WhenRunning(branchRefsSpec("v1.0"), func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte("refs/heads/v1.0\nrefs/tags/v1.0\n"))
+				return nil
+			})
+
+			isBranch, err := gitRepo.IsBranch("v1.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isBranch).To(BeFalse())
+		})
+
+		It("is false for anything else", func() {
+			isBranch, err := gitRepo.IsBranch("abc-sha")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isBranch).To(BeFalse())
+		})
+	})
+
+	Describe("IsAncestor", func() {
+		It("runs git merge-base --is-ancestor", func() {
+			isAncestor, err := gitRepo.IsAncestor("OLD", "NEW")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isAncestor).To(BeTrue())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"merge-base", "--is-ancestor", "OLD", "NEW"},
+					Dir:  repoPath,
+				},
+			))
+		})
+
+		Context("when git exits 1", func() {
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"merge-base", "--is-ancestor", "OLD", "NEW"},
+					}, func(*exec.Cmd) error {
+						return exec.Command("sh", "-c", "exit 1").Run()
+					},
+				)
+			})
+
+			It("returns false", func() {
+				isAncestor, err := gitRepo.IsAncestor("OLD", "NEW")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isAncestor).To(BeFalse())
+			})
+		})
+
+		Context("when git fails otherwise", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"merge-base", "--is-ancestor", "OLD", "NEW"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := gitRepo.IsAncestor("OLD", "NEW")
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("MergeBase", func() {
+		It("runs git merge-base and returns its output", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("git").Path,
+					Args: []string{"merge-base", "OLD", "NEW"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("base-sha\n"))
+					return nil
+				},
+			)
+
+			base, err := gitRepo.MergeBase("OLD", "NEW")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(base).To(Equal("base-sha"))
+		})
+
+		Context("when the versions share no history", func() {
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("git").Path,
+						Args: []string{"merge-base", "OLD", "NEW"},
+					}, func(*exec.Cmd) error {
+						return exec.Command("sh", "-c", "exit 1").Run()
+					},
+				)
+			})
+
+			It("returns NoCommonAncestorError", func() {
+				_, err := gitRepo.MergeBase("OLD", "NEW")
+				Expect(err).To(Equal(NoCommonAncestorError))
+			})
+		})
+	})
 })
@@ -2,7 +2,11 @@ package repository
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/vito/gocart/command_runner"
@@ -14,34 +18,262 @@ type HgRepository struct {
 }
 
 func (r *HgRepository) Checkout(version string) error {
-	return r.runner.Run(r.hgCmd("update", "-c", version))
+	return r.runner.Run(r.hgCmd("update", "-c", strings.TrimSuffix(version, "+")))
 }
 
+// the full node id of the working directory's parent; unlike 'hg id -i',
+// this is never abbreviated or marked with '+' for local changes
 func (r *HgRepository) CurrentVersion() (string, error) {
-	cmd := r.hgCmd("id", "-i")
+	return r.ResolveVersion(".")
+}
+
+func (r *HgRepository) ResolveVersion(version string) (string, error) {
+	// versions locked by older releases may have a '+' from 'hg id -i'
+	version = strings.TrimSuffix(version, "+")
 
-	out, err := r.cmdOutput(cmd)
+	out, err := r.cmdOutput(r.hgCmd("log", "--template", "{node}", "-r", version))
 	if err != nil {
 		return "", err
 	}
 
-	return strings.TrimRight(out, "\n"), nil
+	return strings.TrimSpace(out), nil
+}
+
+// leaves out the .hg_archival.txt that hg would otherwise add
+func (r *HgRepository) Export(version string, dest string) error {
+	return r.runner.Run(r.hgCmd(
+		"archive",
+		"--config", "ui.archivemeta=false",
+		"--subrepos",
+		"-t", "files",
+		"-r", strings.TrimSuffix(version, "+"),
+		dest,
+	))
 }
 
 func (r *HgRepository) Update() error {
 	return r.runner.Run(r.hgCmd("pull"))
 }
 
-func (r *HgRepository) Status() (string, error) {
-	return r.cmdOutput(r.hgCmd("status"))
+func (r *HgRepository) Remote() (string, error) {
+	out, err := r.cmdOutput(r.hgCmd("paths", "default"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// hg has no command for changing paths, so this edits the repository's hgrc
+func (r *HgRepository) SetRemote(url string) error {
+	root, err := r.cmdOutput(r.hgCmd("root"))
+	if err != nil {
+		return err
+	}
+
+	hgrcPath := filepath.Join(strings.TrimSpace(root), ".hg", "hgrc")
+
+	hgrc, err := ioutil.ReadFile(hgrcPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return ioutil.WriteFile(hgrcPath, []byte(setDefaultPath(string(hgrc), url)), 0644)
 }
 
-func (r *HgRepository) Log(from, to string) (string, error) {
-	return r.cmdOutput(r.hgCmd(
+// shelve ships with hg but has to be enabled
+func (r *HgRepository) Stash(message string) error {
+	return r.runner.Run(r.hgCmd("--config", "extensions.shelve=", "shelve", "--addremove", "-m", message))
+}
+
+func (r *HgRepository) Status() ([]FileStatus, error) {
+	out, err := r.cmdOutput(r.hgCmd("status"))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []FileStatus{}
+
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 3 {
+			continue
+		}
+
+		var state FileState
+
+		switch line[0] {
+		case 'M':
+			state = Modified
+		case 'A':
+			state = Added
+		case 'R':
+			state = Deleted
+		case '!':
+			state = Missing
+		case '?':
+			state = Untracked
+		default:
+			continue
+		}
+
+		statuses = append(statuses, FileStatus{
+			Path:  line[2:],
+			State: state,
+		})
+	}
+
+	return statuses, nil
+}
+
+// unlike git's from..to, hg's from::to includes 'from' itself, so it is
+// excluded explicitly
+func (r *HgRepository) Log(from, to string) ([]Commit, error) {
+	out, err := r.cmdOutput(r.hgCmd(
 		"log",
-		"--template", "{rev}:{node}: {desc|firstline}\n",
-		"-r", from+"::"+to,
+		"--template", "{node}\x1f{node|short}\x1f{author|person}\x1f{date|hgdate}\x1f{desc|firstline}\n",
+		"-r", fmt.Sprintf("(%s)::(%s) - (%s)", from, to, from),
 	))
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+
+		// hgdate is '<unix time> <timezone offset>'
+		date := strings.Fields(fields[3])
+		if len(date) == 0 {
+			date = []string{""}
+		}
+
+		commits = append(commits, Commit{
+			ID:      fields[0],
+			ShortID: fields[1],
+			Author:  fields[2],
+			Date:    parseUnixTime(date[0]),
+			Subject: fields[4],
+		})
+	}
+
+	return commits, nil
+}
+
+func (r *HgRepository) Commit(version string) (Commit, error) {
+	out, err := r.cmdOutput(r.hgCmd(
+		"log",
+		"--template", "{node}\x1f{node|short}\x1f{author|person}\x1f{date|hgdate}\x1f{desc|firstline}",
+		"-r", strings.TrimSuffix(version, "+"),
+	))
+	if err != nil {
+		return Commit{}, err
+	}
+
+	fields := strings.Split(out, "\x1f")
+	if len(fields) != 5 || len(strings.Fields(fields[3])) == 0 {
+		return Commit{}, fmt.Errorf("unexpected output from hg log: %q", out)
+	}
+
+	return Commit{
+		ID:      fields[0],
+		ShortID: fields[1],
+		Author:  fields[2],
+		Date:    parseUnixTime(strings.Fields(fields[3])[0]),
+		Subject: fields[4],
+	}, nil
+}
+
+// a named branch or a bookmark
+func (r *HgRepository) IsBranch(name string) (bool, error) {
+	out, err := r.cmdOutput(r.hgCmd(
+		"log",
+		"--template", "{node}\n",
+		"-l", "1",
+		"-r", fmt.Sprintf("present(branch('literal:%s')) or present(bookmark('literal:%s'))", name, name),
+	))
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) != "", nil
+}
+
+func (r *HgRepository) IsAncestor(ancestor, descendant string) (bool, error) {
+	out, err := r.cmdOutput(r.hgCmd(
+		"log",
+		"--template", "{node}\n",
+		"-r", fmt.Sprintf("(%s) and ancestors(%s)", ancestor, descendant),
+	))
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) != "", nil
+}
+
+func (r *HgRepository) MergeBase(a, b string) (string, error) {
+	out, err := r.cmdOutput(r.hgCmd(
+		"log",
+		"--template", "{node}\n",
+		"-r", fmt.Sprintf("ancestor(%s, %s)", a, b),
+	))
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSpace(out)
+	if base == "" {
+		return "", NoCommonAncestorError
+	}
+
+	return base, nil
+}
+
+// replaces or adds 'default = url' in the [paths] section of an hgrc
+func setDefaultPath(hgrc string, url string) string {
+	lines := strings.Split(strings.TrimRight(hgrc, "\n"), "\n")
+	if hgrc == "" {
+		lines = nil
+	}
+
+	section := ""
+	pathsAt := -1
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = trimmed
+
+			if section == "[paths]" {
+				pathsAt = i
+			}
+
+			continue
+		}
+
+		if section != "[paths]" {
+			continue
+		}
+
+		equals := strings.Index(trimmed, "=")
+		if equals != -1 && strings.TrimSpace(trimmed[:equals]) == "default" {
+			lines[i] = "default = " + url
+			return strings.Join(lines, "\n") + "\n"
+		}
+	}
+
+	if pathsAt == -1 {
+		lines = append(lines, "[paths]", "default = "+url)
+	} else {
+		lines = append(lines[:pathsAt+1], append([]string{"default = " + url}, lines[pathsAt+1:]...)...)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
 }
 
 func (r *HgRepository) hgCmd(args ...string) *exec.Cmd {
@@ -55,7 +287,6 @@ func (r *HgRepository) cmdOutput(cmd *exec.Cmd) (string, error) {
 	buf := new(bytes.Buffer)
 
 	cmd.Stdout = buf
-	cmd.Stderr = buf
 
 	err := r.runner.Run(cmd)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -55,6 +56,19 @@ var _ = Describe("HgRepository", func() {
 			))
 		})
 
+		It("ignores the '+' 'hg id' adds for local changes", func() {
+			err := hgRepo.Checkout("some-ref+")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"update", "-c", "some-ref"},
+					Dir:  repoPath,
+				},
+			))
+		})
+
 		Context("when hg checkout fails", func() {
 			disaster := errors.New("oh no!")
 
@@ -79,13 +93,13 @@ var _ = Describe("HgRepository", func() {
 	})
 
 	Describe("CurrentVersion", func() {
-		It("runs hg id and returns its output", func() {
+		It("returns the full node id of the working directory's parent", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("hg").Path,
-					Args: []string{"id", "-i"},
+					Args: []string{"log", "--template", "{node}", "-r", "."},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
+					cmd.Stdout.Write([]byte("1e7a3e30182500000000000000000000000000ab"))
 					return nil
 				},
 			)
@@ -93,17 +107,17 @@ var _ = Describe("HgRepository", func() {
 			ver, err := hgRepo.CurrentVersion()
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(ver).To(Equal("abc"))
+			Expect(ver).To(Equal("1e7a3e30182500000000000000000000000000ab"))
 		})
 
-		Context("when hg rev-parse fails", func() {
+		Context("when hg log fails", func() {
 			disaster := errors.New("oh no!")
 
 			BeforeEach(func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("hg").Path,
-						Args: []string{"id", "-i"},
+						Args: []string{"log", "--template", "{node}", "-r", "."},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -119,6 +133,38 @@ var _ = Describe("HgRepository", func() {
 		})
 	})
 
+	Describe("ResolveVersion", func() {
+		It("returns the full node id of the version", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"log", "--template", "{node}", "-r", "1e7a3e301825"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("1e7a3e30182500000000000000000000000000ab"))
+					return nil
+				},
+			)
+
+			ver, err := hgRepo.ResolveVersion("1e7a3e301825")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ver).To(Equal("1e7a3e30182500000000000000000000000000ab"))
+		})
+
+		It("ignores the '+' 'hg id' adds for local changes", func() {
+			_, err := hgRepo.ResolveVersion("1e7a3e301825+")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"log", "--template", "{node}", "-r", "1e7a3e301825"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
 	Describe("Update", func() {
 		It("runs hg pull", func() {
 			err := hgRepo.Update()
@@ -156,15 +202,151 @@ var _ = Describe("HgRepository", func() {
 		})
 	})
 
+	Describe("Export", func() {
+		It("runs hg archive without the archival metadata", func() {
+			err := hgRepo.Export("some-ref+", "/some/dest")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{
+						"archive",
+						"--config", "ui.archivemeta=false",
+						"--subrepos",
+						"-t", "files",
+						"-r", "some-ref",
+						"/some/dest",
+					},
+					Dir: repoPath,
+				},
+			))
+		})
+	})
+
+	Describe("Stash", func() {
+		It("runs hg shelve with the extension enabled", func() {
+			err := hgRepo.Stash("some message")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"--config", "extensions.shelve=", "shelve", "--addremove", "-m", "some message"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
+	Describe("Remote", func() {
+		It("returns the default path", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"paths", "default"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("https://code.google.com/p/go.crypto\n"))
+					return nil
+				},
+			)
+
+			remote, err := hgRepo.Remote()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(remote).To(Equal("https://code.google.com/p/go.crypto"))
+		})
+	})
+
+	Describe("SetRemote", func() {
+		var hgrcPath string
+
+		BeforeEach(func() {
+			hgrcPath = path.Join(repoPath, ".hg", "hgrc")
+
+			err := os.Chmod(path.Join(repoPath, ".hg"), 0755)
+			Expect(err).ToNot(HaveOccurred())
+
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"root"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(repoPath + "\n"))
+					return nil
+				},
+			)
+		})
+
+		It("replaces the default path in the repository's hgrc", func() {
+			err := ioutil.WriteFile(hgrcPath, []byte("[ui]\nusername = someone\n\n[paths]\ndefault = https://code.google.com/p/go.crypto\nother = https://example.com\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = hgRepo.SetRemote("https://hg.example.com/go.crypto")
+			Expect(err).ToNot(HaveOccurred())
+
+			hgrc, err := ioutil.ReadFile(hgrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(hgrc)).To(Equal("[ui]\nusername = someone\n\n[paths]\ndefault = https://hg.example.com/go.crypto\nother = https://example.com\n"))
+		})
+
+		It("adds a default path if there isn't one", func() {
+			err := ioutil.WriteFile(hgrcPath, []byte("[paths]\nother = https://example.com\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = hgRepo.SetRemote("https://hg.example.com/go.crypto")
+			Expect(err).ToNot(HaveOccurred())
+
+			hgrc, err := ioutil.ReadFile(hgrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(hgrc)).To(Equal("[paths]\ndefault = https://hg.example.com/go.crypto\nother = https://example.com\n"))
+		})
+
+		It("creates the hgrc if there isn't one", func() {
+			err := hgRepo.SetRemote("https://hg.example.com/go.crypto")
+			Expect(err).ToNot(HaveOccurred())
+
+			hgrc, err := ioutil.ReadFile(hgrcPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(hgrc)).To(Equal("[paths]\ndefault = https://hg.example.com/go.crypto\n"))
+		})
+	})
+
 	Describe("Status", func() {
-		It("runs hg status and returns its output", func() {
+		It("runs hg status and parses each file's state", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"status"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("M modified\n"))
+					cmd.Stdout.Write([]byte("A added\n"))
+					cmd.Stdout.Write([]byte("R removed\n"))
+					cmd.Stdout.Write([]byte("! missing\n"))
+					cmd.Stdout.Write([]byte("? untracked file\n"))
+					return nil
+				},
+			)
+
+			status, err := hgRepo.Status()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+				{"added", Added},
+				{"removed", Deleted},
+				{"missing", Missing},
+				{"untracked file", Untracked},
+			}))
+		})
+
+		It("does not mistake warnings on stderr for files", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("hg").Path,
 					Args: []string{"status"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
-					cmd.Stderr.Write([]byte("def\n"))
+					cmd.Stdout.Write([]byte("M modified\n"))
+					cmd.Stderr.Write([]byte("private: Permission denied\n"))
 					return nil
 				},
 			)
@@ -172,7 +354,9 @@ var _ = Describe("HgRepository", func() {
 			status, err := hgRepo.Status()
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(status).To(Equal("abc\ndef\n"))
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+			}))
 		})
 
 		Context("when hg status fails", func() {
@@ -199,14 +383,13 @@ var _ = Describe("HgRepository", func() {
 	})
 
 	Describe("Log", func() {
-		It("runs hg log with a fancy template returns its output", func() {
+		It("runs hg log on the descendants of OLD up to NEW and parses each commit", func() {
 			runner.WhenRunning(
 				fake_command_runner.CommandSpec{
 					Path: exec.Command("hg").Path,
-					Args: []string{"log", "--template", "{rev}:{node}: {desc|firstline}\n", "-r", "OLD::NEW"},
+					Args: []string{"log", "--template", "{node}\x1f{node|short}\x1f{author|person}\x1f{date|hgdate}\x1f{desc|firstline}\n", "-r", "(OLD)::(NEW) - (OLD)"},
 				}, func(cmd *exec.Cmd) error {
-					cmd.Stdout.Write([]byte("abc\n"))
-					cmd.Stderr.Write([]byte("def\n"))
+					cmd.Stdout.Write([]byte("abc-node\x1fabc\x1fSomeone\x1f1388534400 -3600\x1fsome commit\n"))
 					return nil
 				},
 			)
@@ -214,7 +397,15 @@ var _ = Describe("HgRepository", func() {
 			log, err := hgRepo.Log("OLD", "NEW")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(log).To(Equal("abc\ndef\n"))
+			Expect(log).To(Equal([]Commit{
+				{
+					ID:      "abc-node",
+					ShortID: "abc",
+					Author:  "Someone",
+					Date:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+					Subject: "some commit",
+				},
+			}))
 		})
 
 		Context("when hg log fails", func() {
@@ -224,7 +415,7 @@ var _ = Describe("HgRepository", func() {
 				runner.WhenRunning(
 					fake_command_runner.CommandSpec{
 						Path: exec.Command("hg").Path,
-						Args: []string{"log", "--template", "{rev}:{node}: {desc|firstline}\n", "-r", "OLD::NEW"},
+						Args: []string{"log", "--template", "{node}\x1f{node|short}\x1f{author|person}\x1f{date|hgdate}\x1f{desc|firstline}\n", "-r", "(OLD)::(NEW) - (OLD)"},
 					}, func(*exec.Cmd) error {
 						return disaster
 					},
@@ -239,4 +430,118 @@ var _ = Describe("HgRepository", func() {
 			})
 		})
 	})
+
+	Describe("Commit", func() {
+		It("runs hg log on the version and parses the commit", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"log", "--template", "{node}\x1f{node|short}\x1f{author|person}\x1f{date|hgdate}\x1f{desc|firstline}", "-r", "abc-node"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("abc-node\x1fabc\x1fSomeone\x1f1388534400 -3600\x1fsome commit"))
+					return nil
+				},
+			)
+
+			commit, err := hgRepo.Commit("abc-node+")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(commit).To(Equal(Commit{
+				ID:      "abc-node",
+				ShortID: "abc",
+				Author:  "Someone",
+				Date:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+				Subject: "some commit",
+			}))
+		})
+
+		Context("when the version does not exist", func() {
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("hg").Path,
+						Args: []string{"log", "--template", "{node}\x1f{node|short}\x1f{author|person}\x1f{date|hgdate}\x1f{desc|firstline}", "-r", "abc-node"},
+					}, func(*exec.Cmd) error {
+						return nil
+					},
+				)
+			})
+
+			It("returns an error", func() {
+				_, err := hgRepo.Commit("abc-node")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("IsBranch", func() {
+		It("looks the name up as a branch or bookmark", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"log", "--template", "{node}\n", "-l", "1", "-r", "present(branch('literal:default')) or present(bookmark('literal:default'))"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("abc-node\n"))
+					return nil
+				},
+			)
+
+			isBranch, err := hgRepo.IsBranch("default")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isBranch).To(BeTrue())
+
+			isBranch, err = hgRepo.IsBranch("1.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isBranch).To(BeFalse())
+		})
+	})
+
+	Describe("IsAncestor", func() {
+		It("returns true when OLD is among the ancestors of NEW", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"log", "--template", "{node}\n", "-r", "(OLD) and ancestors(NEW)"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("old-node\n"))
+					return nil
+				},
+			)
+
+			isAncestor, err := hgRepo.IsAncestor("OLD", "NEW")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isAncestor).To(BeTrue())
+		})
+
+		It("returns false when it is not", func() {
+			isAncestor, err := hgRepo.IsAncestor("OLD", "NEW")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isAncestor).To(BeFalse())
+		})
+	})
+
+	Describe("MergeBase", func() {
+		It("returns the ancestor() of both versions", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("hg").Path,
+					Args: []string{"log", "--template", "{node}\n", "-r", "ancestor(OLD, NEW)"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("base-node\n"))
+					return nil
+				},
+			)
+
+			base, err := hgRepo.MergeBase("OLD", "NEW")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(base).To(Equal("base-node"))
+		})
+
+		Context("when the versions share no history", func() {
+			It("returns NoCommonAncestorError", func() {
+				_, err := hgRepo.MergeBase("OLD", "NEW")
+				Expect(err).To(Equal(NoCommonAncestorError))
+			})
+		})
+	})
 })
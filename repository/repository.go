@@ -3,8 +3,12 @@ package repository
 import (
 	"errors"
 	"os"
+	"os/exec"
 	"path"
+	"strconv"
+	"time"
 
+	"github.com/vito/gocart/archive"
 	"github.com/vito/gocart/command_runner"
 )
 
@@ -12,32 +16,147 @@ type Repository interface {
 	Checkout(version string) error
 	Update() error
 	CurrentVersion() (string, error)
-	Status() (string, error)
-	Log(from, to string) (string, error)
+
+	// the canonical, immutable form of a version, e.g. a full commit id for
+	// a tag or an abbreviated id; this is what CurrentVersion returns
+	ResolveVersion(version string) (string, error)
+
+	// local modifications to the working tree
+	Status() ([]FileStatus, error)
+
+	// commits reachable from 'to' but not from 'from'
+	Log(from, to string) ([]Commit, error)
+
+	// whether 'ancestor' is reachable from (or the same as) 'descendant'
+	IsAncestor(ancestor, descendant string) (bool, error)
+
+	// the most recent common ancestor of both versions
+	MergeBase(a, b string) (string, error)
+}
+
+type FileState string
+
+const (
+	Modified   FileState = "modified"
+	Added      FileState = "added"
+	Deleted    FileState = "deleted"
+	Renamed    FileState = "renamed"
+	Missing    FileState = "missing"
+	Untracked  FileState = "untracked"
+	Conflicted FileState = "conflicted"
+)
+
+type FileStatus struct {
+	Path  string    `json:"path"`
+	State FileState `json:"state"`
+}
+
+type Commit struct {
+	ID      string    `json:"id"`
+	ShortID string    `json:"short_id"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// implemented by repositories that can contain other repositories, e.g.
+// git submodules; versions are keyed by path within the repository
+type SubmoduleRepository interface {
+	Submodules() (map[string]string, error)
+}
+
+// implemented by repositories that can set local changes aside, e.g. with
+// git stash or hg shelve
+type StashRepository interface {
+	Stash(message string) error
+}
+
+// implemented by repositories that know where they're updated from, e.g. a
+// git repository's origin
+type RemoteRepository interface {
+	Remote() (string, error)
+	SetRemote(url string) error
+}
+
+// implemented by repositories that can describe a single version, e.g. to
+// tell when it was committed
+type CommitRepository interface {
+	Commit(version string) (Commit, error)
+}
+
+// implemented by repositories that can write out the files of a version
+// without any VCS metadata, e.g. with git archive; the destination must not
+// exist yet
+type ExportRepository interface {
+	Export(version string, dest string) error
+}
+
+// implemented by repositories with named, moving branches, to tell them
+// apart from tags and commits
+type BranchRepository interface {
+	IsBranch(name string) (bool, error)
 }
 
 var UnknownRepositoryType = errors.New("unknown repository type")
 
+// returned by MergeBase when the versions share no history
+var NoCommonAncestorError = errors.New("no common ancestor")
+
+// returned by Log when the range reaches past the history available locally,
+// e.g. in a shallow clone
+var TruncatedHistoryError = errors.New("history is truncated")
+
 func New(path string, runner command_runner.CommandRunner) (Repository, error) {
 	gitDepth := checkForDir(path, ".git", 0)
 	hgDepth := checkForDir(path, ".hg", 0)
 	bzrDepth := checkForDir(path, ".bzr", 0)
+	svnDepth := checkForDir(path, ".svn", 0)
+	archiveDepth := checkForDir(path, archive.ManifestFile, 0)
 
-	if gitDepth < hgDepth && gitDepth < bzrDepth {
+	if closest(gitDepth, hgDepth, bzrDepth, svnDepth, archiveDepth) {
 		return &GitRepository{path, runner}, nil
 	}
 
-	if hgDepth < gitDepth && hgDepth < bzrDepth {
+	if closest(hgDepth, gitDepth, bzrDepth, svnDepth, archiveDepth) {
 		return &HgRepository{path, runner}, nil
 	}
 
-	if bzrDepth < gitDepth && bzrDepth < hgDepth {
+	if closest(bzrDepth, gitDepth, hgDepth, svnDepth, archiveDepth) {
 		return &BzrRepository{path, runner}, nil
 	}
 
+	if closest(svnDepth, gitDepth, hgDepth, bzrDepth, archiveDepth) {
+		return &SvnRepository{path, runner}, nil
+	}
+
+	if closest(archiveDepth, gitDepth, hgDepth, bzrDepth, svnDepth) {
+		return &ArchiveRepository{path}, nil
+	}
+
 	return nil, UnknownRepositoryType
 }
 
+// whether the checkout is at the version, which may be in a shorter form than
+// CurrentVersion returns, e.g. an abbreviated hg node id locked by an older
+// release; a version that can't be resolved is one it isn't at
+func AtVersion(repo Repository, version string) (bool, error) {
+	currentVersion, err := repo.CurrentVersion()
+	if err != nil {
+		return false, err
+	}
+
+	if currentVersion == version {
+		return true, nil
+	}
+
+	resolved, err := repo.ResolveVersion(version)
+	if err != nil {
+		return false, nil
+	}
+
+	return resolved != "" && resolved == currentVersion, nil
+}
+
 func checkForDir(root, dir string, depth int) int {
 	if root == "/" {
 		return depth
@@ -50,3 +169,34 @@ func checkForDir(root, dir string, depth int) int {
 
 	return checkForDir(path.Dir(root), dir, depth+1)
 }
+
+func closest(depth int, others ...int) bool {
+	for _, other := range others {
+		if depth >= other {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseUnixTime(seconds string) time.Time {
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0).UTC()
+}
+
+// whether a command failed by exiting with the given status, as opposed to
+// e.g. not being found
+func exitedWith(err error, status int) bool {
+	if failed, ok := err.(command_runner.CommandFailedError); ok {
+		err = failed.OriginalError
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+
+	return ok && exitErr.ExitCode() == status
+}
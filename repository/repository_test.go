@@ -94,6 +94,30 @@ var _ = Describe("A Repository", func() {
 		})
 	})
 
+	Describe("a svn repository", func() {
+		var repoPath string
+		var err error
+
+		BeforeEach(func() {
+			repoPath, err = ioutil.TempDir(os.TempDir(), "svn_repo")
+			Expect(err).ToNot(HaveOccurred())
+
+			os.Mkdir(path.Join(repoPath, ".svn"), 0600)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(repoPath)
+		})
+
+		It("returns that it is a SvnRepository", func() {
+			repo, err := repository.New(repoPath, runner)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, correctType := repo.(*repository.SvnRepository)
+			Expect(correctType).To(BeTrue())
+		})
+	})
+
 	Describe("an unknown repository", func() {
 		var repoPath string
 		var err error
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vito/gocart/command_runner"
+)
+
+type SvnRepository struct {
+	path   string
+	runner command_runner.CommandRunner
+}
+
+type MixedRevisionError struct {
+	Path      string
+	Revisions string
+}
+
+func (e MixedRevisionError) Error() string {
+	return fmt.Sprintf(
+		"%s has files at different revisions (%s); run 'svn update' in it to bring them to one",
+		e.Path,
+		e.Revisions,
+	)
+}
+
+type svnInfo struct {
+	Entry struct {
+		Revision string `xml:"revision,attr"`
+	} `xml:"entry"`
+}
+
+type svnLog struct {
+	Entries []struct {
+		Revision string    `xml:"revision,attr"`
+		Author   string    `xml:"author"`
+		Date     time.Time `xml:"date"`
+		Message  string    `xml:"msg"`
+	} `xml:"logentry"`
+}
+
+func (r *SvnRepository) Checkout(version string) error {
+	return r.runner.Run(r.svnCmd("update", "-r", version))
+}
+
+// the revision every file in the working copy is at; 'svn info' only gives
+// the directory's, which updating a single file doesn't change
+func (r *SvnRepository) CurrentVersion() (string, error) {
+	cmd := exec.Command("svnversion")
+	cmd.Dir = r.path
+
+	out, err := r.cmdOutput(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	// local modifications (M), switched (S) and sparse (P) paths are flagged
+	// after the revision; Status reports modifications separately
+	version := strings.TrimRight(strings.TrimSpace(out), "MSP")
+
+	if strings.Contains(version, ":") {
+		return "", MixedRevisionError{r.path, version}
+	}
+
+	if _, err := strconv.Atoi(version); err != nil {
+		return "", fmt.Errorf("no revision for %s: %s", r.path, strings.TrimSpace(out))
+	}
+
+	return version, nil
+}
+
+func (r *SvnRepository) ResolveVersion(version string) (string, error) {
+	rev, err := r.revision(version)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(rev), nil
+}
+
+// exports from the server at the revision, including externals
+func (r *SvnRepository) Export(version string, dest string) error {
+	return r.runner.Run(r.svnCmd("export", "-r", version, ".", dest))
+}
+
+// svn keeps no local history; checkouts and logs go to the server directly
+func (r *SvnRepository) Update() error {
+	return nil
+}
+
+func (r *SvnRepository) Status() ([]FileStatus, error) {
+	out, err := r.cmdOutput(r.svnCmd("status"))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []FileStatus{}
+
+	for _, line := range strings.Split(out, "\n") {
+		// the first seven columns are flags, followed by a space; anything else
+		// is informational (e.g. about externals or tree conflicts)
+		if len(line) < 9 || line[7] != ' ' {
+			continue
+		}
+
+		var state FileState
+
+		switch line[0] {
+		case 'A':
+			state = Added
+		case 'D':
+			state = Deleted
+		case 'M', 'R', '~':
+			state = Modified
+		case 'C':
+			state = Conflicted
+		case '?':
+			state = Untracked
+		case '!':
+			state = Missing
+		case ' ':
+			// property changes and conflicts
+			switch line[1] {
+			case 'M':
+				state = Modified
+			case 'C':
+				state = Conflicted
+			default:
+				continue
+			}
+		default:
+			continue
+		}
+
+		statuses = append(statuses, FileStatus{
+			Path:  line[8:],
+			State: state,
+		})
+	}
+
+	return statuses, nil
+}
+
+func (r *SvnRepository) Log(from, to string) ([]Commit, error) {
+	fromRev, err := r.revision(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRev, err := r.revision(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// svn ranges include both ends and run backwards if from > to; match
+	// git's from..to instead
+	if fromRev >= toRev {
+		return []Commit{}, nil
+	}
+
+	log := svnLog{}
+
+	err = r.xmlOutput(r.svnCmd("log", "--xml", "-r", fmt.Sprintf("%d:%d", fromRev+1, toRev)), &log)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+
+	for _, entry := range log.Entries {
+		commits = append(commits, Commit{
+			ID:      entry.Revision,
+			ShortID: "r" + entry.Revision,
+			Author:  entry.Author,
+			Date:    entry.Date,
+			Subject: strings.SplitN(strings.TrimSpace(entry.Message), "\n", 2)[0],
+		})
+	}
+
+	return commits, nil
+}
+
+func (r *SvnRepository) Commit(version string) (Commit, error) {
+	log := svnLog{}
+
+	err := r.xmlOutput(r.svnCmd("log", "--xml", "-r", version), &log)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	if len(log.Entries) != 1 {
+		return Commit{}, fmt.Errorf("no revision %s", version)
+	}
+
+	entry := log.Entries[0]
+
+	return Commit{
+		ID:      entry.Revision,
+		ShortID: "r" + entry.Revision,
+		Author:  entry.Author,
+		Date:    entry.Date,
+		Subject: strings.SplitN(strings.TrimSpace(entry.Message), "\n", 2)[0],
+	}, nil
+}
+
+// svn history is linear, so ancestry is just revision order
+func (r *SvnRepository) IsAncestor(ancestor, descendant string) (bool, error) {
+	ancestorRev, err := r.revision(ancestor)
+	if err != nil {
+		return false, err
+	}
+
+	descendantRev, err := r.revision(descendant)
+	if err != nil {
+		return false, err
+	}
+
+	return ancestorRev <= descendantRev, nil
+}
+
+func (r *SvnRepository) MergeBase(a, b string) (string, error) {
+	revA, err := r.revision(a)
+	if err != nil {
+		return "", err
+	}
+
+	revB, err := r.revision(b)
+	if err != nil {
+		return "", err
+	}
+
+	if revB < revA {
+		revA = revB
+	}
+
+	return strconv.Itoa(revA), nil
+}
+
+// resolves symbolic revisions, e.g. HEAD, to their numbers
+func (r *SvnRepository) revision(version string) (int, error) {
+	rev, err := strconv.Atoi(version)
+	if err == nil {
+		return rev, nil
+	}
+
+	info := svnInfo{}
+
+	err = r.xmlOutput(r.svnCmd("info", "--xml", "-r", version), &info)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(info.Entry.Revision)
+}
+
+func (r *SvnRepository) svnCmd(args ...string) *exec.Cmd {
+	cmd := exec.Command("svn", args...)
+	cmd.Dir = r.path
+
+	return cmd
+}
+
+func (r *SvnRepository) cmdOutput(cmd *exec.Cmd) (string, error) {
+	buf := new(bytes.Buffer)
+
+	cmd.Stdout = buf
+
+	err := r.runner.Run(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf.Bytes()), nil
+}
+
+func (r *SvnRepository) xmlOutput(cmd *exec.Cmd, result interface{}) error {
+	buf := new(bytes.Buffer)
+
+	cmd.Stdout = buf
+
+	err := r.runner.Run(cmd)
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(buf.Bytes(), result)
+}
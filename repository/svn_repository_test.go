@@ -0,0 +1,566 @@
+package repository_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/command_runner"
+	"github.com/vito/gocart/command_runner/fake_command_runner"
+	. "github.com/vito/gocart/command_runner/fake_command_runner/matchers"
+	. "github.com/vito/gocart/repository"
+)
+
+var _ = Describe("SvnRepository", func() {
+	var repoPath string
+
+	var svnRepo *SvnRepository
+	var runner *fake_command_runner.FakeCommandRunner
+
+	BeforeEach(func() {
+		runner = fake_command_runner.New()
+
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "svn_repo")
+		Expect(err).ToNot(HaveOccurred())
+
+		repoPath = tmpdir
+
+		os.Mkdir(path.Join(repoPath, ".svn"), 0600)
+
+		repo, err := New(repoPath, runner)
+		Expect(err).ToNot(HaveOccurred())
+
+		svnRepo = repo.(*SvnRepository)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(repoPath)
+	})
+
+	Describe("Checkout", func() {
+		It("runs svn update -r", func() {
+			err := svnRepo.Checkout("42")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"update", "-r", "42"},
+					Dir:  repoPath,
+				},
+			))
+		})
+
+		Context("when svn update fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("svn").Path,
+						Args: []string{"update", "-r", "42"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := svnRepo.Checkout("42")
+				Expect(err).To(HaveOccurred())
+
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("CurrentVersion", func() {
+		It("runs svnversion and returns the working copy's revision", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svnversion").Path,
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("42\n"))
+					return nil
+				},
+			)
+
+			ver, err := svnRepo.CurrentVersion()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ver).To(Equal("42"))
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svnversion").Path,
+					Dir:  repoPath,
+				},
+			))
+		})
+
+		It("leaves off the flags for local changes", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svnversion").Path,
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("42MS\n"))
+					return nil
+				},
+			)
+
+			ver, err := svnRepo.CurrentVersion()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ver).To(Equal("42"))
+		})
+
+		Context("when files are at different revisions", func() {
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("svnversion").Path,
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte("40:42M\n"))
+						return nil
+					},
+				)
+			})
+
+			It("returns a MixedRevisionError", func() {
+				_, err := svnRepo.CurrentVersion()
+				Expect(err).To(Equal(MixedRevisionError{
+					Path:      repoPath,
+					Revisions: "40:42",
+				}))
+			})
+		})
+
+		Context("when svnversion fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("svnversion").Path,
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := svnRepo.CurrentVersion()
+				Expect(err).To(HaveOccurred())
+
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("ResolveVersion", func() {
+		It("returns revision numbers as they are", func() {
+			ver, err := svnRepo.ResolveVersion("42")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ver).To(Equal("42"))
+			Expect(runner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Describe("Update", func() {
+		It("does nothing, as svn has no local history", func() {
+			err := svnRepo.Update()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Describe("Export", func() {
+		It("runs svn export at the revision", func() {
+			err := svnRepo.Export("42", "/some/dest")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"export", "-r", "42", ".", "/some/dest"},
+					Dir:  repoPath,
+				},
+			))
+		})
+	})
+
+	Describe("Status", func() {
+		It("runs svn status and parses each file's state", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"status"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("M       modified\n"))
+					cmd.Stdout.Write([]byte(" M      properties\n"))
+					cmd.Stdout.Write([]byte("A  +    added\n"))
+					cmd.Stdout.Write([]byte("D       deleted\n"))
+					cmd.Stdout.Write([]byte("C       conflicted\n"))
+					cmd.Stdout.Write([]byte("!       missing\n"))
+					cmd.Stdout.Write([]byte("?       untracked file\n"))
+					cmd.Stdout.Write([]byte("X       external\n"))
+					cmd.Stdout.Write([]byte("\n"))
+					cmd.Stdout.Write([]byte("Performing status on external item at 'external':\n"))
+					return nil
+				},
+			)
+
+			status, err := svnRepo.Status()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+				{"properties", Modified},
+				{"added", Added},
+				{"deleted", Deleted},
+				{"conflicted", Conflicted},
+				{"missing", Missing},
+				{"untracked file", Untracked},
+			}))
+		})
+
+		It("does not mistake warnings on stderr for files", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"status"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("M       modified\n"))
+					cmd.Stderr.Write([]byte("svn: warning: W000013: Can't open file 'private': Permission denied\n"))
+					return nil
+				},
+			)
+
+			status, err := svnRepo.Status()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(status).To(Equal([]FileStatus{
+				{"modified", Modified},
+			}))
+		})
+
+		Context("when svn status fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("svn").Path,
+						Args: []string{"status"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := svnRepo.Status()
+				Expect(err).To(HaveOccurred())
+
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Log", func() {
+		It("runs svn log on the revisions after OLD up to NEW and parses each commit", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"log", "--xml", "-r", "41:43"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<log>
+<logentry revision="41">
+<author>someone</author>
+<date>2014-01-01T00:00:00.000000Z</date>
+<msg>first commit
+
+with a body</msg>
+</logentry>
+<logentry revision="43">
+<author>someone</author>
+<date>2014-01-02T00:00:00.000000Z</date>
+<msg>second commit</msg>
+</logentry>
+</log>
+`))
+					return nil
+				},
+			)
+
+			log, err := svnRepo.Log("40", "43")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(log).To(Equal([]Commit{
+				{
+					ID:      "41",
+					ShortID: "r41",
+					Author:  "someone",
+					Date:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+					Subject: "first commit",
+				},
+				{
+					ID:      "43",
+					ShortID: "r43",
+					Author:  "someone",
+					Date:    time.Date(2014, 1, 2, 0, 0, 0, 0, time.UTC),
+					Subject: "second commit",
+				},
+			}))
+		})
+
+		It("returns nothing when OLD is not older than NEW", func() {
+			log, err := svnRepo.Log("43", "40")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(log).To(BeEmpty())
+			Expect(runner.ExecutedCommands()).To(BeEmpty())
+		})
+
+		It("resolves non-numeric revisions, still leaving out OLD", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"info", "--xml", "-r", "HEAD"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<info>
+<entry kind="dir" path="." revision="43">
+</entry>
+</info>
+`))
+					return nil
+				},
+			)
+
+			_, err := svnRepo.Log("40", "HEAD")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(runner).To(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"info", "--xml", "-r", "HEAD"},
+					Dir:  repoPath,
+				},
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"log", "--xml", "-r", "41:43"},
+					Dir:  repoPath,
+				},
+			))
+		})
+
+		Context("when svn log fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				runner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: exec.Command("svn").Path,
+						Args: []string{"log", "--xml", "-r", "41:43"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := svnRepo.Log("40", "43")
+				Expect(err).To(HaveOccurred())
+
+				Expect(err).To(Equal(disaster))
+			})
+		})
+	})
+
+	Context("with a real repository served over file://", func() {
+		var serverPath string
+		var checkoutPath string
+
+		var realRepo Repository
+
+		svn := func(dir string, args ...string) {
+			cmd := exec.Command("svn", args...)
+			cmd.Dir = dir
+
+			out, err := cmd.CombinedOutput()
+			Ω(err).ShouldNot(HaveOccurred(), string(out))
+		}
+
+		commit := func(file string) {
+			err := ioutil.WriteFile(path.Join(checkoutPath, file), []byte(file), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			svn(checkoutPath, "add", file)
+			svn(checkoutPath, "commit", "-m", "add "+file)
+		}
+
+		BeforeEach(func() {
+			var err error
+
+			serverPath, err = ioutil.TempDir(os.TempDir(), "svn_server")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			svnadmin := exec.Command("svnadmin", "create", serverPath)
+			out, err := svnadmin.CombinedOutput()
+			Ω(err).ShouldNot(HaveOccurred(), string(out))
+
+			checkoutPath = path.Join(serverPath+"-checkout", "repo")
+
+			err = os.MkdirAll(path.Dir(checkoutPath), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			svn(path.Dir(checkoutPath), "checkout", "file://"+serverPath, checkoutPath)
+
+			commit("a")
+			commit("b")
+			commit("c")
+
+			svn(checkoutPath, "update")
+
+			realRepo, err = New(checkoutPath, command_runner.New(false))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(serverPath)
+			os.RemoveAll(path.Dir(checkoutPath))
+		})
+
+		It("checks out revisions and reports the current one", func() {
+			err := realRepo.Checkout("1")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			version, err := realRepo.CurrentVersion()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal("1"))
+		})
+
+		It("refuses to report one revision when files are at different ones", func() {
+			svn(checkoutPath, "update", "-r", "1", "a")
+
+			_, err := realRepo.CurrentVersion()
+			Ω(err).Should(Equal(MixedRevisionError{
+				Path:      checkoutPath,
+				Revisions: "1:3",
+			}))
+		})
+
+		It("logs the commits between two revisions", func() {
+			log, err := realRepo.Log("1", "3")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(log).Should(HaveLen(2))
+			Ω(log[0].Subject).Should(Equal("add b"))
+			Ω(log[1].Subject).Should(Equal("add c"))
+
+			log, err = realRepo.Log("3", "1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(log).Should(BeEmpty())
+		})
+
+		It("reports local modifications", func() {
+			status, err := realRepo.Status()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(status).Should(BeEmpty())
+
+			err = ioutil.WriteFile(path.Join(checkoutPath, "a"), []byte("changed"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			status, err = realRepo.Status()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(status).Should(Equal([]FileStatus{{"a", Modified}}))
+		})
+	})
+
+	Describe("Commit", func() {
+		It("runs svn log on the revision and parses the commit", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"log", "--xml", "-r", "41"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<log>
+<logentry revision="41">
+<author>someone</author>
+<date>2014-01-01T00:00:00.000000Z</date>
+<msg>first commit
+
+with a body</msg>
+</logentry>
+</log>
+`))
+					return nil
+				},
+			)
+
+			commit, err := svnRepo.Commit("41")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(commit).To(Equal(Commit{
+				ID:      "41",
+				ShortID: "r41",
+				Author:  "someone",
+				Date:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+				Subject: "first commit",
+			}))
+		})
+	})
+
+	Describe("IsAncestor", func() {
+		It("compares revision numbers", func() {
+			isAncestor, err := svnRepo.IsAncestor("40", "43")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isAncestor).To(BeTrue())
+
+			isAncestor, err = svnRepo.IsAncestor("43", "40")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isAncestor).To(BeFalse())
+
+			Expect(runner.ExecutedCommands()).To(BeEmpty())
+		})
+	})
+
+	Describe("MergeBase", func() {
+		It("returns the older revision", func() {
+			base, err := svnRepo.MergeBase("43", "40")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(base).To(Equal("40"))
+		})
+
+		It("resolves symbolic revisions with svn info", func() {
+			runner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: exec.Command("svn").Path,
+					Args: []string{"info", "--xml", "-r", "HEAD"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<info>
+<entry kind="dir" path="." revision="42">
+</entry>
+</info>
+`))
+					return nil
+				},
+			)
+
+			base, err := svnRepo.MergeBase("HEAD", "43")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(base).To(Equal("42"))
+		})
+	})
+})
@@ -0,0 +1,134 @@
+package retry
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vito/gocart/command_runner"
+)
+
+type Policy struct {
+	// how many more times to try an operation that failed transiently
+	Retries int
+
+	// how long to wait before the first retry; doubled for each one after
+	Backoff time.Duration
+}
+
+// called before each retry with the reason the last attempt failed
+type Notify func(reason string, retry int, delay time.Duration)
+
+// failures that may well succeed if tried again
+var transientOutput = []string{
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"name or service not known",
+	"no such host",
+	"connection refused",
+	"connection reset",
+	"connection timed out",
+	"operation timed out",
+	"network is unreachable",
+	"no route to host",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"unexpected disconnect",
+	"rpc failed",
+	"returned error: 500",
+	"returned error: 502",
+	"returned error: 503",
+	"returned error: 504",
+	"abort: error:",
+	"bzr: error: connection error",
+	"svn: e170013",
+	"svn: e175012",
+}
+
+// failures that will happen again however many times they're retried, even if
+// they also look like network trouble
+var permanentOutput = []string{
+	"unknown revision",
+	"did not match any",
+	"repository not found",
+	"does not exist",
+	"permission denied",
+	"authentication failed",
+	"could not read username",
+	"terminal prompts disabled",
+	"host key verification failed",
+}
+
+// Run gives up waiting to retry, returning the context's error, once ctx is
+// canceled.
+func (p Policy) Run(ctx context.Context, operation func() error, notify Notify) error {
+	delay := p.Backoff
+
+	for retry := 1; ; retry++ {
+		err := operation()
+		if err == nil || retry > p.Retries {
+			return err
+		}
+
+		reason, transient := TransientFailure(err)
+		if !transient {
+			return err
+		}
+
+		if notify != nil {
+			notify(reason, retry, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// determines whether the error is from a command or a download that failed
+// because of the network, returning the line of its output saying so
+func TransientFailure(err error) (string, bool) {
+	// e.g. a server error while downloading
+	if temporary, ok := err.(interface {
+		Temporary() bool
+	}); ok && temporary.Temporary() {
+		return err.Error(), true
+	}
+
+	var message string
+
+	switch failed := err.(type) {
+	case command_runner.CommandFailedError:
+		message = string(failed.Output)
+	case net.Error:
+		message = failed.Error()
+	default:
+		return "", false
+	}
+
+	output := strings.ToLower(message)
+
+	for _, permanent := range permanentOutput {
+		if strings.Contains(output, permanent) {
+			return "", false
+		}
+	}
+
+	for _, line := range strings.Split(message, "\n") {
+		for _, transient := range transientOutput {
+			if strings.Contains(strings.ToLower(line), transient) {
+				return strings.TrimSpace(line), true
+			}
+		}
+	}
+
+	return "", false
+}
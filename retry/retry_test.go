@@ -0,0 +1,209 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/archive"
+	"github.com/vito/gocart/command_runner"
+	"github.com/vito/gocart/retry"
+)
+
+func failedWith(output string) error {
+	return command_runner.CommandFailedError{
+		OriginalError: errors.New("exit status 128"),
+
+		Command: exec.Command("git", "fetch"),
+		Output:  []byte(output),
+	}
+}
+
+var _ = Describe("Retrying", func() {
+	var policy retry.Policy
+
+	var attempts int
+	var failures []error
+
+	var retries []int
+	var delays []time.Duration
+	var reasons []string
+
+	operation := func() error {
+		attempts++
+
+		if len(failures) == 0 {
+			return nil
+		}
+
+		err := failures[0]
+		failures = failures[1:]
+
+		return err
+	}
+
+	notify := func(reason string, retry int, delay time.Duration) {
+		reasons = append(reasons, reason)
+		retries = append(retries, retry)
+		delays = append(delays, delay)
+	}
+
+	BeforeEach(func() {
+		policy = retry.Policy{
+			Retries: 3,
+			Backoff: time.Millisecond,
+		}
+
+		attempts = 0
+		failures = nil
+
+		retries = nil
+		delays = nil
+		reasons = nil
+	})
+
+	It("runs a successful operation once", func() {
+		err := policy.Run(context.Background(), operation, notify)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(attempts).To(Equal(1))
+		Expect(retries).To(BeEmpty())
+	})
+
+	Context("when the operation fails because of the network", func() {
+		BeforeEach(func() {
+			failures = []error{
+				failedWith("fatal: unable to access 'https://github.com/vito/gocart/': Could not resolve host: github.com\n"),
+				failedWith("error: RPC failed; curl 56 GnuTLS recv error (-54): Error in the pull function.\nfatal: the remote end hung up unexpectedly\n"),
+			}
+		})
+
+		It("retries it with exponential backoff", func() {
+			err := policy.Run(context.Background(), operation, notify)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(attempts).To(Equal(3))
+			Expect(retries).To(Equal([]int{1, 2}))
+			Expect(delays).To(Equal([]time.Duration{time.Millisecond, 2 * time.Millisecond}))
+		})
+
+		It("reports the line of output saying what went wrong", func() {
+			policy.Run(context.Background(), operation, notify)
+
+			Expect(reasons).To(Equal([]string{
+				"fatal: unable to access 'https://github.com/vito/gocart/': Could not resolve host: github.com",
+				"error: RPC failed; curl 56 GnuTLS recv error (-54): Error in the pull function.",
+			}))
+		})
+
+		Context("more times than it is retried", func() {
+			BeforeEach(func() {
+				policy.Retries = 1
+			})
+
+			It("returns the last error", func() {
+				lastFailure := failures[1]
+
+				err := policy.Run(context.Background(), operation, notify)
+				Expect(err).To(Equal(lastFailure))
+
+				Expect(attempts).To(Equal(2))
+			})
+		})
+	})
+
+	Context("when canceled while waiting to retry", func() {
+		BeforeEach(func() {
+			policy.Backoff = time.Hour
+
+			failures = []error{
+				failedWith("fatal: unable to access 'https://github.com/vito/gocart/': Could not resolve host: github.com\n"),
+			}
+		})
+
+		It("stops waiting and returns the cancellation error", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			canceling := func(reason string, retry int, delay time.Duration) {
+				cancel()
+			}
+
+			err := policy.Run(ctx, operation, canceling)
+			Expect(err).To(Equal(context.Canceled))
+
+			Expect(attempts).To(Equal(1))
+		})
+	})
+
+	Context("when the operation fails for another reason", func() {
+		BeforeEach(func() {
+			failures = []error{
+				failedWith("fatal: ambiguous argument 'v9': unknown revision or path not in the working tree.\n"),
+			}
+		})
+
+		It("does not retry it", func() {
+			err := policy.Run(context.Background(), operation, notify)
+			Expect(err).To(HaveOccurred())
+
+			Expect(attempts).To(Equal(1))
+			Expect(retries).To(BeEmpty())
+		})
+	})
+
+	Describe("TransientFailure", func() {
+		It("is true for network failures", func() {
+			reason, transient := retry.TransientFailure(failedWith("abort: error: Connection refused\n"))
+			Expect(transient).To(BeTrue())
+			Expect(reason).To(Equal("abort: error: Connection refused"))
+		})
+
+		It("is false for unknown revisions", func() {
+			_, transient := retry.TransientFailure(failedWith("error: pathspec 'v9' did not match any file(s) known to git\n"))
+			Expect(transient).To(BeFalse())
+		})
+
+		It("is false when credentials are needed", func() {
+			_, transient := retry.TransientFailure(failedWith("fatal: could not read Username for 'https://github.com': terminal prompts disabled\nfatal: the remote end hung up unexpectedly\n"))
+			Expect(transient).To(BeFalse())
+		})
+
+		It("is false for commands that were killed", func() {
+			_, transient := retry.TransientFailure(command_runner.CommandCanceledError{
+				Command: exec.Command("git", "fetch"),
+			})
+			Expect(transient).To(BeFalse())
+		})
+
+		It("is true for network errors while downloading", func() {
+			reason, transient := retry.TransientFailure(&url.Error{
+				Op:  "Get",
+				URL: "https://example.com/lib.tar.gz",
+				Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			})
+			Expect(transient).To(BeTrue())
+			Expect(reason).To(ContainSubstring("connection refused"))
+		})
+
+		It("is true for server errors while downloading", func() {
+			_, transient := retry.TransientFailure(archive.HTTPError{URL: "https://example.com/lib.tar.gz", StatusCode: 503})
+			Expect(transient).To(BeTrue())
+		})
+
+		It("is false for missing downloads", func() {
+			_, transient := retry.TransientFailure(archive.HTTPError{URL: "https://example.com/lib.tar.gz", StatusCode: 404})
+			Expect(transient).To(BeFalse())
+		})
+
+		It("is false for other errors", func() {
+			_, transient := retry.TransientFailure(errors.New("connection refused"))
+			Expect(transient).To(BeFalse())
+		})
+	})
+})
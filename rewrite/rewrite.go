@@ -0,0 +1,154 @@
+package rewrite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maps import paths starting with Prefix to the repository at the URL given by
+// Template, like git's 'insteadOf'
+//
+// each '*' in the prefix matches one path segment, which '{1}', '{2}', etc.
+// in the template are replaced with; the matched prefix is the import path of
+// the repository's root. URLs starting with 'hg+' or 'bzr+' are cloned with
+// that tool instead of git.
+type Rule struct {
+	Prefix   string
+	Template string
+}
+
+type Rules []Rule
+
+type Remote struct {
+	// the import path of the repository's root
+	Root string
+
+	URL string
+
+	// "git", "hg" or "bzr"
+	VCS string
+}
+
+type InvalidRuleError struct {
+	Rule string
+}
+
+func (e InvalidRuleError) Error() string {
+	return fmt.Sprintf("invalid rewrite rule '%s'; expected 'import/path/prefix=url'", e.Rule)
+}
+
+// parses 'prefix=template'
+func ParseRule(text string) (Rule, error) {
+	segments := strings.SplitN(text, "=", 2)
+	if len(segments) != 2 {
+		return Rule{}, InvalidRuleError{text}
+	}
+
+	prefix := strings.Trim(strings.TrimSpace(segments[0]), "/")
+	template := strings.TrimSpace(segments[1])
+
+	if prefix == "" || template == "" {
+		return Rule{}, InvalidRuleError{text}
+	}
+
+	return Rule{
+		Prefix:   prefix,
+		Template: template,
+	}, nil
+}
+
+func (rule Rule) String() string {
+	return rule.Prefix + "=" + rule.Template
+}
+
+// the remote for the import path, if it's under the rule's prefix
+func (rule Rule) Resolve(importPath string) (Remote, bool) {
+	prefix := strings.Split(rule.Prefix, "/")
+	segments := strings.Split(importPath, "/")
+
+	if len(segments) < len(prefix) {
+		return Remote{}, false
+	}
+
+	url := rule.Template
+	wildcards := 0
+
+	for i, segment := range prefix {
+		if segment == "*" {
+			wildcards++
+			url = strings.Replace(url, "{"+strconv.Itoa(wildcards)+"}", segments[i], -1)
+		} else if segment != segments[i] {
+			return Remote{}, false
+		}
+	}
+
+	vcs := "git"
+
+	for _, other := range []string{"hg", "bzr"} {
+		if strings.HasPrefix(url, other+"+") {
+			vcs = other
+			url = strings.TrimPrefix(url, other+"+")
+		}
+	}
+
+	return Remote{
+		Root: strings.Join(segments[:len(prefix)], "/"),
+		URL:  url,
+		VCS:  vcs,
+	}, true
+}
+
+// the remote given by the most specific rule matching the import path: the
+// one matching the longest prefix, or with the fewest wildcards
+func (rules Rules) Resolve(importPath string) (Remote, bool) {
+	var best Remote
+	var bestWildcards int
+
+	found := false
+
+	for _, rule := range rules {
+		remote, matched := rule.Resolve(importPath)
+		if !matched {
+			continue
+		}
+
+		wildcards := strings.Count(rule.Prefix, "*")
+
+		if !found ||
+			len(remote.Root) > len(best.Root) ||
+			(len(remote.Root) == len(best.Root) && wildcards < bestWildcards) {
+			best = remote
+			bestWildcards = wildcards
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// for use as a repeatable flag
+func (rules *Rules) Set(text string) error {
+	rule, err := ParseRule(text)
+	if err != nil {
+		return err
+	}
+
+	*rules = append(*rules, rule)
+
+	return nil
+}
+
+func (rules *Rules) String() string {
+	if rules == nil {
+		return ""
+	}
+
+	texts := []string{}
+
+	for _, rule := range *rules {
+		texts = append(texts, rule.String())
+	}
+
+	return strings.Join(texts, ",")
+}
@@ -0,0 +1,134 @@
+package rewrite_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/rewrite"
+)
+
+var _ = Describe("Rewrite rules", func() {
+	Describe("ParseRule", func() {
+		It("parses 'prefix=url'", func() {
+			rule, err := rewrite.ParseRule("github.com/ourco/*=ssh://git@git.ourco.com/{1}.git")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(rule).To(Equal(rewrite.Rule{
+				Prefix:   "github.com/ourco/*",
+				Template: "ssh://git@git.ourco.com/{1}.git",
+			}))
+		})
+
+		It("ignores trailing slashes in the prefix", func() {
+			rule, err := rewrite.ParseRule("code.google.com/p/go.net/=https://github.com/golang/net")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(rule.Prefix).To(Equal("code.google.com/p/go.net"))
+		})
+
+		It("fails without a url", func() {
+			_, err := rewrite.ParseRule("github.com/ourco/*")
+			Expect(err).To(Equal(rewrite.InvalidRuleError{Rule: "github.com/ourco/*"}))
+
+			_, err = rewrite.ParseRule("github.com/ourco/*=")
+			Expect(err).To(Equal(rewrite.InvalidRuleError{Rule: "github.com/ourco/*="}))
+		})
+	})
+
+	Describe("resolving an import path", func() {
+		var rules rewrite.Rules
+
+		BeforeEach(func() {
+			rules = rewrite.Rules{}
+
+			for _, rule := range []string{
+				"github.com/*/*=https://github.com/{1}/{2}",
+				"github.com/ourco/*=ssh://git@git.ourco.com/{1}.git",
+				"code.google.com/p/go.net=https://github.com/golang/net",
+				"code.google.com/p/go.net/html=hg+https://hg.example.com/html",
+				"launchpad.net/*=bzr+lp:{1}",
+			} {
+				err := rules.Set(rule)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		It("substitutes wildcards and takes the matched prefix as the root", func() {
+			remote, found := rules.Resolve("github.com/vito/gocart/set")
+			Expect(found).To(BeTrue())
+
+			Expect(remote).To(Equal(rewrite.Remote{
+				Root: "github.com/vito/gocart",
+				URL:  "https://github.com/vito/gocart",
+				VCS:  "git",
+			}))
+		})
+
+		It("prefers rules with fewer wildcards", func() {
+			remote, found := rules.Resolve("github.com/ourco/lib/pkg")
+			Expect(found).To(BeTrue())
+
+			Expect(remote).To(Equal(rewrite.Remote{
+				Root: "github.com/ourco/lib",
+				URL:  "ssh://git@git.ourco.com/lib.git",
+				VCS:  "git",
+			}))
+		})
+
+		It("prefers rules with longer prefixes", func() {
+			remote, found := rules.Resolve("code.google.com/p/go.net/html/atom")
+			Expect(found).To(BeTrue())
+
+			Expect(remote).To(Equal(rewrite.Remote{
+				Root: "code.google.com/p/go.net/html",
+				URL:  "https://hg.example.com/html",
+				VCS:  "hg",
+			}))
+
+			remote, found = rules.Resolve("code.google.com/p/go.net/websocket")
+			Expect(found).To(BeTrue())
+
+			Expect(remote.Root).To(Equal("code.google.com/p/go.net"))
+			Expect(remote.URL).To(Equal("https://github.com/golang/net"))
+		})
+
+		It("determines the VCS from the url", func() {
+			remote, found := rules.Resolve("launchpad.net/gocheck")
+			Expect(found).To(BeTrue())
+
+			Expect(remote).To(Equal(rewrite.Remote{
+				Root: "launchpad.net/gocheck",
+				URL:  "lp:gocheck",
+				VCS:  "bzr",
+			}))
+		})
+
+		It("only matches whole path segments", func() {
+			_, found := rules.Resolve("code.google.com/p/go.network")
+			Expect(found).To(BeFalse())
+
+			_, found = rules.Resolve("github.com/vito")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("as a flag", func() {
+		It("is listed as comma-separated rules", func() {
+			rules := rewrite.Rules{}
+
+			rules.Set("a=b")
+			rules.Set("c/*=d/{1}")
+
+			Expect(rules.String()).To(Equal("a=b,c/*=d/{1}"))
+		})
+
+		It("rejects invalid rules", func() {
+			rules := rewrite.Rules{}
+
+			err := rules.Set("a")
+			Expect(err).To(HaveOccurred())
+
+			Expect(rules).To(BeEmpty())
+		})
+	})
+})
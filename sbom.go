@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/fetcher"
+	"github.com/vito/gocart/gopath"
+	"github.com/vito/gocart/licenses"
+	"github.com/vito/gocart/repository"
+	"github.com/vito/gocart/sbom"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+func generateSBOM(root string, formatName string, filter tags.Filter, nested *tags.NestedFilters) {
+	format, err := sbom.Lookup(formatName)
+	if err != nil {
+		fatal(err)
+	}
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	name := modulePath(root)
+	if name == "" {
+		name, _ = gopath.ImportPath(os.Getenv("GOPATH"), root)
+	}
+
+	if name == "" {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			fatal(err)
+		}
+
+		name = filepath.Base(absRoot)
+	}
+
+	doc := &sbom.Document{
+		Name:    name,
+		Created: time.Now(),
+	}
+
+	doc.DependsOn, err = describeComponents(doc, cartridge, filter, nested)
+	if err != nil {
+		fatal(err)
+	}
+
+	content, err := format.Generate(*doc)
+	if err != nil {
+		fatal(err)
+	}
+
+	os.Stdout.Write(content)
+}
+
+// adds a component for each dependency, and for those of their Cartridges in
+// turn, returning the paths of the dependencies
+func describeComponents(doc *sbom.Document, deps *set.Set, filter tags.Filter, nested *tags.NestedFilters) ([]string, error) {
+	paths := []string{}
+
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		paths = append(paths, dep.Path)
+
+		repo, version, err := resolveInstalled(dep)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s:\n%s", dep.Path, indent(1, err.Error()))
+		}
+
+		described := false
+
+		for _, existing := range doc.Components {
+			if existing.Path != dep.Path {
+				continue
+			}
+
+			if existing.Version != version {
+				return nil, fetcher.VersionConflictError{
+					Path:     dep.Path,
+					VersionA: existing.Version,
+					VersionB: version,
+				}
+			}
+
+			described = true
+		}
+
+		if described {
+			continue
+		}
+
+		component, err := describeComponent(dep, repo, version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s:\n%s", dep.Path, indent(1, err.Error()))
+		}
+
+		doc.Components = append(doc.Components, component)
+		index := len(doc.Components) - 1
+
+		nextDeps, err := set.LoadFrom(dep.FullPath(GOPATH))
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		dependsOn, err := describeComponents(doc, nextDeps, nested.For(dep.Path), nested)
+		if err != nil {
+			return nil, err
+		}
+
+		doc.Components[index].DependsOn = dependsOn
+	}
+
+	return paths, nil
+}
+
+func describeComponent(dep dependency.Dependency, repo repository.Repository, version string) (sbom.Component, error) {
+	var err error
+
+	component := sbom.Component{
+		Path:    dep.Path,
+		Version: version,
+		VCS:     vcsName(repo),
+		URL:     dep.Archive,
+	}
+
+	if component.URL == "" {
+		component.URL = dep.Remote
+	}
+
+	if remoteRepo, ok := repo.(repository.RemoteRepository); ok && component.URL == "" {
+		// otherwise, wherever the checkout was cloned from
+		component.URL, _ = remoteRepo.Remote()
+	}
+
+	var report licenses.Report
+
+	component.Hash, report, err = scanExport(dep, repo, version)
+	if err != nil {
+		return sbom.Component{}, err
+	}
+
+	component.Licenses = report.Names()
+
+	return component, nil
+}
+
+// the hash and licenses of the files at the version, exported without any
+// local changes or VCS metadata, so that they describe what is locked rather
+// than what is checked out
+func scanExport(dep dependency.Dependency, repo repository.Repository, version string) (string, licenses.Report, error) {
+	exporter, ok := repo.(repository.ExportRepository)
+	if !ok {
+		report, err := licenses.Scan(dep.FullPath(GOPATH))
+		return "", report, err
+	}
+
+	tmpdir, err := ioutil.TempDir("", "gocart-sbom")
+	if err != nil {
+		return "", licenses.Report{}, err
+	}
+
+	defer os.RemoveAll(tmpdir)
+
+	exported := filepath.Join(tmpdir, "export")
+
+	err = exporter.Export(version, exported)
+	if err != nil {
+		return "", licenses.Report{}, err
+	}
+
+	hash, err := sbom.ContentHash(exported)
+	if err != nil {
+		return "", licenses.Report{}, err
+	}
+
+	report, err := licenses.Scan(exported)
+	if err != nil {
+		return "", licenses.Report{}, err
+	}
+
+	return hash, report, nil
+}
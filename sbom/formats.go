@@ -0,0 +1,294 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+const spdxNoAssertion = "NOASSERTION"
+
+// an SPDX 2.3 document in JSON, describing the project as a package that
+// depends on each component
+func SPDX(doc Document) ([]byte, error) {
+	ids := spdxIDs(doc)
+
+	out := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              doc.Name,
+		DocumentNamespace: fmt.Sprintf("https://%s/spdx/%s", doc.Name, doc.Created.UTC().Format("20060102150405")),
+		CreationInfo: spdxCreationInfo{
+			Created:  doc.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: gocart"},
+		},
+		Packages: []spdxPackage{
+			{
+				Name:             doc.Name,
+				SPDXID:           ids[doc.Name],
+				DownloadLocation: spdxNoAssertion,
+				LicenseConcluded: spdxNoAssertion,
+				LicenseDeclared:  spdxNoAssertion,
+				CopyrightText:    spdxNoAssertion,
+			},
+		},
+		Relationships: []spdxRelationship{
+			{"SPDXRef-DOCUMENT", "DESCRIBES", ids[doc.Name]},
+		},
+	}
+
+	for _, path := range doc.DependsOn {
+		out.Relationships = append(out.Relationships, spdxRelationship{ids[doc.Name], "DEPENDS_ON", ids[path]})
+	}
+
+	for _, component := range doc.Components {
+		pkg := spdxPackage{
+			Name:             component.Path,
+			SPDXID:           ids[component.Path],
+			VersionInfo:      component.Version,
+			DownloadLocation: spdxDownloadLocation(component),
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+			ExternalRefs: []spdxExternalRef{
+				{"PACKAGE-MANAGER", "purl", purl(component)},
+			},
+		}
+
+		if component.Hash != "" {
+			pkg.Checksums = []spdxChecksum{{"SHA256", component.Hash}}
+		}
+
+		if known := knownLicenses(component); len(known) > 0 {
+			pkg.LicenseDeclared = strings.Join(known, " AND ")
+		}
+
+		out.Packages = append(out.Packages, pkg)
+
+		for _, path := range component.DependsOn {
+			out.Relationships = append(out.Relationships, spdxRelationship{ids[component.Path], "DEPENDS_ON", ids[path]})
+		}
+	}
+
+	return marshal(out)
+}
+
+// SPDX identifiers may only contain letters, numbers, '.' and '-'
+func spdxIDs(doc Document) map[string]string {
+	ids := map[string]string{}
+	taken := map[string]bool{}
+
+	paths := []string{doc.Name}
+	for _, component := range doc.Components {
+		paths = append(paths, component.Path)
+	}
+
+	for _, path := range paths {
+		base := "SPDXRef-Package-" + strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+				return r
+			}
+
+			return '-'
+		}, path)
+
+		id := base
+		for n := 2; taken[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		taken[id] = true
+		ids[path] = id
+	}
+
+	return ids
+}
+
+// e.g. git+https://github.com/a/b@<revision>
+func spdxDownloadLocation(component Component) string {
+	switch {
+	case component.URL == "":
+		return spdxNoAssertion
+	case component.VCS == "archive":
+		return component.URL
+	default:
+		return component.VCS + "+" + component.URL + "@" + component.Version
+	}
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	Type               string              `json:"type"`
+	BOMRef             string              `json:"bom-ref"`
+	Name               string              `json:"name"`
+	Version            string              `json:"version,omitempty"`
+	PURL               string              `json:"purl,omitempty"`
+	Hashes             []cycloneDXHash     `json:"hashes,omitempty"`
+	Licenses           []cycloneDXLicense  `json:"licenses,omitempty"`
+	ExternalReferences []cycloneDXExternal `json:"externalReferences,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cycloneDXLicense struct {
+	License cycloneDXLicenseID `json:"license"`
+}
+
+type cycloneDXLicenseID struct {
+	ID string `json:"id"`
+}
+
+type cycloneDXExternal struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// a CycloneDX 1.4 BOM in JSON, with the project as its subject; components
+// are referred to by import path
+func CycloneDX(doc Document) ([]byte, error) {
+	out := cycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.4",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: doc.Created.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{"gocart"}},
+			Component: cycloneDXComponent{
+				Type:   "application",
+				BOMRef: doc.Name,
+				Name:   doc.Name,
+			},
+		},
+		Components: []cycloneDXComponent{},
+		Dependencies: []cycloneDXDependency{
+			{doc.Name, nonNil(doc.DependsOn)},
+		},
+	}
+
+	for _, component := range doc.Components {
+		entry := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  component.Path,
+			Name:    component.Path,
+			Version: component.Version,
+			PURL:    purl(component),
+		}
+
+		if component.Hash != "" {
+			entry.Hashes = []cycloneDXHash{{"SHA-256", component.Hash}}
+		}
+
+		for _, license := range knownLicenses(component) {
+			entry.Licenses = append(entry.Licenses, cycloneDXLicense{cycloneDXLicenseID{license}})
+		}
+
+		if component.URL != "" {
+			referenceType := "vcs"
+			if component.VCS == "archive" {
+				referenceType = "distribution"
+			}
+
+			entry.ExternalReferences = []cycloneDXExternal{{referenceType, component.URL}}
+		}
+
+		out.Components = append(out.Components, entry)
+
+		out.Dependencies = append(out.Dependencies, cycloneDXDependency{
+			component.Path,
+			nonNil(component.DependsOn),
+		})
+	}
+
+	return marshal(out)
+}
+
+func nonNil(paths []string) []string {
+	if paths == nil {
+		return []string{}
+	}
+
+	return paths
+}
+
+func marshal(doc interface{}) ([]byte, error) {
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
@@ -0,0 +1,127 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vito/gocart/archive"
+	"github.com/vito/gocart/licenses"
+)
+
+type Component struct {
+	Path string
+
+	// the resolved revision, or the checksum of an archive
+	Version string
+
+	// "git", "hg", "bzr", "svn" or "archive"
+	VCS string
+
+	// where the repository or archive is fetched from, if known
+	URL string
+
+	// the hex sha256 of the files at the version; see ContentHash
+	Hash string
+
+	// SPDX identifiers; see the licenses package
+	Licenses []string
+
+	// the import paths of the components it requires
+	DependsOn []string
+}
+
+type Document struct {
+	// the project's import path
+	Name string
+
+	Created time.Time
+
+	// the import paths of the components the project requires
+	DependsOn []string
+
+	Components []Component
+}
+
+type Format struct {
+	Name string
+
+	Generate func(Document) ([]byte, error)
+}
+
+var Formats = []Format{
+	{"spdx-json", SPDX},
+	{"cyclonedx-json", CycloneDX},
+}
+
+type UnknownFormatError struct {
+	Name string
+}
+
+func (e UnknownFormatError) Error() string {
+	names := []string{}
+	for _, format := range Formats {
+		names = append(names, format.Name)
+	}
+
+	return fmt.Sprintf(
+		"unknown sbom format '%s'; expected one of %s",
+		e.Name,
+		strings.Join(names, ", "),
+	)
+}
+
+func Lookup(name string) (Format, error) {
+	for _, format := range Formats {
+		if format.Name == name {
+			return format, nil
+		}
+	}
+
+	return Format{}, UnknownFormatError{name}
+}
+
+// a sha256 of every file's checksum and path in the directory, in order, so
+// that the same files give the same hash however they were fetched
+func ContentHash(dir string) (string, error) {
+	files, err := archive.Checksums(dir)
+	if err != nil {
+		return "", err
+	}
+
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	hash := sha256.New()
+
+	for _, path := range paths {
+		fmt.Fprintf(hash, "%s  %s\n", files[path], path)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// the package URL of the component, e.g. pkg:golang/github.com/a/b@<revision>
+func purl(component Component) string {
+	return "pkg:golang/" + component.Path + "@" + component.Version
+}
+
+// the licenses that were identified, leaving out 'unknown' and 'none'
+func knownLicenses(component Component) []string {
+	known := []string{}
+
+	for _, license := range component.Licenses {
+		if license != licenses.Unknown && license != licenses.None {
+			known = append(known, license)
+		}
+	}
+
+	return known
+}
@@ -0,0 +1,13 @@
+package sbom_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSbom(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sbom Suite")
+}
@@ -0,0 +1,203 @@
+package sbom_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/sbom"
+)
+
+var _ = Describe("Sbom", func() {
+	var doc sbom.Document
+
+	BeforeEach(func() {
+		doc = sbom.Document{
+			Name:      "github.com/some/project",
+			Created:   time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC),
+			DependsOn: []string{"github.com/a/b"},
+			Components: []sbom.Component{
+				{
+					Path:      "github.com/a/b",
+					Version:   "7c9d1a95d4b7979bc4180d4cb4aebfc036f276de",
+					VCS:       "git",
+					URL:       "https://github.com/a/b",
+					Hash:      "abc123",
+					Licenses:  []string{"Apache-2.0", "MIT"},
+					DependsOn: []string{"code.google.com/p/c"},
+				},
+				{
+					Path:     "code.google.com/p/c",
+					Version:  "42",
+					VCS:      "svn",
+					Licenses: []string{"unknown"},
+				},
+			},
+		}
+	})
+
+	Describe("Lookup", func() {
+		It("finds each format by name", func() {
+			format, err := sbom.Lookup("cyclonedx-json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(format.Name).To(Equal("cyclonedx-json"))
+		})
+
+		It("returns UnknownFormatError for anything else", func() {
+			_, err := sbom.Lookup("spdx-tv")
+			Expect(err).To(Equal(sbom.UnknownFormatError{Name: "spdx-tv"}))
+			Expect(err.Error()).To(ContainSubstring("spdx-json, cyclonedx-json"))
+		})
+	})
+
+	Describe("ContentHash", func() {
+		writeFiles := func() string {
+			dir, err := ioutil.TempDir("", "sbom")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(dir, "sub", "b.go"), []byte("package sub\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			return dir
+		}
+
+		It("is the same for the same files wherever they are", func() {
+			dirA := writeFiles()
+			defer os.RemoveAll(dirA)
+
+			dirB := writeFiles()
+			defer os.RemoveAll(dirB)
+
+			hashA, err := sbom.ContentHash(dirA)
+			Expect(err).ToNot(HaveOccurred())
+
+			hashB, err := sbom.ContentHash(dirB)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hashA).To(MatchRegexp(`^[0-9a-f]{64}$`))
+			Expect(hashA).To(Equal(hashB))
+
+			err = ioutil.WriteFile(filepath.Join(dirB, "sub", "b.go"), []byte("package changed\n"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			hashB, err = sbom.ContentHash(dirB)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hashB).ToNot(Equal(hashA))
+		})
+	})
+
+	Describe("SPDX", func() {
+		var out map[string]interface{}
+
+		BeforeEach(func() {
+			content, err := sbom.SPDX(doc)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = json.Unmarshal(content, &out)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		packageNamed := func(name string) map[string]interface{} {
+			for _, pkg := range out["packages"].([]interface{}) {
+				if pkg.(map[string]interface{})["name"] == name {
+					return pkg.(map[string]interface{})
+				}
+			}
+
+			Fail("no package named " + name)
+			return nil
+		}
+
+		It("describes the project and each component", func() {
+			Expect(out["spdxVersion"]).To(Equal("SPDX-2.3"))
+			Expect(out["packages"]).To(HaveLen(3))
+
+			pkg := packageNamed("github.com/a/b")
+			Expect(pkg["SPDXID"]).To(Equal("SPDXRef-Package-github.com-a-b"))
+			Expect(pkg["versionInfo"]).To(Equal("7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+			Expect(pkg["downloadLocation"]).To(Equal("git+https://github.com/a/b@7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+			Expect(pkg["licenseDeclared"]).To(Equal("Apache-2.0 AND MIT"))
+			Expect(pkg["checksums"]).To(Equal([]interface{}{
+				map[string]interface{}{"algorithm": "SHA256", "checksumValue": "abc123"},
+			}))
+		})
+
+		It("makes no assertion about what is not known", func() {
+			pkg := packageNamed("code.google.com/p/c")
+			Expect(pkg["downloadLocation"]).To(Equal("NOASSERTION"))
+			Expect(pkg["licenseDeclared"]).To(Equal("NOASSERTION"))
+			Expect(pkg).ToNot(HaveKey("checksums"))
+		})
+
+		It("relates the packages by their dependencies", func() {
+			Expect(out["relationships"]).To(Equal([]interface{}{
+				map[string]interface{}{
+					"spdxElementId":      "SPDXRef-DOCUMENT",
+					"relationshipType":   "DESCRIBES",
+					"relatedSpdxElement": "SPDXRef-Package-github.com-some-project",
+				},
+				map[string]interface{}{
+					"spdxElementId":      "SPDXRef-Package-github.com-some-project",
+					"relationshipType":   "DEPENDS_ON",
+					"relatedSpdxElement": "SPDXRef-Package-github.com-a-b",
+				},
+				map[string]interface{}{
+					"spdxElementId":      "SPDXRef-Package-github.com-a-b",
+					"relationshipType":   "DEPENDS_ON",
+					"relatedSpdxElement": "SPDXRef-Package-code.google.com-p-c",
+				},
+			}))
+		})
+	})
+
+	Describe("CycloneDX", func() {
+		var out map[string]interface{}
+
+		BeforeEach(func() {
+			content, err := sbom.CycloneDX(doc)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = json.Unmarshal(content, &out)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("describes each component", func() {
+			Expect(out["bomFormat"]).To(Equal("CycloneDX"))
+
+			components := out["components"].([]interface{})
+			Expect(components).To(HaveLen(2))
+
+			first := components[0].(map[string]interface{})
+			Expect(first["name"]).To(Equal("github.com/a/b"))
+			Expect(first["purl"]).To(Equal("pkg:golang/github.com/a/b@7c9d1a95d4b7979bc4180d4cb4aebfc036f276de"))
+			Expect(first["licenses"]).To(HaveLen(2))
+			Expect(first["externalReferences"]).To(Equal([]interface{}{
+				map[string]interface{}{"type": "vcs", "url": "https://github.com/a/b"},
+			}))
+
+			second := components[1].(map[string]interface{})
+			Expect(second).ToNot(HaveKey("licenses"))
+			Expect(second).ToNot(HaveKey("hashes"))
+		})
+
+		It("lists the dependencies of the project and each component", func() {
+			Expect(out["dependencies"]).To(Equal([]interface{}{
+				map[string]interface{}{"ref": "github.com/some/project", "dependsOn": []interface{}{"github.com/a/b"}},
+				map[string]interface{}{"ref": "github.com/a/b", "dependsOn": []interface{}{"code.google.com/p/c"}},
+				map[string]interface{}{"ref": "code.google.com/p/c", "dependsOn": []interface{}{}},
+			}))
+		})
+	})
+})
@@ -8,8 +8,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/vito/gocart/archive"
 	"github.com/vito/gocart/dependency"
 )
 
@@ -43,6 +46,29 @@ func (e MissingVersionError) Error() string {
 	return fmt.Sprintf("missing version for '%s'", e.Path)
 }
 
+type ArchiveVersionError struct {
+	Path    string
+	Version string
+}
+
+func (e ArchiveVersionError) Error() string {
+	return fmt.Sprintf(
+		"archive dependency '%s' must be versioned by its checksum, as '%s<hex>', not '%s'",
+		e.Path,
+		archive.ChecksumPrefix,
+		e.Version,
+	)
+}
+
+type InvalidAttributeError struct {
+	Path      string
+	Attribute string
+}
+
+func (e InvalidAttributeError) Error() string {
+	return fmt.Sprintf("invalid attribute for '%s': '%s'", e.Path, e.Attribute)
+}
+
 func LoadFrom(dir string) (*Set, error) {
 	cartridgeFilePath := filepath.Join(dir, CartridgeFile)
 	cartridgeLockFilePath := filepath.Join(dir, CartridgeLockFile)
@@ -70,23 +96,111 @@ func LoadFrom(dir string) (*Set, error) {
 	return set, nil
 }
 
+// reads a single Cartridge or Cartridge.lock, without merging the two
+func ReadFile(file string) (*Set, error) {
+	set := &Set{}
+
+	if err := set.readFrom(file); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// the line each dependency in a Cartridge or Cartridge.lock is declared on,
+// by path
+func Lines(file string) (map[string]int, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := map[string]int{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+
+		if _, found := lines[words[0]]; !found {
+			lines[words[0]] = line
+		}
+	}
+
+	return lines, nil
+}
+
+// the lock is written to a temporary file that then replaces it, so that
+// it is never left partially written
 func (s *Set) SaveTo(dir string) error {
-	file, err := os.Create(filepath.Join(dir, CartridgeLockFile))
+	lockPath := filepath.Join(dir, CartridgeLockFile)
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(lockPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	file, err := ioutil.TempFile(dir, "."+CartridgeLockFile)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+
+	defer os.Remove(file.Name())
 
 	_, err = s.WriteTo(file)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(file.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), lockPath)
 }
 
 func (s *Set) WriteTo(out io.Writer) (int64, error) {
 	var written int64
 
 	for _, dep := range s.Dependencies {
-		n, err := out.Write([]byte(dep.Path + "\t" + dep.Version + "\n"))
+		line := dep.Path + "\t" + dep.Version
+
+		submodulePaths := []string{}
+		for path := range dep.Submodules {
+			submodulePaths = append(submodulePaths, path)
+		}
+
+		sort.Strings(submodulePaths)
+
+		for _, path := range submodulePaths {
+			line += "\tsubmodule=" + path + "@" + dep.Submodules[path]
+		}
+
+		if dep.Remote != "" {
+			line += "\tremote=" + dep.Remote
+		}
+
+		if dep.Archive != "" {
+			line += "\tarchive=" + dep.Archive
+		}
+
+		n, err := out.Write([]byte(line + "\n"))
 
 		written += int64(n)
 
@@ -115,6 +229,8 @@ func (s *Set) UnmarshalText(text []byte) error {
 		words := bufio.NewScanner(bytes.NewReader(lines.Bytes()))
 		words.Split(bufio.ScanWords)
 
+		// path, version and tags are told apart by position; attributes may
+		// come anywhere after the version and are not counted
 		count := 0
 		dep := dependency.Dependency{}
 
@@ -123,6 +239,15 @@ func (s *Set) UnmarshalText(text []byte) error {
 				break
 			}
 
+			if count >= 2 && attributePattern.MatchString(words.Text()) {
+				err := parseAttribute(&dep, words.Text())
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
 			if count == 0 {
 				dep.Path = words.Text()
 			} else if count == 1 {
@@ -147,13 +272,18 @@ func (s *Set) UnmarshalText(text []byte) error {
 			return MissingVersionError{dep.Path}
 		}
 
-		// check for dupes
-		for _, existing := range s.Dependencies {
-			if strings.HasPrefix(dep.Path+"/", existing.Path+"/") {
-				return DuplicateDependencyError{existing, dep}
+		if dep.Archive != "" && !strings.HasPrefix(dep.Version, archive.ChecksumPrefix) {
+			version := dep.Version
+			if dep.BleedingEdge {
+				version = "*"
 			}
 
-			if strings.HasPrefix(existing.Path+"/", dep.Path+"/") {
+			return ArchiveVersionError{dep.Path, version}
+		}
+
+		// check for dupes
+		for _, existing := range s.Dependencies {
+			if existing.Contains(dep.Path) || dep.Contains(existing.Path) {
 				return DuplicateDependencyError{existing, dep}
 			}
 		}
@@ -168,8 +298,61 @@ func (s *Set) Replace(ldep dependency.Dependency) {
 	for i, dep := range s.Dependencies {
 		if dep.Path == ldep.Path {
 			s.Dependencies[i].Version = ldep.Version
+			s.Dependencies[i].Submodules = ldep.Submodules
+			s.Dependencies[i].Remote = ldep.Remote
+			s.Dependencies[i].Archive = ldep.Archive
+		}
+	}
+}
+
+func (s *Set) Lookup(importPath string) (dependency.Dependency, bool) {
+	for _, dep := range s.Dependencies {
+		if dep.Contains(importPath) {
+			return dep, true
+		}
+	}
+
+	return dependency.Dependency{}, false
+}
+
+// attributes follow the version as key=value words, e.g.
+// 'submodule=vendor/foo@<sha>', 'remote=<url>' or 'archive=<url>'
+// attributes are named by a plain word, e.g. 'remote=...'; anything else
+// with an '=' in it, e.g. 'test,os=linux', is the tag column
+var attributePattern = regexp.MustCompile(`^[a-z]+=`)
+
+func parseAttribute(dep *dependency.Dependency, word string) error {
+	segments := strings.SplitN(word, "=", 2)
+
+	switch segments[0] {
+	case "submodule":
+		at := strings.LastIndex(segments[1], "@")
+		if at <= 0 || at == len(segments[1])-1 {
+			return InvalidAttributeError{dep.Path, word}
+		}
+
+		if dep.Submodules == nil {
+			dep.Submodules = make(map[string]string)
+		}
+
+		dep.Submodules[segments[1][:at]] = segments[1][at+1:]
+	case "remote":
+		if segments[1] == "" {
+			return InvalidAttributeError{dep.Path, word}
 		}
+
+		dep.Remote = segments[1]
+	case "archive":
+		if segments[1] == "" {
+			return InvalidAttributeError{dep.Path, word}
+		}
+
+		dep.Archive = segments[1]
+	default:
+		return InvalidAttributeError{dep.Path, word}
 	}
+
+	return nil
 }
 
 func (s *Set) readFrom(file string) error {
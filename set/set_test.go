@@ -110,6 +110,165 @@ github.com/onsi/gomega	origin/faster # what the heck come after buzz
 			}))
 		})
 
+		It("parses submodule versions following the version", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte(
+				"github.com/vito/gocart some-sha submodule=vendor/foo@foo-sha submodule=vendor/bar@bar-sha",
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "github.com/vito/gocart",
+					Version: "some-sha",
+					Submodules: map[string]string{
+						"vendor/foo": "foo-sha",
+						"vendor/bar": "bar-sha",
+					},
+				},
+			}))
+		})
+
+		It("parses tags alongside attributes", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte(
+				"github.com/vito/gocart origin/master test submodule=vendor/foo@foo-sha",
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "github.com/vito/gocart",
+					Version: "origin/master",
+					Tags:    []string{"test"},
+					Submodules: map[string]string{
+						"vendor/foo": "foo-sha",
+					},
+				},
+			}))
+		})
+
+		It("parses tags following attributes", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte(
+				"github.com/vito/gocart origin/master submodule=vendor/foo@foo-sha test",
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "github.com/vito/gocart",
+					Version: "origin/master",
+					Tags:    []string{"test"},
+					Submodules: map[string]string{
+						"vendor/foo": "foo-sha",
+					},
+				},
+			}))
+		})
+
+		It("parses tags containing '=' as tags", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte(
+				"github.com/vito/gocart origin/master test,os=linux remote=https://example.com/gocart.git",
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "github.com/vito/gocart",
+					Version: "origin/master",
+					Tags:    []string{"test", "os=linux"},
+					Remote:  "https://example.com/gocart.git",
+				},
+			}))
+		})
+
+		It("parses the remote following the version", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte(
+				"github.com/ourco/lib some-sha remote=ssh://git@git.ourco.com/lib.git",
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "github.com/ourco/lib",
+					Version: "some-sha",
+					Remote:  "ssh://git@git.ourco.com/lib.git",
+				},
+			}))
+		})
+
+		It("parses archive dependencies", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte(
+				"example.com/lib sha256:abc archive=https://example.com/lib-1.2.tar.gz",
+			))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "example.com/lib",
+					Version: "sha256:abc",
+					Archive: "https://example.com/lib-1.2.tar.gz",
+				},
+			}))
+		})
+
+		It("parses tags on either side of an archive", func() {
+			for _, line := range []string{
+				"example.com/lib sha256:abc test archive=https://example.com/lib-1.2.tar.gz",
+				"example.com/lib sha256:abc archive=https://example.com/lib-1.2.tar.gz test",
+			} {
+				newSet := &Set{}
+
+				err := newSet.UnmarshalText([]byte(line))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(newSet.Dependencies).Should(Equal([]dependency.Dependency{
+					{
+						Path:    "example.com/lib",
+						Version: "sha256:abc",
+						Tags:    []string{"test"},
+						Archive: "https://example.com/lib-1.2.tar.gz",
+					},
+				}))
+			}
+		})
+
+		It("fails if an archive dependency is not versioned by its checksum", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte("example.com/lib v1.2 archive=https://example.com/lib-1.2.tar.gz"))
+			Ω(err).Should(Equal(ArchiveVersionError{"example.com/lib", "v1.2"}))
+
+			newSet = &Set{}
+
+			err = newSet.UnmarshalText([]byte("example.com/lib * archive=https://example.com/lib-1.2.tar.gz"))
+			Ω(err).Should(Equal(ArchiveVersionError{"example.com/lib", "*"}))
+		})
+
+		It("fails if an attribute is unknown", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte("github.com/vito/gocart origin/master foo=bar"))
+			Ω(err).Should(Equal(InvalidAttributeError{"github.com/vito/gocart", "foo=bar"}))
+		})
+
+		It("fails if a submodule attribute is missing its version", func() {
+			newSet := &Set{}
+
+			err := newSet.UnmarshalText([]byte("github.com/vito/gocart origin/master submodule=vendor/foo"))
+			Ω(err).Should(Equal(InvalidAttributeError{"github.com/vito/gocart", "submodule=vendor/foo"}))
+		})
+
 		It("fails if a dependency is missing its version", func() {
 			newSet := &Set{}
 
@@ -201,6 +360,81 @@ github.com/onsi/ginkgobiloba	origin/faster
 		})
 	})
 
+	Describe("WriteTo with submodules", func() {
+		It("writes them as sorted attributes following the version", func() {
+			submoduleSet := &Set{
+				[]dependency.Dependency{
+					{
+						Path:    "github.com/vito/gocart",
+						Version: "some-sha",
+						Submodules: map[string]string{
+							"vendor/foo": "foo-sha",
+							"vendor/bar": "bar-sha",
+						},
+					},
+				},
+			}
+
+			buf := new(bytes.Buffer)
+
+			_, err := submoduleSet.WriteTo(buf)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(buf.String()).Should(Equal(
+				"github.com/vito/gocart\tsome-sha\tsubmodule=vendor/bar@bar-sha\tsubmodule=vendor/foo@foo-sha\n",
+			))
+		})
+	})
+
+	Describe("WriteTo with a remote", func() {
+		It("writes it as an attribute after the submodules", func() {
+			remoteSet := &Set{
+				[]dependency.Dependency{
+					{
+						Path:    "github.com/ourco/lib",
+						Version: "some-sha",
+						Submodules: map[string]string{
+							"vendor/foo": "foo-sha",
+						},
+						Remote: "ssh://git@git.ourco.com/lib.git",
+					},
+				},
+			}
+
+			buf := new(bytes.Buffer)
+
+			_, err := remoteSet.WriteTo(buf)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(buf.String()).Should(Equal(
+				"github.com/ourco/lib\tsome-sha\tsubmodule=vendor/foo@foo-sha\tremote=ssh://git@git.ourco.com/lib.git\n",
+			))
+		})
+	})
+
+	Describe("WriteTo with an archive", func() {
+		It("writes its URL as an attribute", func() {
+			archiveSet := &Set{
+				[]dependency.Dependency{
+					{
+						Path:    "example.com/lib",
+						Version: "sha256:abc",
+						Archive: "https://example.com/lib-1.2.tar.gz",
+					},
+				},
+			}
+
+			buf := new(bytes.Buffer)
+
+			_, err := archiveSet.WriteTo(buf)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(buf.String()).Should(Equal(
+				"example.com/lib\tsha256:abc\tarchive=https://example.com/lib-1.2.tar.gz\n",
+			))
+		})
+	})
+
 	Describe("SaveTo", func() {
 		var projectDir string
 
@@ -229,6 +463,28 @@ github.com/onsi/ginkgobiloba	origin/faster
 
 			Ω(newSet).Should(Equal(set))
 		})
+
+		It("replaces an existing Cartridge.lock without leaving temporary files", func() {
+			lockPath := filepath.Join(projectDir, "Cartridge.lock")
+
+			err := ioutil.WriteFile(lockPath, []byte("some-old-content"), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = set.SaveTo(projectDir)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bytes, err := ioutil.ReadFile(lockPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(bytes)).ShouldNot(ContainSubstring("some-old-content"))
+
+			info, err := os.Stat(lockPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+
+			files, err := ioutil.ReadDir(projectDir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(files).Should(HaveLen(1))
+		})
 	})
 
 	Describe("LoadFrom", func() {
@@ -367,6 +623,52 @@ github.com/onsi/ginkgo origin/blaster
 		})
 	})
 
+	Describe("ReadFile and Lines", func() {
+		var cartridgeFilePath string
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile(os.TempDir(), "gocart-cartridge")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer file.Close()
+
+			cartridgeFilePath = file.Name()
+
+			file.Write([]byte("# pinned\ngithub.com/vito/gocart\torigin/master\n\ngithub.com/onsi/ginkgo\t*\ttest\n"))
+		})
+
+		AfterEach(func() {
+			os.Remove(cartridgeFilePath)
+		})
+
+		It("reads the file on its own", func() {
+			set, err := ReadFile(cartridgeFilePath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(set.Dependencies).Should(Equal([]dependency.Dependency{
+				{
+					Path:    "github.com/vito/gocart",
+					Version: "origin/master",
+				},
+				{
+					Path:         "github.com/onsi/ginkgo",
+					BleedingEdge: true,
+					Tags:         []string{"test"},
+				},
+			}))
+		})
+
+		It("finds the line of each dependency", func() {
+			lines, err := Lines(cartridgeFilePath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(lines).Should(Equal(map[string]int{
+				"github.com/vito/gocart": 2,
+				"github.com/onsi/ginkgo": 4,
+			}))
+		})
+	})
+
 	Describe("Replace", func() {
 		It("replaces an existing dependency", func() {
 			set.Replace(dependency.Dependency{
@@ -386,4 +688,17 @@ github.com/onsi/ginkgo origin/blaster
 			}))
 		})
 	})
+
+	Describe("Lookup", func() {
+		It("returns the dependency containing the import path", func() {
+			dep, found := set.Lookup("github.com/onsi/ginkgo/config")
+			Ω(found).Should(BeTrue())
+			Ω(dep.Path).Should(Equal("github.com/onsi/ginkgo"))
+		})
+
+		It("returns false when no dependency contains the import path", func() {
+			_, found := set.Lookup("github.com/onsi/ginkgobiloba")
+			Ω(found).Should(BeFalse())
+		})
+	})
 })
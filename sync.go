@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/vito/gocart/fetcher"
+	"github.com/vito/gocart/repository"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+)
+
+const StashMessage = "gocart sync"
+
+func sync(root string, stash bool, filter tags.Filter, nested *tags.NestedFilters) {
+	locks := lockInstallation(root)
+	defer releaseLocks(locks)
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	fetcher, err := fetcher.New(Runner)
+	if err != nil {
+		fatal(err)
+	}
+
+	fetcher.Retry = retryPolicy()
+	fetcher.Verbose = *verbose
+	fetcher.Rewrites = rewrites
+	fetcher.Cache = *archiveCache
+
+	unsynced := syncDependencies(fetcher, cartridge, stash, filter, nested, 0)
+
+	if unsynced {
+		os.Exit(1)
+	}
+}
+
+func syncDependencies(fetcher *fetcher.Fetcher, deps *set.Set, stash bool, filter tags.Filter, nested *tags.NestedFilters, depth int) bool {
+	unsynced := false
+
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		err := checkForDirtyState(dep)
+
+		if dirty, ok := err.(DirtyState); ok && stash {
+			err = stashChanges(dep.FullPath(GOPATH))
+			if err != nil {
+				err = fmt.Errorf("could not stash local changes: %s\n%s", err, dirty)
+			} else {
+				fmt.Println(indent(depth, bold(dep.Path)), "stashed local changes")
+				err = checkForDirtyState(dep)
+			}
+		}
+
+		switch err.(type) {
+		case nil:
+			fmt.Println(indent(depth, bold(dep.Path)), green("OK"))
+
+		case VersionMismatch, RemoteMismatch:
+			err := fetcher.Sync(dep)
+			if err != nil {
+				unsynced = true
+
+				fmt.Println(indent(depth, bold(dep.Path)), red("failed"))
+				fmt.Println(indent(depth+1, err.Error()))
+			} else {
+				fmt.Println(indent(depth, bold(dep.Path)), green("synced to "+dep.Version))
+			}
+
+		default:
+			unsynced = true
+
+			fmt.Println(indent(depth, bold(dep.Path)), red("skipped"))
+			fmt.Println(indent(depth+1, err.Error()))
+		}
+
+		nextDeps, err := set.LoadFrom(dep.FullPath(GOPATH))
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			fatal(err)
+		}
+
+		if syncDependencies(fetcher, nextDeps, stash, nested.For(dep.Path), nested, depth+1) {
+			unsynced = true
+		}
+	}
+
+	return unsynced
+}
+
+func stashChanges(repoPath string) error {
+	repo, err := repository.New(repoPath, Runner)
+	if err != nil {
+		return err
+	}
+
+	stasher, ok := repo.(repository.StashRepository)
+	if !ok {
+		return errors.New("the repository does not support stashing")
+	}
+
+	return stasher.Stash(StashMessage)
+}
@@ -0,0 +1,176 @@
+package tags
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Filter selects dependencies by their tags.
+//
+// Dependencies with any excluded tag are never selected. If any tags are
+// included, tagged dependencies must have at least one of them; untagged
+// dependencies are always selected unless excluded.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+type InvalidExpressionError struct {
+	Expression string
+}
+
+func (e InvalidExpressionError) Error() string {
+	return fmt.Sprintf("invalid tag expression: '%s'", e.Expression)
+}
+
+// ParseFilter parses a comma-separated list of tags, each of which may be
+// negated with a '!', e.g. 'integration,!test'.
+func ParseFilter(expr string) (Filter, error) {
+	filter := Filter{}
+
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+
+		if term == "" {
+			continue
+		}
+
+		negated := strings.HasPrefix(term, "!")
+		tag := strings.TrimPrefix(term, "!")
+
+		if tag == "" || strings.ContainsAny(tag, "! \t=") {
+			return Filter{}, InvalidExpressionError{expr}
+		}
+
+		if negated {
+			filter.Exclude = append(filter.Exclude, tag)
+		} else {
+			filter.Include = append(filter.Include, tag)
+		}
+	}
+
+	return filter, nil
+}
+
+func (f Filter) Excluding(tags ...string) Filter {
+	exclude := append([]string{}, f.Exclude...)
+
+	for _, tag := range tags {
+		if tag != "" {
+			exclude = append(exclude, tag)
+		}
+	}
+
+	return Filter{
+		Include: f.Include,
+		Exclude: exclude,
+	}
+}
+
+func (f Filter) Matches(tags []string) bool {
+	if Intersect(tags, f.Exclude) {
+		return false
+	}
+
+	if len(tags) == 0 || len(f.Include) == 0 {
+		return true
+	}
+
+	return Intersect(tags, f.Include)
+}
+
+func (f Filter) String() string {
+	terms := append([]string{}, f.Include...)
+
+	for _, tag := range f.Exclude {
+		terms = append(terms, "!"+tag)
+	}
+
+	return strings.Join(terms, ",")
+}
+
+// NestedFilters holds the filters applied to the Cartridges of dependencies,
+// either for every library or for a specific one. It can be used as a
+// flag.Value; each value is either an expression or 'import/path=expression'.
+type NestedFilters struct {
+	Default   Filter
+	Libraries map[string]Filter
+}
+
+func NewNestedFilters(defaultFilter Filter) *NestedFilters {
+	return &NestedFilters{
+		Default:   defaultFilter,
+		Libraries: make(map[string]Filter),
+	}
+}
+
+func (n *NestedFilters) For(path string) Filter {
+	filter, found := n.Libraries[path]
+	if found {
+		return filter
+	}
+
+	return n.Default
+}
+
+func (n *NestedFilters) Set(value string) error {
+	path := ""
+	expr := value
+
+	segments := strings.SplitN(value, "=", 2)
+	if len(segments) == 2 {
+		path = segments[0]
+		expr = segments[1]
+
+		if path == "" {
+			return InvalidExpressionError{value}
+		}
+	}
+
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		n.Default = filter
+	} else {
+		n.Libraries[path] = filter
+	}
+
+	return nil
+}
+
+func (n *NestedFilters) String() string {
+	if n == nil {
+		return ""
+	}
+
+	values := []string{n.Default.String()}
+
+	paths := []string{}
+	for path := range n.Libraries {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		values = append(values, path+"="+n.Libraries[path].String())
+	}
+
+	return strings.Join(values, " ")
+}
+
+func Intersect(as, bs []string) bool {
+	for _, atag := range as {
+		for _, btag := range bs {
+			if atag == btag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
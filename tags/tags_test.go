@@ -0,0 +1,160 @@
+package tags_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/vito/gocart/tags"
+)
+
+var _ = Describe("Filter", func() {
+	Describe("ParseFilter", func() {
+		It("parses included and excluded tags", func() {
+			filter, err := ParseFilter("integration,!test")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(filter).Should(Equal(Filter{
+				Include: []string{"integration"},
+				Exclude: []string{"test"},
+			}))
+		})
+
+		It("ignores blank terms and surrounding whitespace", func() {
+			filter, err := ParseFilter(" integration, ,!test,")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(filter).Should(Equal(Filter{
+				Include: []string{"integration"},
+				Exclude: []string{"test"},
+			}))
+		})
+
+		It("parses an empty expression as selecting everything", func() {
+			filter, err := ParseFilter("")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(filter).Should(Equal(Filter{}))
+		})
+
+		It("fails on a bare negation", func() {
+			_, err := ParseFilter("integration,!")
+			Ω(err).Should(Equal(InvalidExpressionError{"integration,!"}))
+		})
+
+		It("fails on a double negation", func() {
+			_, err := ParseFilter("!!test")
+			Ω(err).Should(Equal(InvalidExpressionError{"!!test"}))
+		})
+	})
+
+	Describe("Matches", func() {
+		It("matches everything when empty", func() {
+			Ω(Filter{}.Matches(nil)).Should(BeTrue())
+			Ω(Filter{}.Matches([]string{"test"})).Should(BeTrue())
+		})
+
+		It("does not match anything with an excluded tag", func() {
+			filter := Filter{Exclude: []string{"test"}}
+
+			Ω(filter.Matches(nil)).Should(BeTrue())
+			Ω(filter.Matches([]string{"test"})).Should(BeFalse())
+			Ω(filter.Matches([]string{"development", "test"})).Should(BeFalse())
+		})
+
+		It("only matches tagged dependencies with an included tag", func() {
+			filter := Filter{Include: []string{"integration"}}
+
+			Ω(filter.Matches(nil)).Should(BeTrue())
+			Ω(filter.Matches([]string{"integration"})).Should(BeTrue())
+			Ω(filter.Matches([]string{"test"})).Should(BeFalse())
+		})
+
+		It("prefers exclusion over inclusion", func() {
+			filter := Filter{
+				Include: []string{"integration"},
+				Exclude: []string{"test"},
+			}
+
+			Ω(filter.Matches([]string{"integration", "test"})).Should(BeFalse())
+		})
+	})
+
+	Describe("Excluding", func() {
+		It("returns a filter that also excludes the given tags", func() {
+			filter := Filter{Include: []string{"integration"}}
+
+			Ω(filter.Excluding("test", "")).Should(Equal(Filter{
+				Include: []string{"integration"},
+				Exclude: []string{"test"},
+			}))
+
+			Ω(filter.Exclude).Should(BeEmpty())
+		})
+	})
+
+	Describe("String", func() {
+		It("returns the filter as an expression", func() {
+			filter := Filter{
+				Include: []string{"integration"},
+				Exclude: []string{"test"},
+			}
+
+			Ω(filter.String()).Should(Equal("integration,!test"))
+		})
+	})
+})
+
+var _ = Describe("NestedFilters", func() {
+	var nested *NestedFilters
+
+	BeforeEach(func() {
+		nested = NewNestedFilters(Filter{Exclude: []string{"test"}})
+	})
+
+	It("returns the default filter for any library", func() {
+		Ω(nested.For("github.com/vito/cmdtest")).Should(Equal(Filter{
+			Exclude: []string{"test"},
+		}))
+	})
+
+	Describe("Set", func() {
+		It("replaces the default filter when given an expression", func() {
+			err := nested.Set("integration")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(nested.For("github.com/vito/cmdtest")).Should(Equal(Filter{
+				Include: []string{"integration"},
+			}))
+		})
+
+		It("sets the filter for a specific library when given path=expression", func() {
+			err := nested.Set("github.com/vito/cmdtest=test")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(nested.For("github.com/vito/cmdtest")).Should(Equal(Filter{
+				Include: []string{"test"},
+			}))
+
+			Ω(nested.For("github.com/vito/gocart")).Should(Equal(Filter{
+				Exclude: []string{"test"},
+			}))
+		})
+
+		It("allows an empty expression for a specific library", func() {
+			err := nested.Set("github.com/vito/cmdtest=")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(nested.For("github.com/vito/cmdtest")).Should(Equal(Filter{}))
+		})
+
+		It("fails when the path is missing", func() {
+			err := nested.Set("=test")
+			Ω(err).Should(Equal(InvalidExpressionError{"=test"}))
+		})
+
+		It("fails when the expression is invalid", func() {
+			err := nested.Set("github.com/vito/cmdtest=!")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -6,19 +6,38 @@ import (
 	"strings"
 )
 
+// set by '-output plain' to leave out colors and other escape codes
+var plainOutput = false
+
 func bold(str string) string {
+	if plainOutput {
+		return str
+	}
+
 	return "\x1b[1m" + str + "\x1b[0m"
 }
 
 func red(str string) string {
+	if plainOutput {
+		return str
+	}
+
 	return "\x1b[31m" + str + "\x1b[0m"
 }
 
 func green(str string) string {
+	if plainOutput {
+		return str
+	}
+
 	return "\x1b[32m" + str + "\x1b[0m"
 }
 
 func cyan(str string) string {
+	if plainOutput {
+		return str
+	}
+
 	return "\x1b[36m" + str + "\x1b[0m"
 }
 
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/vito/gocart/dependency"
+	"github.com/vito/gocart/fetcher"
+	"github.com/vito/gocart/repository"
+	"github.com/vito/gocart/set"
+	"github.com/vito/gocart/tags"
+	"github.com/vito/gocart/vendoring"
+)
+
+func vendor(root string, recursive bool, filter tags.Filter, nested *tags.NestedFilters) {
+	if _, err := os.Stat(filepath.Join(root, CartridgeLockFile)); err != nil {
+		fatal("no " + CartridgeLockFile + "; run 'gocart install' first")
+	}
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	locks := lockInstallation(root)
+	defer releaseLocks(locks)
+
+	vendorDir, err := filepath.Abs(filepath.Join(root, vendoring.Directory))
+	if err != nil {
+		fatal(err)
+	}
+
+	err = os.MkdirAll(vendorDir, 0755)
+	if err != nil {
+		fatal(err)
+	}
+
+	previous, err := vendoring.ReadManifest(vendorDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	vendored := &vendoring.Manifest{}
+
+	err = vendorDependencies(vendorDir, cartridge, previous, vendored, recursive, filter, nested, 0)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, entry := range previous.Entries {
+		if _, found := vendored.Lookup(entry.Path); found {
+			continue
+		}
+
+		err := removeVendored(vendorDir, entry.Path)
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Println(bold(entry.Path), "removed")
+	}
+
+	err = vendored.Save(vendorDir)
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func vendorDependencies(vendorDir string, deps *set.Set, previous *vendoring.Manifest, vendored *vendoring.Manifest, recursive bool, filter tags.Filter, nested *tags.NestedFilters, depth int) error {
+	maxWidth := 0
+
+	for _, dep := range deps.Dependencies {
+		if len(dep.Path) > maxWidth {
+			maxWidth = len(dep.Path)
+		}
+	}
+
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) {
+			continue
+		}
+
+		version, err := vendorDependency(vendorDir, dep, previous, vendored)
+		if err != nil {
+			return fmt.Errorf("failed to vendor %s:\n%s", dep.Path, indent(1, err.Error()))
+		}
+
+		fmt.Println(
+			indent(
+				depth,
+				bold(dep.Path)+padding(maxWidth-len(dep.Path)+2)+cyan(version),
+			),
+		)
+
+		if recursive {
+			// the exported Cartridge is the one for the vendored version
+			nextDeps, err := set.LoadFrom(filepath.Join(vendorDir, dep.Path))
+			if err == set.NoCartridgeError {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			err = vendorDependencies(vendorDir, nextDeps, previous, vendored, true, nested.For(dep.Path), nested, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// exports the dependency's repository at its version into the vendor
+// directory, unless it is already there unmodified, returning the version
+func vendorDependency(vendorDir string, dep dependency.Dependency, previous *vendoring.Manifest, vendored *vendoring.Manifest) (string, error) {
+	if dep.Version == "" {
+		return "", fmt.Errorf("no locked version; run 'gocart install' first")
+	}
+
+	repoPath := dep.FullPath(GOPATH)
+
+	if _, err := os.Stat(repoPath); err != nil {
+		return "", fmt.Errorf("not installed in %s; run 'gocart install' first", repoPath)
+	}
+
+	repo, err := repository.New(repoPath, Runner)
+	if err != nil {
+		return "", err
+	}
+
+	exporter, ok := repo.(repository.ExportRepository)
+	if !ok {
+		return "", fmt.Errorf("cannot export %s", repoPath)
+	}
+
+	version, err := repo.ResolveVersion(dep.Version)
+	if err != nil {
+		return "", err
+	}
+
+	if entry, found := vendored.Lookup(dep.Path); found {
+		if entry.Version != version {
+			return "", fetcher.VersionConflictError{
+				Path:     dep.Path,
+				VersionA: entry.Version,
+				VersionB: version,
+			}
+		}
+
+		// already vendored by another Cartridge
+		return version, nil
+	}
+
+	if entry, found := previous.Lookup(dep.Path); found && entry.Version == version {
+		modified, missing, untracked, err := entry.Verify(vendorDir)
+		if err != nil {
+			return "", err
+		}
+
+		if len(modified)+len(missing)+len(untracked) == 0 {
+			vendored.Add(entry)
+			return version, nil
+		}
+	}
+
+	// export beside the vendor directory's contents, so that the old files
+	// are only replaced once the export has succeeded
+	tmpdir, err := ioutil.TempDir(vendorDir, ".gocart-vendor")
+	if err != nil {
+		return "", err
+	}
+
+	defer os.RemoveAll(tmpdir)
+
+	exported := filepath.Join(tmpdir, "export")
+
+	err = exporter.Export(version, exported)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(vendorDir, dep.Path)
+
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(exported, dest)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := vendoring.Record(vendorDir, dep.Path, version)
+	if err != nil {
+		return "", err
+	}
+
+	vendored.Add(entry)
+
+	return version, nil
+}
+
+// removes the vendored path, along with any directories it leaves empty
+func removeVendored(vendorDir string, path string) error {
+	dest := filepath.Join(vendorDir, path)
+
+	err := os.RemoveAll(dest)
+	if err != nil {
+		return err
+	}
+
+	for dir := filepath.Dir(dest); strings.HasPrefix(dir, vendorDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		// fails if the directory is not empty
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+type VendoredVersionMismatch struct {
+	Expected string
+	Actual   string
+}
+
+func (self VendoredVersionMismatch) Error() string {
+	return fmt.Sprintf(
+		"vendored version mismatch:\n%s\n%s\n",
+		indent(1, "want "+red(self.Expected)),
+		indent(1, "have "+green(self.Actual)),
+	)
+}
+
+// compares the vendor directory against Cartridge.lock and the files that
+// were vendored, exiting nonzero if anything differs
+func checkVendor(root string, recursive bool, filter tags.Filter, nested *tags.NestedFilters) {
+	if _, err := os.Stat(filepath.Join(root, CartridgeLockFile)); err != nil {
+		fatal("no " + CartridgeLockFile + " to check against")
+	}
+
+	cartridge, err := set.LoadFrom(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	vendorDir := filepath.Join(root, vendoring.Directory)
+
+	manifest, err := vendoring.ReadManifest(vendorDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	checked := map[string]bool{}
+
+	dirty := checkVendoredDependencies(vendorDir, manifest, checked, cartridge, true, recursive, filter, nested, 0)
+
+	// entries skipped by -t/-x/-n, or nested without -r, are still locked
+	locked := map[string]bool{}
+	lockedGraph(vendorDir, cartridge, locked)
+
+	for _, entry := range manifest.Entries {
+		if checked[entry.Path] || locked[entry.Path] {
+			continue
+		}
+
+		dirty = true
+
+		fmt.Println(bold(entry.Path))
+		fmt.Println(indent(1, "vendored, but not in "+CartridgeLockFile))
+	}
+
+	if dirty {
+		os.Exit(1)
+	}
+}
+
+// versions are only compared if they're locked; others were resolved when
+// they were vendored
+func checkVendoredDependencies(vendorDir string, manifest *vendoring.Manifest, checked map[string]bool, deps *set.Set, locked bool, recursive bool, filter tags.Filter, nested *tags.NestedFilters, depth int) bool {
+	dirty := false
+
+	for _, dep := range deps.Dependencies {
+		if !filter.Matches(dep.Tags) || checked[dep.Path] {
+			continue
+		}
+
+		checked[dep.Path] = true
+
+		err := checkVendored(vendorDir, manifest, dep, locked)
+		if err != nil {
+			dirty = true
+
+			fmt.Println(indent(depth, bold(dep.Path)))
+			fmt.Println(indent(depth+1, err.Error()))
+		} else {
+			fmt.Println(indent(depth, bold(dep.Path)), green("OK"))
+		}
+
+		if !recursive {
+			continue
+		}
+
+		depDir := filepath.Join(vendorDir, dep.Path)
+
+		nextDeps, err := set.LoadFrom(depDir)
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			fatal(err)
+		}
+
+		_, err = os.Stat(filepath.Join(depDir, CartridgeLockFile))
+		nextLocked := err == nil
+
+		if checkVendoredDependencies(vendorDir, manifest, checked, nextDeps, nextLocked, true, nested.For(dep.Path), nested, depth+1) {
+			dirty = true
+		}
+	}
+
+	return dirty
+}
+
+// collects the path of every dependency, and those of the Cartridges they
+// were vendored with in turn, regardless of tags
+func lockedGraph(vendorDir string, deps *set.Set, paths map[string]bool) {
+	for _, dep := range deps.Dependencies {
+		if paths[dep.Path] {
+			continue
+		}
+
+		paths[dep.Path] = true
+
+		nextDeps, err := set.LoadFrom(filepath.Join(vendorDir, dep.Path))
+		if err == set.NoCartridgeError {
+			continue
+		} else if err != nil {
+			fatal(err)
+		}
+
+		lockedGraph(vendorDir, nextDeps, paths)
+	}
+}
+
+// e.g. a 12-character hg node id
+var abbreviatedID = regexp.MustCompile(`^[0-9a-f]{7,39}$`)
+
+// whether the locked version is the vendored one, which is always in
+// canonical form; locks from older releases may have abbreviated hg node ids
+// or bzr revnos, resolved with the dependency's checkout if it's installed
+func sameVersion(dep dependency.Dependency, vendoredVersion string) bool {
+	if dep.Version == vendoredVersion {
+		return true
+	}
+
+	repoPath := dep.FullPath(GOPATH)
+
+	if _, err := os.Stat(repoPath); err == nil {
+		repo, err := repository.New(repoPath, Runner)
+		if err == nil {
+			resolved, err := repo.ResolveVersion(dep.Version)
+			if err == nil && resolved != "" {
+				return resolved == vendoredVersion
+			}
+		}
+	}
+
+	return abbreviatedID.MatchString(dep.Version) && strings.HasPrefix(vendoredVersion, dep.Version)
+}
+
+func checkVendored(vendorDir string, manifest *vendoring.Manifest, dep dependency.Dependency, locked bool) error {
+	entry, found := manifest.Lookup(dep.Path)
+	if !found {
+		return fmt.Errorf("not vendored; run 'gocart vendor'")
+	}
+
+	if locked && !sameVersion(dep, entry.Version) {
+		return VendoredVersionMismatch{
+			Expected: dep.Version,
+			Actual:   entry.Version,
+		}
+	}
+
+	modified, missing, untracked, err := entry.Verify(vendorDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	files := []repository.FileStatus{}
+
+	for _, path := range modified {
+		files = append(files, repository.FileStatus{Path: path, State: repository.Modified})
+	}
+
+	for _, path := range missing {
+		files = append(files, repository.FileStatus{Path: path, State: repository.Missing})
+	}
+
+	for _, path := range untracked {
+		files = append(files, repository.FileStatus{Path: path, State: repository.Untracked})
+	}
+
+	if len(files) != 0 {
+		return DirtyState{Files: files}
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package vendoring
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vito/gocart/archive"
+)
+
+// where dependencies are vendored, relative to the project
+const Directory = "vendor"
+
+// written into the vendor directory to record what was vendored
+const ManifestFile = "gocart.manifest"
+
+type Entry struct {
+	Path    string
+	Version string
+
+	// checksums of each file, keyed by slash-separated path
+	Files map[string]string
+}
+
+type Manifest struct {
+	Entries []Entry
+}
+
+type InvalidManifestError struct {
+	Path string
+	Line int
+}
+
+func (e InvalidManifestError) Error() string {
+	return fmt.Sprintf("invalid vendor manifest %s (line %d)", e.Path, e.Line)
+}
+
+// reads the manifest in the vendor directory; a missing manifest is empty
+func ReadManifest(vendorDir string) (*Manifest, error) {
+	manifestPath := filepath.Join(vendorDir, ManifestFile)
+
+	manifest := &Manifest{}
+
+	file, err := os.Open(manifestPath)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// files are indented beneath their dependency
+		if strings.HasPrefix(text, "\t") {
+			segments := strings.SplitN(text[1:], "  ", 2)
+			if len(segments) != 2 || len(manifest.Entries) == 0 {
+				return nil, InvalidManifestError{manifestPath, line}
+			}
+
+			entry := &manifest.Entries[len(manifest.Entries)-1]
+			entry.Files[segments[1]] = segments[0]
+
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, InvalidManifestError{manifestPath, line}
+		}
+
+		manifest.Entries = append(manifest.Entries, Entry{
+			Path:    fields[0],
+			Version: fields[1],
+			Files:   map[string]string{},
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func (m *Manifest) Save(vendorDir string) error {
+	file, err := os.Create(filepath.Join(vendorDir, ManifestFile))
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintln(writer, "# written by 'gocart vendor'; verified by 'gocart check -vendor'")
+
+	for _, entry := range m.Entries {
+		fmt.Fprintf(writer, "%s\t%s\n", entry.Path, entry.Version)
+
+		paths := []string{}
+		for path := range entry.Files {
+			paths = append(paths, path)
+		}
+
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			fmt.Fprintf(writer, "\t%s  %s\n", entry.Files[path], path)
+		}
+	}
+
+	err = writer.Flush()
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (m *Manifest) Lookup(path string) (Entry, bool) {
+	for _, entry := range m.Entries {
+		if entry.Path == path {
+			return entry, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// adds the entry, replacing any for the same path
+func (m *Manifest) Add(entry Entry) {
+	for i, existing := range m.Entries {
+		if existing.Path == entry.Path {
+			m.Entries[i] = entry
+			return
+		}
+	}
+
+	m.Entries = append(m.Entries, entry)
+}
+
+// records the files vendored for the path at the version
+func Record(vendorDir string, path string, version string) (Entry, error) {
+	files, err := archive.Checksums(filepath.Join(vendorDir, filepath.FromSlash(path)))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{
+		Path:    path,
+		Version: version,
+		Files:   files,
+	}, nil
+}
+
+// compares the vendored files to those recorded
+func (e Entry) Verify(vendorDir string) (modified, missing, untracked []string, err error) {
+	files, err := archive.Checksums(filepath.Join(vendorDir, filepath.FromSlash(e.Path)))
+	if os.IsNotExist(err) {
+		files = map[string]string{}
+	} else if err != nil {
+		return nil, nil, nil, err
+	}
+
+	modified, missing, untracked = archive.Compare(e.Files, files)
+
+	return modified, missing, untracked, nil
+}
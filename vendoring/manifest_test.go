@@ -0,0 +1,124 @@
+package vendoring_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vito/gocart/vendoring"
+)
+
+var _ = Describe("Manifest", func() {
+	var vendorDir string
+
+	writeFile := func(path string, contents string) {
+		fullPath := filepath.Join(vendorDir, filepath.FromSlash(path))
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = ioutil.WriteFile(fullPath, []byte(contents), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		vendorDir, err = ioutil.TempDir("", "vendor")
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile("github.com/a/lib/lib.go", "package lib\n")
+		writeFile("github.com/a/lib/sub/sub.go", "package sub\n")
+		writeFile("github.com/b/other/other.go", "package other\n")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(vendorDir)
+	})
+
+	It("is empty when there is no manifest", func() {
+		manifest, err := vendoring.ReadManifest(vendorDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifest.Entries).To(BeEmpty())
+	})
+
+	It("round-trips the recorded files of each dependency", func() {
+		lib, err := vendoring.Record(vendorDir, "github.com/a/lib", "lib-sha")
+		Expect(err).ToNot(HaveOccurred())
+
+		other, err := vendoring.Record(vendorDir, "github.com/b/other", "other-sha")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(lib.Files).To(HaveLen(2))
+		Expect(lib.Files).To(HaveKey("sub/sub.go"))
+
+		manifest := &vendoring.Manifest{}
+		manifest.Add(lib)
+		manifest.Add(other)
+
+		err = manifest.Save(vendorDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		loaded, err := vendoring.ReadManifest(vendorDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(Equal(manifest))
+	})
+
+	Describe("Add", func() {
+		It("replaces an entry for the same path", func() {
+			manifest := &vendoring.Manifest{}
+			manifest.Add(vendoring.Entry{Path: "github.com/a/lib", Version: "old"})
+			manifest.Add(vendoring.Entry{Path: "github.com/a/lib", Version: "new"})
+
+			entry, found := manifest.Lookup("github.com/a/lib")
+			Expect(found).To(BeTrue())
+			Expect(entry.Version).To(Equal("new"))
+			Expect(manifest.Entries).To(HaveLen(1))
+		})
+	})
+
+	Describe("Verify", func() {
+		var entry vendoring.Entry
+
+		BeforeEach(func() {
+			var err error
+
+			entry, err = vendoring.Record(vendorDir, "github.com/a/lib", "lib-sha")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("finds nothing when the files are unchanged", func() {
+			modified, missing, untracked, err := entry.Verify(vendorDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(modified).To(BeEmpty())
+			Expect(missing).To(BeEmpty())
+			Expect(untracked).To(BeEmpty())
+		})
+
+		It("reports modified, missing and untracked files", func() {
+			writeFile("github.com/a/lib/lib.go", "package changed\n")
+			writeFile("github.com/a/lib/new.go", "package lib\n")
+
+			err := os.Remove(filepath.Join(vendorDir, "github.com", "a", "lib", "sub", "sub.go"))
+			Expect(err).ToNot(HaveOccurred())
+
+			modified, missing, untracked, err := entry.Verify(vendorDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(modified).To(Equal([]string{"lib.go"}))
+			Expect(missing).To(Equal([]string{"sub/sub.go"}))
+			Expect(untracked).To(Equal([]string{"new.go"}))
+		})
+
+		It("reports every file missing when the dependency is gone", func() {
+			err := os.RemoveAll(filepath.Join(vendorDir, "github.com", "a"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, missing, _, err := entry.Verify(vendorDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(Equal([]string{"lib.go", "sub/sub.go"}))
+		})
+	})
+})